@@ -0,0 +1,41 @@
+package agenda
+
+import (
+	"time"
+)
+
+// Timezone is the zone whose calendar decides what "today" is, from the
+// Timezone config key. Notes can override it with tz.
+var Timezone = time.Local
+
+// Clock returns the current wall-clock time in Timezone as a UTC time, the
+// floating form dates take throughout, so day arithmetic follows Timezone's
+// calendar. Scans read it instead of time.Now so a run can be replayed
+// against a frozen time (--deterministic-check).
+var Clock = func() time.Time { return WallClock(time.Now(), Timezone) }
+
+// WallClock returns t's wall-clock time in loc as a UTC time
+func WallClock(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
+
+// AtZone is the inverse of WallClock: the instant with t's wall-clock time in loc
+func AtZone(t time.Time, loc *time.Location) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+}
+
+// noteNow returns now, a Clock reading, as seen from a note. Sub-day
+// dtstarts with a TZID are real instants, so they are compared with the real
+// current instant; notes with a tz field use that zone's wall clock.
+func noteNow(fm *FrontMatter, now time.Time) time.Time {
+	if fm.DTStartTZID != "" {
+		return AtZone(now, Timezone)
+	}
+	if fm.TZ != "" {
+		if loc, err := time.LoadLocation(fm.TZ); err == nil {
+			return WallClock(AtZone(now, Timezone), loc)
+		}
+	}
+	return now
+}
@@ -0,0 +1,26 @@
+package agenda
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNoteNow(t *testing.T) {
+	now := time.Date(2025, 3, 10, 2, 0, 0, 0, time.UTC)
+	originalClock, originalZone := Clock, Timezone
+	Clock, Timezone = func() time.Time { return now }, time.UTC
+	t.Cleanup(func() { Clock, Timezone = originalClock, originalZone })
+
+	if got := noteNow(&FrontMatter{}, Clock()); !got.Equal(now) {
+		t.Errorf("Without tz: expected %v, got %v", now, got)
+	}
+	// New York is still on the evening of the 9th
+	expected := time.Date(2025, 3, 9, 22, 0, 0, 0, time.UTC)
+	if got := noteNow(&FrontMatter{TZ: "America/New_York"}, Clock()); !got.Equal(expected) || got.Location() != time.UTC {
+		t.Errorf("With tz: expected wall clock %v, got %v", expected, got)
+	}
+	// Zoned sub-day dtstarts compare instants
+	if got := noteNow(&FrontMatter{DTStartTZID: "Europe/Kyiv", TZ: "America/New_York"}, Clock()); !got.Equal(now) {
+		t.Errorf("With dtstart_tzid: expected instant %v, got %v", now, got)
+	}
+}
@@ -0,0 +1,36 @@
+package agenda
+
+import (
+	"fmt"
+	"time"
+)
+
+// isCompleted reports whether a note is finished for good: marked done, or
+// a one-time event with a completed date. Such tasks are hidden unless
+// --show-completed is set.
+func isCompleted(fm *FrontMatter) bool {
+	return fm.Done || fm.RRule == "" && fm.Completed != ""
+}
+
+// parseCompleted parses a completed date, or returns the zero time when
+// none is set
+func parseCompleted(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	completed := ParseStartDate(value, time.Time{})
+	if completed.IsZero() {
+		return time.Time{}, Categorize(ErrBadDTStart, fmt.Errorf("invalid completed date %q", value))
+	}
+	return completed, nil
+}
+
+// occurrenceCompleted reports whether the active occurrence of a recurring
+// task was completed: its completed date falls on or after the day the
+// occurrence started. The task then waits for its next occurrence.
+func occurrenceCompleted(fm *FrontMatterWithDefaults, occurrence Occurrence) bool {
+	if fm.Completed.IsZero() || fm.RRule == "" {
+		return false
+	}
+	return !DayOf(fm.Completed).Before(DayOf(occurrence.Start))
+}
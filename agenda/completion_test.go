@@ -0,0 +1,62 @@
+package agenda
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProcessFile_CompletedOccurrence(t *testing.T) {
+	original := Clock
+	t.Cleanup(func() { Clock = original })
+
+	dir := t.TempDir()
+	september := time.Date(2025, 9, 20, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		completed string
+		now       time.Time
+		active    bool
+	}{
+		{"previous_occurrence_done", "2025-08-16", september, true},
+		{"done_on_start_day", "2025-09-15", september, false},
+		{"done_today", "2025-09-20", september, false},
+		{"next_occurrence", "2025-09-16", time.Date(2025, 10, 15, 12, 0, 0, 0, time.UTC), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			Clock = func() time.Time { return tt.now }
+			path := writeNote(t, dir, tt.name+".md", "---\nrrule: FREQ=MONTHLY;BYMONTHDAY=15\nduration: P10D\ndtstart: 2025-01-01\ncompleted: "+tt.completed+"\n---\n")
+			task, active := processFile(path, Clock(), ReadFile)
+			if task.Error != nil {
+				t.Fatalf("Unexpected error: %v", task.Error)
+			}
+			if active != tt.active {
+				t.Errorf("Expected active=%v, got %v", tt.active, active)
+			}
+			if !active && (task.DueDate != nil || task.NextStart == nil || !task.NextStart.Equal(time.Date(2025, 10, 15, 0, 0, 0, 0, time.UTC))) {
+				t.Errorf("Expected no due date and a next start of 2025-10-15, got %v / %v", task.DueDate, task.NextStart)
+			}
+			if task.Completed {
+				t.Error("A completed occurrence should not complete the series")
+			}
+		})
+	}
+}
+
+func TestProcessFile_DoneSeries(t *testing.T) {
+	dir := t.TempDir()
+	path := writeNote(t, dir, "standup.md", "---\nrrule: FREQ=DAILY\ndone: true\n---\n")
+	if task, _ := processFile(path, Clock(), ReadFile); !task.Completed {
+		t.Error("Expected done: true to complete a recurring task")
+	}
+}
+
+func TestProcessFile_BadCompleted(t *testing.T) {
+	dir := t.TempDir()
+	path := writeNote(t, dir, "rent.md", "---\nrrule: FREQ=MONTHLY\ncompleted: yesterday\n---\n")
+	task, _ := processFile(path, Clock(), ReadFile)
+	if ErrorCategory(task.Error) != ErrBadDTStart {
+		t.Errorf("Expected a bad dtstart error, got %v", task.Error)
+	}
+}
@@ -0,0 +1,400 @@
+package agenda
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultDuration is the active window used when a note has no duration.
+// It can be overridden with default_duration in the config file.
+var DefaultDuration = dayDuration(1)
+
+// taskDuration resolves a note's active window length: single-day notes
+// (single_day: true or duration: none) get exactly one day, notes without
+// a duration get the configured default
+func taskDuration(fm *FrontMatter) (CalendarDuration, error) {
+	duration := strings.TrimSpace(fm.Duration)
+	if fm.SingleDay || strings.EqualFold(duration, "none") {
+		return dayDuration(1), nil
+	}
+	if duration == "" {
+		return DefaultDuration, nil
+	}
+	return ParseCalendarDuration(duration)
+}
+
+// usesBusinessDays reports whether a note's parsed duration counts weekdays
+// only, via skip_weekends or a business-day duration such as P5BD or P1BDT2H
+func usesBusinessDays(fm *FrontMatter, duration CalendarDuration) bool {
+	return fm.SkipWeekends || duration.BusinessDays
+}
+
+func isWeekend(t time.Time) bool {
+	return t.Weekday() == time.Saturday || t.Weekday() == time.Sunday
+}
+
+// addWallClock adds d to t's wall-clock time in t's location, so a 09:00
+// start plus 4h ends at 13:00 even across a DST change. In UTC it is the
+// same as t.Add(d).
+func addWallClock(t time.Time, d time.Duration) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond()+int(d), t.Location())
+}
+
+// addMonths adds years and months to t's date, keeping its time of day.
+// Days past the end of the target month are clamped to its last day, so
+// Jan 31 plus a month is Feb 28 (29 in leap years) rather than March 3.
+func addMonths(t time.Time, years, months int) time.Time {
+	if years == 0 && months == 0 {
+		return t
+	}
+	first := time.Date(t.Year()+years, t.Month()+time.Month(months), 1, 0, 0, 0, 0, t.Location())
+	lastDay := first.AddDate(0, 1, -1).Day()
+	return time.Date(first.Year(), first.Month(), min(t.Day(), lastDay),
+		t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+}
+
+// WindowEnd returns the exclusive end of an active window starting at start.
+// Years and months are calendar offsets; sub-day durations are then added on
+// the wall clock. With businessDays, whole days count only weekdays, so a
+// window that crosses a weekend is extended by the weekend days, and a time
+// part after them (P1BDT2H) is added on the next weekday.
+func WindowEnd(start time.Time, duration CalendarDuration, businessDays bool) time.Time {
+	if businessDays && duration.wholeDays() > 0 {
+		return businessWindowEnd(start, duration)
+	}
+	if duration.Intraday() {
+		return addWallClock(addMonths(start, duration.Years, duration.Months), duration.Duration)
+	}
+	return addMonths(start, duration.Years, duration.Months).Add(duration.Duration)
+}
+
+// businessWindowEnd is WindowEnd counting weekdays only
+func businessWindowEnd(start time.Time, duration CalendarDuration) time.Time {
+	end := start
+	for remaining := duration.wholeDays(); remaining > 0; end = end.AddDate(0, 0, 1) {
+		if !isWeekend(end) {
+			remaining--
+		}
+	}
+	rest := duration.Duration % (24 * time.Hour)
+	if rest == 0 {
+		return end
+	}
+	for isWeekend(end) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return addWallClock(end, rest)
+}
+
+// windowStart is the inverse of windowEnd: the start of a window that ends
+// (exclusively) at end
+func windowStart(end time.Time, duration CalendarDuration, businessDays bool) time.Time {
+	if businessDays && duration.wholeDays() > 0 {
+		return businessWindowStart(end, duration)
+	}
+	if duration.Intraday() {
+		return addMonths(addWallClock(end, -duration.Duration), -duration.Years, -duration.Months)
+	}
+	return addMonths(end.Add(-duration.Duration), -duration.Years, -duration.Months)
+}
+
+// businessWindowStart is windowStart counting weekdays only
+func businessWindowStart(end time.Time, duration CalendarDuration) time.Time {
+	start := end
+	if rest := duration.Duration % (24 * time.Hour); rest != 0 {
+		start = addWallClock(start, -rest)
+		for isWeekend(start) {
+			start = start.AddDate(0, 0, -1)
+		}
+	}
+	for remaining := duration.wholeDays(); remaining > 0; {
+		start = start.AddDate(0, 0, -1)
+		if !isWeekend(start) {
+			remaining--
+		}
+	}
+	return start
+}
+
+// errDurationOverflow is returned for durations longer than time.Duration can hold
+var errDurationOverflow = errors.New("duration too large (maximum is about 292 years)")
+
+// addDurationUnits adds value*unit to total, failing instead of wrapping around
+func addDurationUnits(total time.Duration, value int64, unit time.Duration) (time.Duration, error) {
+	if value > (math.MaxInt64-int64(total))/int64(unit) {
+		return 0, errDurationOverflow
+	}
+	return total + time.Duration(value)*unit, nil
+}
+
+// addFractionalUnits adds a decimal number of units, such as 1.5 hours, to
+// total, rounded to the nanosecond
+func addFractionalUnits(total time.Duration, value string, unit time.Duration) (time.Duration, error) {
+	if !strings.Contains(value, ".") {
+		whole, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return 0, errDurationOverflow
+		}
+		return addDurationUnits(total, whole, unit)
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", value)
+	}
+	nanoseconds := math.Round(number * float64(unit))
+	if nanoseconds >= float64(math.MaxInt64-int64(total)) {
+		return 0, errDurationOverflow
+	}
+	return total + time.Duration(nanoseconds), nil
+}
+
+// clockDurationPattern matches clock-style durations: HH:MM or HH:MM:SS
+var clockDurationPattern = regexp.MustCompile(`^(\d+):([0-5]\d)(?::([0-5]\d))?$`)
+
+// parseClockDuration parses a duration written as HH:MM:SS or HH:MM
+func parseClockDuration(durationStr string) (time.Duration, error) {
+	match := clockDurationPattern.FindStringSubmatch(durationStr)
+	if match == nil {
+		return 0, fmt.Errorf("invalid clock duration %q: expected HH:MM or HH:MM:SS", durationStr)
+	}
+	hours, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil {
+		return 0, errDurationOverflow
+	}
+	minutes, _ := strconv.Atoi(match[2])
+	seconds := 0
+	if match[3] != "" {
+		seconds, _ = strconv.Atoi(match[3])
+	}
+	return addDurationUnits(time.Duration(minutes)*time.Minute+time.Duration(seconds)*time.Second, hours, time.Hour)
+}
+
+// CalendarDuration is a task duration whose years and months are calendar
+// offsets, so P1M from Jan 15 ends on Feb 15 rather than after 30 days, and
+// from Jan 31 on the last day of February. Days, weeks and time are fixed
+// lengths in Duration.
+type CalendarDuration struct {
+	Years    int
+	Months   int
+	Duration time.Duration
+
+	// BusinessDays is set for durations written in business days (P5BD),
+	// whose days count weekdays only
+	BusinessDays bool
+}
+
+// dayDuration returns a duration of n fixed-length days
+func dayDuration(n int) CalendarDuration {
+	return CalendarDuration{Duration: time.Duration(n) * 24 * time.Hour}
+}
+
+// Intraday reports whether the duration is evaluated at time granularity
+// rather than in whole days (PT4H, P1MT2H)
+func (d CalendarDuration) Intraday() bool {
+	return isIntraday(d.Duration)
+}
+
+// String renders d as an ISO 8601 duration with whole days and time of
+// day split out, e.g. P1M2DT1H30M for P1M2DT90M
+func (d CalendarDuration) String() string {
+	var b strings.Builder
+	b.WriteString("P")
+	if d.Years != 0 {
+		fmt.Fprintf(&b, "%dY", d.Years)
+	}
+	if d.Months != 0 {
+		fmt.Fprintf(&b, "%dM", d.Months)
+	}
+	days, rest := d.Duration/(24*time.Hour), d.Duration%(24*time.Hour)
+	switch {
+	case days != 0 && d.BusinessDays:
+		fmt.Fprintf(&b, "%dBD", days)
+	case days != 0:
+		fmt.Fprintf(&b, "%dD", days)
+	}
+	if rest != 0 || b.Len() == 1 {
+		b.WriteString("T")
+		if hours := rest / time.Hour; hours != 0 {
+			fmt.Fprintf(&b, "%dH", hours)
+		}
+		if minutes := rest % time.Hour / time.Minute; minutes != 0 {
+			fmt.Fprintf(&b, "%dM", minutes)
+		}
+		if seconds := rest % time.Minute; seconds != 0 || b.Len() == 2 {
+			b.WriteString(strconv.FormatFloat(seconds.Seconds(), 'f', -1, 64) + "S")
+		}
+	}
+	return b.String()
+}
+
+// wholeDays returns the duration in days, approximating months as 30 days
+// and years as 365, for counting business days
+func (d CalendarDuration) wholeDays() int {
+	approximate, _ := d.Approximate()
+	return int(approximate / (24 * time.Hour))
+}
+
+// Approximate collapses d into a time.Duration, counting a month as 30 days
+// and a year as 365
+func (d CalendarDuration) Approximate() (time.Duration, error) {
+	total, err := addDurationUnits(d.Duration, int64(d.Months), 30*24*time.Hour)
+	if err != nil {
+		return 0, err
+	}
+	return addDurationUnits(total, int64(d.Years), 365*24*time.Hour)
+}
+
+// ParseDuration parses ISO 8601 duration string. Months and years are
+// approximated as 30 and 365 days; use ParseCalendarDuration where the
+// duration is applied to a date.
+func ParseDuration(durationStr string) (time.Duration, error) {
+	duration, err := ParseCalendarDuration(durationStr)
+	if err != nil {
+		return 0, err
+	}
+	return duration.Approximate()
+}
+
+// ParseCalendarDuration parses an ISO 8601 or clock duration, keeping its
+// years and months as calendar offsets
+func ParseCalendarDuration(durationStr string) (CalendarDuration, error) {
+	if durationStr == "" {
+		return dayDuration(1), nil // Default to 1 day
+	}
+
+	if strings.Contains(durationStr, ":") {
+		duration, err := parseClockDuration(durationStr)
+		return CalendarDuration{Duration: duration}, err
+	}
+
+	// Designators are matched case-insensitively (p1d, PT2h)
+	durationStr = strings.ToUpper(durationStr)
+
+	// Parse ISO 8601 duration format (P1D, P1W, P1M, PT1H, etc.)
+	if !strings.HasPrefix(durationStr, "P") {
+		return CalendarDuration{}, fmt.Errorf("duration must start with 'P'")
+	}
+
+	var calendar CalendarDuration
+	duration := time.Duration(0)
+	remaining := durationStr[1:] // Remove 'P'
+
+	// Check for time component (after 'T')
+	timePart := ""
+	hasTime := false
+	if tIndex := strings.Index(remaining, "T"); tIndex >= 0 {
+		timePart = remaining[tIndex+1:]
+		remaining = remaining[:tIndex]
+		hasTime = true
+	}
+	dateComponents, timeComponents := 0, 0
+
+	// Parse date components (before 'T')
+	for remaining != "" {
+		i := 0
+		for i < len(remaining) && (remaining[i] >= '0' && remaining[i] <= '9') {
+			i++
+		}
+		if i == 0 {
+			return CalendarDuration{}, fmt.Errorf("expected a number before %s", remaining)
+		}
+		dateComponents++
+
+		if i == len(remaining) {
+			return CalendarDuration{}, fmt.Errorf("missing unit after %s", remaining)
+		}
+		value, err := strconv.ParseInt(remaining[:i], 10, 64)
+		if err != nil {
+			return CalendarDuration{}, errDurationOverflow
+		}
+		unit := remaining[i : i+1]
+		remaining = remaining[i+1:]
+
+		switch unit {
+		case "D":
+			duration, err = addDurationUnits(duration, value, 24*time.Hour)
+		case "B":
+			// Business days (P5BD), which skip weekends
+			if !strings.HasPrefix(remaining, "D") {
+				return CalendarDuration{}, fmt.Errorf("unknown date unit: B")
+			}
+			remaining = remaining[1:]
+			calendar.BusinessDays = true
+			duration, err = addDurationUnits(duration, value, 24*time.Hour)
+		case "W":
+			duration, err = addDurationUnits(duration, value, 7*24*time.Hour)
+		case "M":
+			calendar.Months, err = addCalendarUnits(calendar.Months, value)
+		case "Y":
+			calendar.Years, err = addCalendarUnits(calendar.Years, value)
+		default:
+			return CalendarDuration{}, fmt.Errorf("unknown date unit: %s", unit)
+		}
+		if err != nil {
+			return CalendarDuration{}, err
+		}
+	}
+
+	// Parse time components (after 'T'), which may be fractional (PT1.5H)
+	for timePart != "" {
+		i := 0
+		for i < len(timePart) && (timePart[i] >= '0' && timePart[i] <= '9' || timePart[i] == '.') {
+			i++
+		}
+		if i == 0 {
+			return CalendarDuration{}, fmt.Errorf("expected a number before %s", timePart)
+		}
+		timeComponents++
+
+		if i == len(timePart) {
+			return CalendarDuration{}, fmt.Errorf("missing unit after %s", timePart)
+		}
+		value := timePart[:i]
+		unit := timePart[i : i+1]
+		timePart = timePart[i+1:]
+
+		var err error
+		switch unit {
+		case "H":
+			duration, err = addFractionalUnits(duration, value, time.Hour)
+		case "M":
+			duration, err = addFractionalUnits(duration, value, time.Minute)
+		case "S":
+			duration, err = addFractionalUnits(duration, value, time.Second)
+		default:
+			return CalendarDuration{}, fmt.Errorf("unknown time unit: %s", unit)
+		}
+		if err != nil {
+			return CalendarDuration{}, err
+		}
+	}
+
+	// P and PT alone, or a T with nothing after it, would silently be zero
+	if dateComponents+timeComponents == 0 {
+		return CalendarDuration{}, fmt.Errorf("duration %s has no components", durationStr)
+	}
+	if hasTime && timeComponents == 0 {
+		return CalendarDuration{}, fmt.Errorf("missing time components after T in %s", durationStr)
+	}
+
+	calendar.Duration = duration
+	// Durations must still fit a time.Duration when approximated
+	if _, err := calendar.Approximate(); err != nil {
+		return CalendarDuration{}, err
+	}
+	return calendar, nil
+}
+
+// addCalendarUnits adds value years or months to total, failing for values
+// too large to ever be approximated as a time.Duration
+func addCalendarUnits(total int, value int64) (int, error) {
+	if value > math.MaxInt32-int64(total) {
+		return 0, errDurationOverflow
+	}
+	return total + int(value), nil
+}
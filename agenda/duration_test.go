@@ -0,0 +1,368 @@
+package agenda
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected time.Duration
+		hasError bool
+	}{
+		{"", 24 * time.Hour, false},                        // Default 1 day
+		{"P1D", 24 * time.Hour, false},                     // 1 day
+		{"P10D", 10 * 24 * time.Hour, false},               // 10 days
+		{"P5D", 5 * 24 * time.Hour, false},                 // 5 days
+		{"P6D", 6 * 24 * time.Hour, false},                 // 6 days
+		{"P3D", 3 * 24 * time.Hour, false},                 // 3 days
+		{"P1W", 7 * 24 * time.Hour, false},                 // 1 week
+		{"PT2H", 2 * time.Hour, false},                     // 2 hours
+		{"PT30M", 30 * time.Minute, false},                 // 30 minutes
+		{"P1DT2H", 26 * time.Hour, false},                  // 1 day + 2 hours
+		{"p1d", 24 * time.Hour, false},                     // lowercase
+		{"P1d", 24 * time.Hour, false},                     // mixed case unit
+		{"PT2h", 2 * time.Hour, false},                     // mixed case time unit
+		{"pt1h30m", 90 * time.Minute, false},               // lowercase time
+		{"p1dt2h", 26 * time.Hour, false},                  // lowercase combined
+		{"invalid", 0, true},                               // Invalid format
+		{"P1", 0, true},                                    // Missing unit
+		{"P5BD", 5 * 24 * time.Hour, false},                // 5 business days
+		{"p2bd", 2 * 24 * time.Hour, false},                // lowercase business days
+		{"P5B", 0, true},                                   // B without D
+		{"02:30:00", 150 * time.Minute, false},             // clock HH:MM:SS
+		{"00:45", 45 * time.Minute, false},                 // clock HH:MM
+		{"36:00:05", 36*time.Hour + 5*time.Second, false},  // hours past a day
+		{"2:30", 150 * time.Minute, false},                 // single-digit hours
+		{"02:75", 0, true},                                 // minutes out of range
+		{"02:30:", 0, true},                                // dangling separator
+		{"1:2:3", 0, true},                                 // unpadded fields
+		{"PT02:30", 0, true},                               // ISO and clock mixed
+		{"PT1.5H", 90 * time.Minute, false},                // fractional hours
+		{"PT0.25H", 15 * time.Minute, false},               // quarter hour
+		{"PT90.5S", 90500 * time.Millisecond, false},       // fractional seconds
+		{"P1DT0.5H", 24*time.Hour + 30*time.Minute, false}, // day plus half hour
+		{"PT1.2.3H", 0, true},                              // two decimal points
+		{"PT.H", 0, true},                                  // no digits
+		{"P", 0, true},                                     // no components
+		{"PT", 0, true},                                    // no time components
+		{"p", 0, true},                                     // lowercase, no components
+		{"P1DT", 0, true},                                  // T with nothing after it
+		{"P1DX", 0, true},                                  // trailing junk
+		{"PTH", 0, true},                                   // unit without a number
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := ParseDuration(tt.input)
+			if tt.hasError {
+				if err == nil {
+					t.Errorf("Expected error for input %q, got none", tt.input)
+				}
+			} else {
+				if err != nil {
+					t.Errorf("Unexpected error for input %q: %v", tt.input, err)
+				}
+				if result != tt.expected {
+					t.Errorf("For input %q: expected %v, got %v", tt.input, tt.expected, result)
+				}
+			}
+		})
+	}
+}
+
+func TestParseCalendarDuration(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected CalendarDuration
+	}{
+		{"P1M", CalendarDuration{Months: 1}},
+		{"P1Y", CalendarDuration{Years: 1}},
+		{"p1y2m3d", CalendarDuration{Years: 1, Months: 2, Duration: 3 * 24 * time.Hour}},
+		{"P1MT2H", CalendarDuration{Months: 1, Duration: 2 * time.Hour}},
+		{"P2W", dayDuration(14)},
+		{"02:30", CalendarDuration{Duration: 150 * time.Minute}},
+		{"", dayDuration(1)},
+	}
+	for _, tt := range tests {
+		got, err := ParseCalendarDuration(tt.input)
+		if err != nil || got != tt.expected {
+			t.Errorf("%q: expected %+v, got %+v (err %v)", tt.input, tt.expected, got, err)
+		}
+	}
+
+	// ParseDuration keeps approximating months and years
+	if d, err := ParseDuration("P1Y1M"); err != nil || d != 395*24*time.Hour {
+		t.Errorf("Expected P1Y1M to approximate to 395 days, got %v (err %v)", d, err)
+	}
+}
+
+func TestWindowEnd_CalendarMonths(t *testing.T) {
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name     string
+		start    time.Time
+		duration string
+		end      time.Time
+	}{
+		{"february", date(2025, 2, 1), "P1M", date(2025, 3, 1)},
+		{"thirty_one_days", date(2025, 1, 1), "P1M", date(2025, 2, 1)},
+		{"leap_year", date(2024, 1, 1), "P1Y", date(2025, 1, 1)},
+		{"month_and_days", date(2025, 4, 1), "P1M2D", date(2025, 5, 3)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			duration, err := ParseCalendarDuration(tt.duration)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if end := WindowEnd(tt.start, duration, false); !end.Equal(tt.end) {
+				t.Errorf("Expected %s from %v to end %v, got %v", tt.duration, tt.start, tt.end, end)
+			}
+			if start := windowStart(tt.end, duration, false); !start.Equal(tt.start) {
+				t.Errorf("Expected windowStart to invert to %v, got %v", tt.start, start)
+			}
+		})
+	}
+}
+
+func TestWindowEnd_MonthEnd(t *testing.T) {
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+	// Days past the end of the target month are clamped to its last day
+	ends := []struct {
+		name     string
+		start    time.Time
+		duration string
+		end      time.Time
+	}{
+		{"jan_31", date(2025, 1, 31), "P1M", date(2025, 2, 28)},
+		{"jan_31_leap_year", date(2024, 1, 31), "P1M", date(2024, 2, 29)},
+		{"feb_29_plus_year", date(2024, 2, 29), "P1Y", date(2025, 2, 28)},
+		{"aug_31", date(2025, 8, 31), "P1M", date(2025, 9, 30)},
+		{"dec_31_three_months", date(2024, 12, 31), "P3M", date(2025, 3, 31)},
+		{"jan_31_with_time", time.Date(2025, 1, 31, 9, 0, 0, 0, time.UTC), "P1MT2H", time.Date(2025, 2, 28, 11, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range ends {
+		t.Run(tt.name, func(t *testing.T) {
+			duration, err := ParseCalendarDuration(tt.duration)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if end := WindowEnd(tt.start, duration, false); !end.Equal(tt.end) {
+				t.Errorf("Expected %s from %v to end %v, got %v", tt.duration, tt.start, tt.end, end)
+			}
+		})
+	}
+
+	starts := []struct {
+		name     string
+		end      time.Time
+		duration string
+		start    time.Time
+	}{
+		{"mar_31", date(2025, 3, 31), "P1M", date(2025, 2, 28)},
+		{"mar_31_leap_year", date(2024, 3, 31), "P1M", date(2024, 2, 29)},
+		{"feb_29_minus_year", date(2024, 2, 29), "P1Y", date(2023, 2, 28)},
+	}
+	for _, tt := range starts {
+		t.Run(tt.name, func(t *testing.T) {
+			duration, err := ParseCalendarDuration(tt.duration)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if start := windowStart(tt.end, duration, false); !start.Equal(tt.start) {
+				t.Errorf("Expected %s before %v to start %v, got %v", tt.duration, tt.end, tt.start, start)
+			}
+		})
+	}
+}
+
+func TestIsTaskActive_MonthlyDuration(t *testing.T) {
+	// A monthly window is active for the whole calendar month, however long
+	fm := &FrontMatter{RRule: "FREQ=MONTHLY;BYMONTHDAY=1", DTStart: "2025-01-01", Duration: "P1M"}
+
+	tests := []struct {
+		date     time.Time
+		expected bool
+		due      time.Time
+	}{
+		{time.Date(2025, 2, 28, 12, 0, 0, 0, time.UTC), true, time.Date(2025, 2, 28, 0, 0, 0, 0, time.UTC)},
+		{time.Date(2025, 3, 31, 12, 0, 0, 0, time.UTC), true, time.Date(2025, 3, 31, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		fmWithDefaults, err := ApplyDefaults(fm, tt.date)
+		if err != nil {
+			t.Fatalf("ApplyDefaults failed: %v", err)
+		}
+		if active, err := IsTaskActive(fmWithDefaults, tt.date); err != nil || active != tt.expected {
+			t.Errorf("%v: expected active %v, got %v (err %v)", tt.date, tt.expected, active, err)
+		}
+		// With 30-day months the February window would run into March
+		if due := CurrentDueDate(fmWithDefaults, tt.date); due == nil || !due.Equal(tt.due) {
+			t.Errorf("%v: expected due %v, got %v", tt.date, tt.due, due)
+		}
+	}
+}
+
+func TestParseDuration_Overflow(t *testing.T) {
+	tests := []struct {
+		input    string
+		hasError bool
+	}{
+		{"P106751D", false},              // just under the time.Duration limit
+		{"P106752D", true},               // just over
+		{"P292Y", false},                 // 292 approximate years fit
+		{"P293Y", true},                  // 293 do not
+		{"P1000Y", true},                 // typo-sized value
+		{"PT2562047H", false},            // max whole hours
+		{"PT2562048H", true},             // one hour too many
+		{"P106751DT23H", false},          // combined components under the limit
+		{"P106751DT24H", true},           // combined components over the limit
+		{"P99999999999999999999D", true}, // doesn't fit in int64 at all
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := ParseDuration(tt.input)
+			if tt.hasError {
+				if !errors.Is(err, errDurationOverflow) {
+					t.Errorf("Expected overflow error for %q, got %v (%v)", tt.input, err, result)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Unexpected error for %q: %v", tt.input, err)
+			}
+			if result <= 0 {
+				t.Errorf("Expected positive duration for %q, got %v", tt.input, result)
+			}
+		})
+	}
+}
+
+func TestTaskDuration(t *testing.T) {
+	t.Cleanup(func() { DefaultDuration = dayDuration(1) })
+	DefaultDuration = dayDuration(3)
+
+	tests := []struct {
+		name     string
+		fm       FrontMatter
+		expected CalendarDuration
+	}{
+		{"empty_uses_configured_default", FrontMatter{}, dayDuration(3)},
+		{"explicit_duration", FrontMatter{Duration: "P5D"}, dayDuration(5)},
+		{"calendar_months", FrontMatter{Duration: "P1Y2MT3H"}, CalendarDuration{Years: 1, Months: 2, Duration: 3 * time.Hour}},
+		{"duration_none", FrontMatter{Duration: "none"}, dayDuration(1)},
+		{"single_day_without_duration", FrontMatter{SingleDay: true}, dayDuration(1)},
+		{"single_day_overrides_duration", FrontMatter{Duration: "P5D", SingleDay: true}, dayDuration(1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := taskDuration(&tt.fm)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestBusinessDayWindow(t *testing.T) {
+	friday := time.Date(2025, 10, 17, 0, 0, 0, 0, time.UTC)
+	tuesday := time.Date(2025, 10, 21, 0, 0, 0, 0, time.UTC)
+	wednesday := tuesday.AddDate(0, 0, 1)
+
+	if end := WindowEnd(friday, dayDuration(3), true); !end.Equal(wednesday) {
+		t.Errorf("Expected 3 business days from Friday to end on Wednesday, got %v", end)
+	}
+	if start := windowStart(wednesday, dayDuration(3), true); !start.Equal(friday) {
+		t.Errorf("Expected 3 business days before Wednesday to start on Friday, got %v", start)
+	}
+	if end := WindowEnd(friday, dayDuration(3), false); !end.Equal(friday.AddDate(0, 0, 3)) {
+		t.Errorf("Expected calendar window to end on Monday, got %v", end)
+	}
+
+	// A time part is added on the weekday after the whole days
+	withTime, err := ParseCalendarDuration("P1BDT2H")
+	if err != nil || !withTime.BusinessDays {
+		t.Fatalf("Expected P1BDT2H to count business days, got %+v (err %v)", withTime, err)
+	}
+	fridayMorning := friday.Add(9 * time.Hour)
+	mondayEleven := friday.AddDate(0, 0, 3).Add(11 * time.Hour)
+	if end := WindowEnd(fridayMorning, withTime, withTime.BusinessDays); !end.Equal(mondayEleven) {
+		t.Errorf("Expected P1BDT2H from Friday 09:00 to end Monday 11:00, got %v", end)
+	}
+	if start := windowStart(mondayEleven, withTime, withTime.BusinessDays); !start.Equal(fridayMorning) {
+		t.Errorf("Expected P1BDT2H before Monday 11:00 to start Friday 09:00, got %v", start)
+	}
+	if got := withTime.String(); got != "P1BDT2H" {
+		t.Errorf("Expected P1BDT2H to render as written, got %s", got)
+	}
+
+	fm := &FrontMatter{DTStart: "2025-10-17", Duration: "P3BD"}
+	if due := getOneTimeDueDate(fm); due == nil || !due.Equal(tuesday) {
+		t.Errorf("Expected one-time due date %v, got %v", tuesday, due)
+	}
+}
+
+func TestWindowEnd_DST(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("tzdata unavailable: %v", err)
+	}
+
+	// A 4h window from midnight on the spring-forward night still ends at
+	// 04:00 on the wall clock, 3h later in absolute time
+	start := time.Date(2025, 3, 30, 0, 0, 0, 0, berlin)
+	end := WindowEnd(start, CalendarDuration{Duration: 4 * time.Hour}, false)
+	if end.Hour() != 4 || end.Sub(start) != 3*time.Hour {
+		t.Errorf("Expected 04:00 local after 3h, got %v after %v", end, end.Sub(start))
+	}
+	if back := windowStart(end, CalendarDuration{Duration: 4 * time.Hour}, false); !back.Equal(start) {
+		t.Errorf("Expected windowStart to invert windowEnd, got %v", back)
+	}
+
+	// UTC has no DST, so wall-clock arithmetic matches plain addition
+	utc := time.Date(2025, 3, 30, 0, 0, 0, 0, time.UTC)
+	if got := WindowEnd(utc, CalendarDuration{Duration: 4 * time.Hour}, false); !got.Equal(utc.Add(4 * time.Hour)) {
+		t.Errorf("Expected plain addition in UTC, got %v", got)
+	}
+}
+
+func TestCalendarDurationString(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"P1D", "P1D"},
+		{"P1W", "P7D"},
+		{"P1M", "P1M"},
+		{"P1Y2M3D", "P1Y2M3D"},
+		{"PT90M", "PT1H30M"},
+		{"PT1.5H", "PT1H30M"},
+		{"PT90.5S", "PT1M30.5S"},
+		{"P1DT2H", "P1DT2H"},
+		{"02:30:00", "PT2H30M"},
+	}
+	for _, tt := range tests {
+		duration, err := ParseCalendarDuration(tt.input)
+		if err != nil {
+			t.Fatalf("ParseCalendarDuration(%q) failed: %v", tt.input, err)
+		}
+		if got := duration.String(); got != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.input, tt.expected, got)
+		}
+	}
+	if got := (CalendarDuration{}).String(); got != "PT0S" {
+		t.Errorf("Expected PT0S for a zero duration, got %s", got)
+	}
+}
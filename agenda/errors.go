@@ -0,0 +1,56 @@
+package agenda
+
+import (
+	"errors"
+	"path/filepath"
+)
+
+// Categories of note errors, matched with errors.Is
+var (
+	ErrBadRRule    = errors.New("bad rrule")
+	ErrBadDuration = errors.New("bad duration")
+	ErrBadDTStart  = errors.New("bad dtstart")
+	ErrBadExDate   = errors.New("bad exdate")
+	ErrBadTimezone = errors.New("bad tz")
+	ErrYAML        = errors.New("YAML error")
+	ErrIO          = errors.New("IO error")
+)
+
+// ErrorCategories lists the categories in the order the error section
+// prints them
+var ErrorCategories = []error{ErrBadRRule, ErrBadDuration, ErrBadDTStart, ErrBadExDate, ErrBadTimezone, ErrYAML, ErrIO}
+
+// categorizedError tags an error with its category without changing its
+// message
+type categorizedError struct {
+	category error
+	err      error
+}
+
+func (e *categorizedError) Error() string   { return e.err.Error() }
+func (e *categorizedError) Unwrap() []error { return []error{e.category, e.err} }
+
+// Categorize tags err as belonging to category
+func Categorize(category, err error) error {
+	return &categorizedError{category: category, err: err}
+}
+
+// SidecarError is an error in a note's sidecar file rather than in the
+// note itself
+type SidecarError struct {
+	Path string
+	Err  error
+}
+
+func (e *SidecarError) Error() string { return filepath.Base(e.Path) + ": " + e.Err.Error() }
+func (e *SidecarError) Unwrap() error { return e.Err }
+
+// ErrorCategory returns the category of err, or nil for uncategorized errors
+func ErrorCategory(err error) error {
+	for _, category := range ErrorCategories {
+		if errors.Is(err, category) {
+			return category
+		}
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+package agenda
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCategorizeKeepsMessage(t *testing.T) {
+	cause := errors.New("unknown unit")
+	err := Categorize(ErrBadDuration, cause)
+	if err.Error() != "unknown unit" {
+		t.Errorf("Expected the original message, got %q", err.Error())
+	}
+	if !errors.Is(err, ErrBadDuration) || !errors.Is(err, cause) {
+		t.Error("Expected both the category and the cause to match")
+	}
+	if ErrorCategory(errors.New("plain")) != nil {
+		t.Error("Expected uncategorized errors to have no category")
+	}
+}
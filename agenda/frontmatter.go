@@ -0,0 +1,307 @@
+package agenda
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ReadAttempts is how many times a note is read before a transient error is
+// reported. It can be overridden with read_retries in the config file.
+var ReadAttempts = 3
+
+// readBackoff is the delay before the first retry; it doubles on each attempt.
+var readBackoff = 50 * time.Millisecond
+
+// ReadFile is the underlying file reader, replaceable in tests.
+var ReadFile = os.ReadFile
+
+// ErrNoFrontMatter is returned for notes that don't open with front matter,
+// which aren't task notes unless a sidecar file schedules them
+var ErrNoFrontMatter = errors.New("no frontmatter")
+
+// isDelimiterLine reports whether a line, with its \n or \r\n line ending,
+// is exactly ---
+func isDelimiterLine(line string) bool {
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r") == "---"
+}
+
+// HasFrontMatter reports whether a note opens with a --- line
+func HasFrontMatter(content string) bool {
+	first, _, _ := strings.Cut(content, "\n")
+	return isDelimiterLine(first)
+}
+
+// FrontMatterEnd returns the offset of the line closing a note's front
+// matter: the first line after the opening one that is exactly ---, so a
+// --- inside a value or a horizontal rule in the body can't end it early.
+// It returns -1 when the front matter is never closed.
+func FrontMatterEnd(content string) int {
+	_, rest, _ := strings.Cut(content, "\n")
+	offset := len(content) - len(rest)
+	for line := range strings.Lines(rest) {
+		if isDelimiterLine(line) {
+			return offset
+		}
+		offset += len(line)
+	}
+	return -1
+}
+
+// ParseFrontMatter parses YAML frontmatter from content string
+func ParseFrontMatter(content string) (*FrontMatter, error) {
+	if !HasFrontMatter(content) {
+		return nil, ErrNoFrontMatter
+	}
+	end := FrontMatterEnd(content)
+	if end < 0 {
+		return nil, Categorize(ErrYAML, fmt.Errorf("invalid frontmatter format"))
+	}
+
+	// The block keeps the newline after the opening ---, so YAML line numbers
+	// are line numbers within the note
+	var fm FrontMatter
+	if err := yaml.Unmarshal([]byte(content[len("---"):end]), &fm); err != nil {
+		return nil, Categorize(ErrYAML, YAMLError(err))
+	}
+	fm.Body = content[end+len("---"):]
+	resolveEmbeddedDTStart(&fm)
+
+	return &fm, nil
+}
+
+// yamlErrorPattern splits a yaml.v3 error into its line and message
+var yamlErrorPattern = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// YAMLError rewrites a yaml.v3 error as "YAML error at line 4: ...". Front
+// matter is handed to yaml starting on the opening --- line, so the line is
+// counted within the note.
+func YAMLError(err error) error {
+	message := err.Error()
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) && len(typeErr.Errors) > 0 {
+		message = typeErr.Errors[0]
+		if more := len(typeErr.Errors) - 1; more > 0 {
+			message += fmt.Sprintf(" (and %d more)", more)
+		}
+	}
+	if match := yamlErrorPattern.FindStringSubmatch(message); match != nil {
+		return fmt.Errorf("YAML error at line %s: %s", match[1], match[2])
+	}
+	return fmt.Errorf("YAML error: %s", strings.TrimPrefix(message, "yaml: "))
+}
+
+// ParseSidecar parses the YAML of a note.task.yaml sidecar file, which holds
+// the same fields as front matter for notes that keep scheduling out of the body
+func ParseSidecar(content string) (*FrontMatter, error) {
+	var fm FrontMatter
+	if err := yaml.Unmarshal([]byte(content), &fm); err != nil {
+		return nil, Categorize(ErrYAML, YAMLError(err))
+	}
+	resolveEmbeddedDTStart(&fm)
+	return &fm, nil
+}
+
+// resolveEmbeddedDTStart moves a DTSTART pasted into rrule over to dtstart,
+// along with any EXRULE and EXDATE lines pasted with it. The embedded values
+// win, with a warning when the fields disagree; other property lines are
+// dropped with a warning.
+func resolveEmbeddedDTStart(fm *FrontMatter) {
+	embedded, ok := splitEmbeddedRule(fm.RRule)
+	if !ok {
+		return
+	}
+	if fm.DTStart != "" && fm.DTStart != embedded.DTStart {
+		fm.Warnings = append(fm.Warnings, fmt.Sprintf("rrule has its own DTSTART %s, ignoring dtstart %s", embedded.DTStart, fm.DTStart))
+	}
+	fm.RRule, fm.DTStart = embedded.RRule, embedded.DTStart
+	if embedded.TZID != "" {
+		if fm.DTStartTZID != "" && fm.DTStartTZID != embedded.TZID {
+			fm.Warnings = append(fm.Warnings, fmt.Sprintf("rrule has its own TZID %s, ignoring dtstart_tzid %s", embedded.TZID, fm.DTStartTZID))
+		}
+		fm.DTStartTZID = embedded.TZID
+	}
+	if embedded.ExRule != "" {
+		if fm.ExRule != "" && fm.ExRule != embedded.ExRule {
+			fm.Warnings = append(fm.Warnings, fmt.Sprintf("rrule has its own EXRULE %s, ignoring exrule %s", embedded.ExRule, fm.ExRule))
+		}
+		fm.ExRule = embedded.ExRule
+	}
+	fm.ExDate = append(fm.ExDate, embedded.ExDates...)
+	for _, name := range embedded.Ignored {
+		fm.Warnings = append(fm.Warnings, fmt.Sprintf("rrule has a %s line, which is not supported; ignoring it", name))
+	}
+}
+
+// embeddedRule is iCal rule text pasted into rrule, split into its lines
+type embeddedRule struct {
+	DTStart string
+	TZID    string
+	RRule   string
+	ExRule  string
+	ExDates []string
+	Ignored []string // names of other property lines, such as RDATE
+}
+
+// splitEmbeddedRule separates pasted iCal rule text such as
+// "DTSTART;TZID=Europe/Kyiv:20250101T090000\nRRULE:FREQ=DAILY\nEXDATE:20250105T090000"
+// into its properties. ok is false when the text has no DTSTART line or
+// doesn't hold exactly one rule.
+func splitEmbeddedRule(rule string) (embedded embeddedRule, ok bool) {
+	var rules []string
+	for _, line := range strings.Fields(rule) {
+		name, params, value, isProperty := icalProperty(line)
+		switch {
+		case !isProperty:
+			// A bare FREQ=...;... line
+			rules = append(rules, line)
+		case name == "DTSTART":
+			// DTSTART:20250101T000000Z or DTSTART;TZID=...:20250101T090000
+			embedded.DTStart, embedded.TZID = value, params["TZID"]
+		case name == "RRULE":
+			rules = append(rules, value)
+		case name == "EXRULE":
+			embedded.ExRule = value
+		case name == "EXDATE":
+			embedded.ExDates = append(embedded.ExDates, strings.Split(value, ",")...)
+		default:
+			embedded.Ignored = append(embedded.Ignored, name)
+		}
+	}
+	if embedded.DTStart == "" || len(rules) != 1 {
+		return embeddedRule{}, false
+	}
+	embedded.RRule = rules[0]
+	return embedded, true
+}
+
+// icalProperty splits an iCal content line such as
+// "DTSTART;TZID=Europe/Kyiv:20250101T090000" into its uppercased name, its
+// parameters and its value. isProperty is false for lines without a colon.
+func icalProperty(line string) (name string, params map[string]string, value string, isProperty bool) {
+	head, value, found := strings.Cut(line, ":")
+	if !found {
+		return "", nil, "", false
+	}
+	parts := strings.Split(head, ";")
+	params = map[string]string{}
+	for _, param := range parts[1:] {
+		if key, val, found := strings.Cut(param, "="); found {
+			params[strings.ToUpper(key)] = val
+		}
+	}
+	return strings.ToUpper(parts[0]), params, value, true
+}
+
+// SplitEmbeddedDTStart separates pasted iCal rule text such as
+// "DTSTART;TZID=Europe/Kyiv:20250101T090000\nRRULE:FREQ=DAILY" into its
+// DTSTART value, TZID (if any) and the rule. ok is false when the rule has
+// no embedded DTSTART.
+func SplitEmbeddedDTStart(rule string) (dtStart, tzid, rest string, ok bool) {
+	embedded, ok := splitEmbeddedRule(rule)
+	if !ok {
+		return "", "", rule, false
+	}
+	return embedded.DTStart, embedded.TZID, embedded.RRule, true
+}
+
+// firstBodyLine returns the first non-empty line of a note body
+func firstBodyLine(body string) string {
+	for line := range strings.Lines(body) {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+// ReadFrontMatter reads file and parses frontmatter (wrapper for file I/O)
+func ReadFrontMatter(path string) (*FrontMatter, error) {
+	return readFrontMatter(path, ReadFile)
+}
+
+// readFrontMatter is ReadFrontMatter reading files with read
+func readFrontMatter(path string, read func(string) ([]byte, error)) (*FrontMatter, error) {
+	data, err := readWithRetry(path, read)
+	if err != nil {
+		return nil, Categorize(ErrIO, fmt.Errorf("read error: %w", err))
+	}
+	fm, err := ParseFrontMatter(string(data))
+	if !errors.Is(err, ErrNoFrontMatter) {
+		return fm, err
+	}
+
+	// Notes without front matter may keep their schedule in a sidecar file
+	sidecar := sidecarPath(path)
+	sidecarData, readErr := readWithRetry(sidecar, read)
+	if errors.Is(readErr, fs.ErrNotExist) {
+		return nil, err
+	}
+	if readErr != nil {
+		return nil, Categorize(ErrIO, fmt.Errorf("read error: %w", readErr))
+	}
+	fm, err = ParseSidecar(string(sidecarData))
+	if err != nil {
+		return nil, &SidecarError{Path: sidecar, Err: err}
+	}
+	fm.Body = string(data)
+	return fm, nil
+}
+
+// sidecarSuffix ends the name of a sidecar file
+const sidecarSuffix = ".task.yaml"
+
+// sidecarPath returns the note.task.yaml file next to note.md
+func sidecarPath(notePath string) string {
+	return strings.TrimSuffix(notePath, ".md") + sidecarSuffix
+}
+
+// orphanSidecar is the errored task reported for a sidecar file without the
+// note it schedules
+func orphanSidecar(path string) Task {
+	note := strings.TrimSuffix(path, sidecarSuffix) + ".md"
+	return Task{
+		Name:     cleanFilename(filepath.Base(note)),
+		Error:    fmt.Errorf("sidecar file has no note %s next to it", filepath.Base(note)),
+		FilePath: path,
+		Status:   StatusError,
+	}
+}
+
+// ReadFileWithRetry reads a file, retrying transient failures with
+// exponential backoff up to readAttempts times
+func ReadFileWithRetry(path string) ([]byte, error) {
+	return readWithRetry(path, ReadFile)
+}
+
+// readWithRetry is ReadFileWithRetry reading with read
+func readWithRetry(path string, read func(string) ([]byte, error)) ([]byte, error) {
+	delay := readBackoff
+	for attempt := 1; ; attempt++ {
+		data, err := read(path)
+		if err == nil || attempt >= ReadAttempts || !isTransientError(err) {
+			return data, err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// isTransientError reports whether a read error is worth retrying, such as
+// EAGAIN-like errors or timeouts from network-mounted filesystems
+func isTransientError(err error) bool {
+	if errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EINTR) ||
+		errors.Is(err, syscall.EBUSY) || errors.Is(err, syscall.ETIMEDOUT) {
+		return true
+	}
+	var timeout interface{ Timeout() bool }
+	return errors.As(err, &timeout) && timeout.Timeout()
+}
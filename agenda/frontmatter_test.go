@@ -0,0 +1,382 @@
+package agenda
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestParseStartDate(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected time.Time
+	}{
+		{"2024-01-20", time.Date(2024, 1, 20, 0, 0, 0, 0, time.UTC)},
+		{"2024-01-26", time.Date(2024, 1, 26, 0, 0, 0, 0, time.UTC)},
+		{"2024-01-12", time.Date(2024, 1, 12, 0, 0, 0, 0, time.UTC)},
+		{"2024-01-01", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"2024-01-05", time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)},
+		{"2025-10-18", time.Date(2025, 10, 18, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := parseStartDate(tt.input)
+			if !result.Equal(tt.expected) {
+				t.Errorf("For input %q: expected %v, got %v", tt.input, tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestParseFrontMatter(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		expected    *FrontMatter
+		expectError bool
+	}{
+		{
+			name: "valid_frontmatter",
+			content: `---
+rrule: FREQ=WEEKLY;BYDAY=FR
+duration: P1D
+dtstart: 2024-01-05
+---
+
+# Task content`,
+			expected: &FrontMatter{
+				RRule:    "FREQ=WEEKLY;BYDAY=FR",
+				Duration: "P1D",
+				DTStart:  "2024-01-05",
+				Tags:     nil,
+			},
+			expectError: false,
+		},
+		{
+			name:        "no_frontmatter",
+			content:     "# Regular markdown file",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ParseFrontMatter(tt.content)
+
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error but got none")
+				}
+				if tt.name == "no_frontmatter" && !errors.Is(err, ErrNoFrontMatter) {
+					t.Errorf("Expected ErrNoFrontMatter, got %v", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+				return
+			}
+
+			if result.RRule != tt.expected.RRule {
+				t.Errorf("RRule: expected %q, got %q", tt.expected.RRule, result.RRule)
+			}
+		})
+	}
+}
+
+func TestParseFrontMatter_DashesInContent(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		rrule    string
+		duration string
+		body     string
+	}{
+		{
+			name:     "horizontal_rule_in_body",
+			content:  "---\nrrule: FREQ=DAILY\nduration: P1D\n---\nabove\n---\nbelow\n",
+			rrule:    "FREQ=DAILY",
+			duration: "P1D",
+			body:     "\nabove\n---\nbelow\n",
+		},
+		{
+			name:     "dashes_in_values",
+			content:  "---\nrrule: \"FREQ=DAILY\" # --- daily\nduration: P1D\nnotes: |\n  before\n  ---not a delimiter\n---\nbody\n",
+			rrule:    "FREQ=DAILY",
+			duration: "P1D",
+			body:     "\nbody\n",
+		},
+		{
+			name:     "closing_at_end_of_file",
+			content:  "---\nrrule: FREQ=WEEKLY\n---",
+			rrule:    "FREQ=WEEKLY",
+			duration: "",
+			body:     "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fm, err := ParseFrontMatter(tt.content)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if fm.RRule != tt.rrule || fm.Duration != tt.duration {
+				t.Errorf("Expected rrule %q and duration %q, got %q and %q", tt.rrule, tt.duration, fm.RRule, fm.Duration)
+			}
+			if fm.Body != tt.body {
+				t.Errorf("Expected body %q, got %q", tt.body, fm.Body)
+			}
+		})
+	}
+
+	for _, content := range []string{"---\nrrule: FREQ=DAILY\n", "---\nrrule: FREQ=DAILY\n----\n", "---rrule: FREQ=DAILY\n---\n"} {
+		if _, err := ParseFrontMatter(content); err == nil {
+			t.Errorf("Expected an error for %q", content)
+		}
+	}
+}
+
+func TestParseFrontMatter_YAMLErrorLine(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{"syntax", "---\nrrule: FREQ=DAILY\nduration: P1D\ntitle: a: b\n---\n", "YAML error at line 4: mapping values"},
+		{"type", "---\nrrule: FREQ=DAILY\n\ntags: {a: b}\n---\n", "YAML error at line 4: cannot unmarshal"},
+		{"crlf", "---\r\nrrule: FREQ=DAILY\r\ntitle: a: b\r\n---\r\n", "YAML error at line 3: mapping values"},
+		{"no_line", "---\nrrule: \"\x01\"\n---\n", "YAML error: "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseFrontMatter(tt.content)
+			if err == nil || !strings.HasPrefix(err.Error(), tt.expected) {
+				t.Fatalf("Expected an error starting %q, got %v", tt.expected, err)
+			}
+			if ErrorCategory(err) != ErrYAML {
+				t.Errorf("Expected a YAML error, got %v", ErrorCategory(err))
+			}
+		})
+	}
+}
+
+func TestParseFrontMatter_CRLF(t *testing.T) {
+	fm, err := ParseFrontMatter("---\r\nrrule: FREQ=WEEKLY;BYDAY=FR\r\nduration: P1D\r\ndtstart: 2025-01-01\r\n---\r\n# Task\r\n")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if fm.RRule != "FREQ=WEEKLY;BYDAY=FR" || fm.Duration != "P1D" || fm.DTStart != "2025-01-01" {
+		t.Errorf("Expected clean values, got rrule %q, duration %q, dtstart %q", fm.RRule, fm.Duration, fm.DTStart)
+	}
+	if firstBodyLine(fm.Body) != "# Task" {
+		t.Errorf("Expected body line %q, got %q", "# Task", firstBodyLine(fm.Body))
+	}
+	if _, err := ApplyDefaults(fm, time.Date(2025, 1, 3, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Errorf("CRLF front matter failed to apply defaults: %v", err)
+	}
+}
+
+func TestReadFileWithRetry(t *testing.T) {
+	origReadFile, origBackoff := ReadFile, readBackoff
+	t.Cleanup(func() { ReadFile, readBackoff = origReadFile, origBackoff })
+	readBackoff = 0
+
+	t.Run("transient_error_then_success", func(t *testing.T) {
+		calls := 0
+		ReadFile = func(name string) ([]byte, error) {
+			calls++
+			if calls == 1 {
+				return nil, &fs.PathError{Op: "read", Path: name, Err: syscall.EAGAIN}
+			}
+			return []byte("---\nrrule: FREQ=DAILY\n---\n"), nil
+		}
+
+		fm, err := ReadFrontMatter("task.md")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if fm.RRule != "FREQ=DAILY" {
+			t.Errorf("RRule: expected %q, got %q", "FREQ=DAILY", fm.RRule)
+		}
+		if calls != 2 {
+			t.Errorf("Expected 2 read attempts, got %d", calls)
+		}
+	})
+
+	t.Run("gives_up_after_attempts", func(t *testing.T) {
+		calls := 0
+		ReadFile = func(name string) ([]byte, error) {
+			calls++
+			return nil, &fs.PathError{Op: "read", Path: name, Err: syscall.EAGAIN}
+		}
+
+		if _, err := ReadFrontMatter("task.md"); !errors.Is(err, syscall.EAGAIN) {
+			t.Errorf("Expected EAGAIN error, got %v", err)
+		}
+		if calls != ReadAttempts {
+			t.Errorf("Expected %d read attempts, got %d", ReadAttempts, calls)
+		}
+	})
+
+	t.Run("permanent_error_not_retried", func(t *testing.T) {
+		calls := 0
+		ReadFile = func(name string) ([]byte, error) {
+			calls++
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+		}
+
+		if _, err := ReadFrontMatter("task.md"); err == nil {
+			t.Errorf("Expected error but got none")
+		}
+		if calls != 1 {
+			t.Errorf("Expected 1 read attempt, got %d", calls)
+		}
+	})
+}
+
+func TestParseStartDate_Coarse(t *testing.T) {
+	fallback := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		input    string
+		expected time.Time
+	}{
+		{"2025", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"2025-03", time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if !isCoarseDate(tt.input) {
+				t.Errorf("Expected %q to be a coarse date", tt.input)
+			}
+			if got := ParseStartDate(tt.input, fallback); !got.Equal(tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+
+	if isCoarseDate("2025-03-04") {
+		t.Errorf("Expected a full date not to be coarse")
+	}
+}
+
+func TestParseFrontMatter_Snippet(t *testing.T) {
+	fm, err := ParseFrontMatter("---\nrrule: FREQ=DAILY\n---\n\n  \n# Water the plants\nSecond line\n")
+	if err != nil {
+		t.Fatalf("ParseFrontMatter failed: %v", err)
+	}
+	if got := firstBodyLine(fm.Body); got != "# Water the plants" {
+		t.Errorf("Expected first body line, got %q", got)
+	}
+
+	fm, err = ParseFrontMatter("---\nrrule: FREQ=DAILY\n---\n")
+	if err != nil {
+		t.Fatalf("ParseFrontMatter failed: %v", err)
+	}
+	if got := firstBodyLine(fm.Body); got != "" {
+		t.Errorf("Expected no snippet for an empty body, got %q", got)
+	}
+}
+
+func TestParseFrontMatter_EmbeddedDTStart(t *testing.T) {
+	tests := []struct {
+		name         string
+		content      string
+		rrule        string
+		dtstart      string
+		wantWarnings int
+	}{
+		{
+			"wrapped",
+			"---\nrrule: FREQ=DAILY\ndtstart: 2025-01-01\n---",
+			"FREQ=DAILY", "2025-01-01", 0,
+		},
+		{
+			"embedded",
+			"---\nrrule: \"DTSTART:20250101T000000Z\\nRRULE:FREQ=DAILY\"\n---",
+			"FREQ=DAILY", "20250101T000000Z", 0,
+		},
+		{
+			"embedded_block_scalar",
+			"---\nrrule: |\n  DTSTART;TZID=Europe/Berlin:20250101T090000\n  RRULE:FREQ=WEEKLY\n---",
+			"FREQ=WEEKLY", "20250101T090000", 0,
+		},
+		{
+			"embedded_exdate",
+			"---\nrrule: \"DTSTART:20250101T000000Z\\nRRULE:FREQ=DAILY\\nEXDATE:20250102T000000Z\"\n---",
+			"FREQ=DAILY", "20250101T000000Z", 0,
+		},
+		{
+			"embedded_rdate_ignored",
+			"---\nrrule: \"DTSTART:20250101T000000Z\\nRRULE:FREQ=DAILY\\nRDATE:20250102T120000Z\"\n---",
+			"FREQ=DAILY", "20250101T000000Z", 1,
+		},
+		{
+			"embedded_conflicts_with_dtstart",
+			"---\nrrule: \"DTSTART:20250101T000000Z\\nRRULE:FREQ=DAILY\"\ndtstart: 2024-06-01\n---",
+			"FREQ=DAILY", "20250101T000000Z", 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fm, err := ParseFrontMatter(tt.content)
+			if err != nil {
+				t.Fatalf("ParseFrontMatter failed: %v", err)
+			}
+			if fm.RRule != tt.rrule || fm.DTStart != tt.dtstart {
+				t.Errorf("Expected rrule %q dtstart %q, got %q %q", tt.rrule, tt.dtstart, fm.RRule, fm.DTStart)
+			}
+			if len(fm.Warnings) != tt.wantWarnings {
+				t.Errorf("Expected %d warnings, got %v", tt.wantWarnings, fm.Warnings)
+			}
+
+			currentTime := time.Date(2025, 9, 26, 12, 0, 0, 0, time.UTC)
+			fmWithDefaults, err := ApplyDefaults(fm, currentTime)
+			if err != nil {
+				t.Fatalf("ApplyDefaults failed: %v", err)
+			}
+			if !fmWithDefaults.DTStart.Equal(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)) {
+				t.Errorf("Expected dtstart 2025-01-01, got %v", fmWithDefaults.DTStart)
+			}
+			if _, err := IsTaskActive(fmWithDefaults, currentTime); err != nil {
+				t.Errorf("IsTaskActive failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestParseFrontMatter_EmbeddedExDate(t *testing.T) {
+	content := "---\nrrule: |\n  DTSTART;TZID=Europe/Kyiv:20250301T090000\n  RRULE:FREQ=DAILY\n  EXDATE;TZID=Europe/Kyiv:20250303T090000,20250304T090000\n  EXRULE:FREQ=WEEKLY;BYDAY=SU\nduration: PT1H\n---\n"
+	fm, err := ParseFrontMatter(content)
+	if err != nil {
+		t.Fatalf("ParseFrontMatter failed: %v", err)
+	}
+	if fm.RRule != "FREQ=DAILY" || fm.ExRule != "FREQ=WEEKLY;BYDAY=SU" || len(fm.ExDate) != 2 || len(fm.Warnings) != 0 {
+		t.Fatalf("Expected the pasted lines split into fields, got %+v", fm)
+	}
+
+	kyiv, err := time.LoadLocation("Europe/Kyiv")
+	if err != nil {
+		t.Skip("Europe/Kyiv zone not available")
+	}
+	fmWithDefaults, err := ApplyDefaults(fm, time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("ApplyDefaults failed: %v", err)
+	}
+	for _, tt := range []struct {
+		day      int
+		expected bool
+	}{{1, true}, {2, false}, {3, false}, {4, false}, {5, true}} {
+		at := time.Date(2025, 3, tt.day, 9, 30, 0, 0, kyiv)
+		if active, err := IsTaskActive(fmWithDefaults, at); err != nil || active != tt.expected {
+			t.Errorf("March %d: expected active %v, got %v (err %v)", tt.day, tt.expected, active, err)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package agenda
+
+import (
+	"regexp"
+	"strings"
+)
+
+// estimatePattern matches a body line giving a time estimate: "est:" followed
+// by one or more amounts in days, hours or minutes, e.g. "est: 1h30m". The
+// line may be a list item. Matching is case-insensitive.
+var estimatePattern = regexp.MustCompile(`(?i)^(?:[-*+]\s+)?est:\s*((?:\d+\s*[dhm]\s*)+)$`)
+
+// estimateHint returns the first time estimate in a note body, normalized to
+// lowercase without spaces ("3h", "1h30m"), or "" if there is none
+func estimateHint(body string) string {
+	for line := range strings.Lines(body) {
+		match := estimatePattern.FindStringSubmatch(strings.TrimSpace(line))
+		if match != nil {
+			return strings.ToLower(strings.Join(strings.Fields(match[1]), ""))
+		}
+	}
+	return ""
+}
@@ -0,0 +1,37 @@
+package agenda
+
+import (
+	"testing"
+)
+
+func TestEstimateHint(t *testing.T) {
+	tests := []struct {
+		body     string
+		expected string
+	}{
+		{"est: 3h\n", "3h"},
+		{"Some notes\n\n- EST: 1h 30m\n", "1h30m"},
+		{"* est:2d\nest: 4h\n", "2d"},
+		{"est: soon\n", ""},
+		{"the est: 3h is a guess\n", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := estimateHint(tt.body); got != tt.expected {
+			t.Errorf("%q: expected %q, got %q", tt.body, tt.expected, got)
+		}
+	}
+}
+
+func TestProcessFileEstimate(t *testing.T) {
+	dir := t.TempDir()
+	withoutDuration := writeNote(t, dir, "Tidy.md", "---\nrrule: FREQ=WEEKLY;BYDAY=SA\n---\nest: 2h\n")
+	withDuration := writeNote(t, dir, "Report.md", "---\nrrule: FREQ=WEEKLY;BYDAY=SA\nduration: P1D\n---\nest: 2h\n")
+
+	if task, _ := processFile(withoutDuration, Clock(), ReadFile); task.Estimate != "2h" {
+		t.Errorf("Expected estimate 2h, got %q", task.Estimate)
+	}
+	if task, _ := processFile(withDuration, Clock(), ReadFile); task.Estimate != "" {
+		t.Errorf("Expected notes with a duration to ignore hints, got %q", task.Estimate)
+	}
+}
@@ -0,0 +1,72 @@
+package agenda
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ruleParts splits a rule into its NAME=VALUE parts, uppercased. A pasted
+// DTSTART line is dropped.
+func ruleParts(rule string) map[string]string {
+	if _, _, rest, ok := SplitEmbeddedDTStart(rule); ok {
+		rule = rest
+	}
+	parts := map[string]string{}
+	for part := range strings.SplitSeq(NormalizeRRule(rule), ";") {
+		if name, value, found := strings.Cut(part, "="); found {
+			parts[name] = value
+		}
+	}
+	return parts
+}
+
+// plainWeekdays returns the BYDAY entries without an ordinal, such as FR in
+// BYDAY=FR,1MO
+func plainWeekdays(byDay string) []string {
+	var days []string
+	for day := range strings.SplitSeq(byDay, ",") {
+		if len(day) == 2 {
+			days = append(days, day)
+		}
+	}
+	return days
+}
+
+// LintRRule flags valid but likely unintended combinations in a rule, such
+// as FREQ=MONTHLY;BYDAY=FR, which matches every Friday of the month rather
+// than one. It only looks at the rule text; whether the rule parses is left
+// to NewRecurrence.
+func LintRRule(rule string) []string {
+	parts := ruleParts(rule)
+	freq := parts["FREQ"]
+	var warnings []string
+
+	if days := plainWeekdays(parts["BYDAY"]); len(days) > 0 && parts["BYSETPOS"] == "" {
+		weekdays := strings.Join(days, ",")
+		switch {
+		case freq == "MONTHLY" && parts["BYMONTHDAY"] == "":
+			warnings = append(warnings, fmt.Sprintf("FREQ=MONTHLY;BYDAY=%s matches every %s of the month; use BYDAY=1%s or BYSETPOS for one a month", weekdays, weekdays, days[0]))
+		case freq == "YEARLY" && parts["BYMONTH"] == "" && parts["BYWEEKNO"] == "" && parts["BYYEARDAY"] == "" && parts["BYMONTHDAY"] == "":
+			warnings = append(warnings, fmt.Sprintf("FREQ=YEARLY;BYDAY=%s matches every %s of the year; add BYMONTH or use BYDAY=1%s", weekdays, weekdays, days[0]))
+		}
+	}
+
+	for value := range strings.SplitSeq(parts["BYMONTHDAY"], ",") {
+		day, err := strconv.Atoi(value)
+		switch {
+		case err != nil:
+		case day == 0 || day > 31 || day < -31:
+			warnings = append(warnings, fmt.Sprintf("BYMONTHDAY=%d never occurs; days run from 1 to 31, or -1 to -31 from the end", day))
+		case freq == "MONTHLY" && day > 28:
+			warnings = append(warnings, fmt.Sprintf("BYMONTHDAY=%d skips months shorter than %d days; use BYMONTHDAY=-1 for the last day", day, day))
+		}
+	}
+
+	for value := range strings.SplitSeq(parts["BYMONTH"], ",") {
+		if month, err := strconv.Atoi(value); err == nil && (month < 1 || month > 12) {
+			warnings = append(warnings, fmt.Sprintf("BYMONTH=%d never occurs; months run from 1 to 12", month))
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,41 @@
+package agenda
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLintRRule(t *testing.T) {
+	tests := []struct {
+		rule     string
+		expected []string // substrings, one per warning
+	}{
+		{"FREQ=MONTHLY;BYDAY=FR", []string{"every FR of the month"}},
+		{"freq=monthly;byday=mo,fr", []string{"every MO,FR of the month"}},
+		{"FREQ=MONTHLY;BYDAY=1FR", nil},
+		{"FREQ=MONTHLY;BYDAY=FR;BYSETPOS=-1", nil},
+		{"FREQ=MONTHLY;BYDAY=FR;BYMONTHDAY=13", nil},
+		{"FREQ=WEEKLY;BYDAY=FR", nil},
+		{"FREQ=YEARLY;BYDAY=MO", []string{"every MO of the year"}},
+		{"FREQ=YEARLY;BYMONTH=11;BYDAY=TH", nil},
+		{"FREQ=MONTHLY;BYMONTHDAY=32", []string{"BYMONTHDAY=32 never occurs"}},
+		{"FREQ=MONTHLY;BYMONTHDAY=31", []string{"skips months shorter than 31 days"}},
+		{"FREQ=YEARLY;BYMONTH=1;BYMONTHDAY=31", nil},
+		{"FREQ=MONTHLY;BYMONTHDAY=-1", nil},
+		{"FREQ=YEARLY;BYMONTH=13", []string{"BYMONTH=13 never occurs"}},
+		{"DTSTART:20250101T000000Z\nRRULE:FREQ=MONTHLY;BYDAY=FR", []string{"every FR of the month"}},
+		{"FREQ=DAILY", nil},
+	}
+	for _, tt := range tests {
+		warnings := LintRRule(tt.rule)
+		if len(warnings) != len(tt.expected) {
+			t.Errorf("%q: expected %d warnings, got %q", tt.rule, len(tt.expected), warnings)
+			continue
+		}
+		for i, want := range tt.expected {
+			if !strings.Contains(warnings[i], want) {
+				t.Errorf("%q: expected a warning containing %q, got %q", tt.rule, want, warnings[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package agenda
+
+import (
+	"fmt"
+	"os"
+)
+
+// Debugf receives diagnostic notes about a scan, such as skipped folders
+// and expanded dates. It discards them unless replaced, as the CLI does
+// for --verbose.
+var Debugf = func(format string, args ...any) {}
+
+// Warnf reports non-fatal problems in a note, by default on stderr
+var Warnf = func(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "Warning: "+format+"\n", args...)
+}
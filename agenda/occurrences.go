@@ -0,0 +1,201 @@
+package agenda
+
+import (
+	"time"
+)
+
+// Occurrence is the active window of one occurrence of a task
+type Occurrence struct {
+	Start  time.Time
+	End    time.Time // exclusive
+	Active bool      // whether now falls within [Start, End)
+}
+
+// Stage is how far into its active window a task is: on step Current of
+// Total, counted in days, or in hours for sub-day windows
+type Stage struct {
+	Current int
+	Total   int
+	Hours   bool
+}
+
+// Stage returns which day of the window now falls on, or which hour for
+// windows that aren't whole days. Times outside the window are clamped to
+// its first or last step.
+func (o Occurrence) Stage(now time.Time) Stage {
+	if span := o.End.Sub(o.Start); isIntraday(span) {
+		total := int((span + time.Hour - 1) / time.Hour)
+		current := int(now.Sub(o.Start)/time.Hour) + 1
+		return Stage{Current: min(max(current, 1), total), Total: total, Hours: true}
+	}
+	first := DayOf(o.Start)
+	total := int(lastDay(o.End).Sub(first)/(24*time.Hour)) + 1
+	current := int(DayOf(now).Sub(first)/(24*time.Hour)) + 1
+	return Stage{Current: min(max(current, 1), total), Total: total}
+}
+
+// ElapsedPercent returns how far through the window now is, from 0 to 100
+func (o Occurrence) ElapsedPercent(now time.Time) int {
+	fraction := float64(now.Sub(o.Start)) / float64(o.End.Sub(o.Start))
+	return int(min(max(fraction, 0), 1) * 100)
+}
+
+// DueDate returns the last day of the window
+func (o Occurrence) DueDate() time.Time {
+	return lastDay(o.End)
+}
+
+// Occurrences returns the windows of a task's occurrences that start between
+// from and to, inclusive, marking the ones active at now. Whole-day windows
+// start at midnight and are compared with now's day; sub-day windows are
+// compared with now itself. A one-time event has at most one occurrence.
+func Occurrences(fm *FrontMatterWithDefaults, from, to, now time.Time) ([]Occurrence, error) {
+	reference := now.Truncate(24 * time.Hour)
+	if fm.Duration.Intraday() {
+		reference = now
+	}
+	window := func(start, end time.Time) Occurrence {
+		return Occurrence{Start: start, End: end, Active: !reference.Before(start) && reference.Before(end)}
+	}
+
+	if fm.RRule == "" {
+		if fm.DTStart.IsZero() {
+			return nil, nil
+		}
+		start, end := OneTimeWindow(fm.DTStart, fm.Duration, fm.Countdown, fm.BusinessDays)
+		if start.Before(from) || start.After(to) {
+			return nil, nil
+		}
+		return []Occurrence{window(start, end)}, nil
+	}
+
+	r, err := NewRecurrence(fm.RRule, fm.ExRule, fm.ExDates, fm.DTStart)
+	if err != nil {
+		return nil, err
+	}
+
+	instants, err := r.Between(from, to, true)
+	if err != nil {
+		return nil, err
+	}
+	var occurrences []Occurrence
+	for _, occurrence := range instants {
+		start := occurrence
+		if !fm.Duration.Intraday() {
+			start = occurrence.Truncate(24 * time.Hour)
+		}
+		occurrences = append(occurrences, window(start, WindowEnd(start, fm.Duration, fm.BusinessDays)))
+	}
+	return occurrences, nil
+}
+
+// UpcomingOccurrences returns the windows of the next n occurrences that
+// start after now. A one-time event has at most one.
+func UpcomingOccurrences(fm *FrontMatterWithDefaults, now time.Time, n int) ([]Occurrence, error) {
+	if fm.RRule == "" {
+		return Occurrences(fm, now.Add(time.Nanosecond), time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC), now)
+	}
+
+	r, err := NewRecurrence(fm.RRule, fm.ExRule, fm.ExDates, fm.DTStart)
+	if err != nil {
+		return nil, err
+	}
+	var occurrences []Occurrence
+	for next := now; len(occurrences) < n; {
+		if next, err = r.After(next, false); err != nil {
+			return nil, err
+		}
+		if next.IsZero() {
+			break
+		}
+		start := next
+		if !fm.Duration.Intraday() {
+			start = next.Truncate(24 * time.Hour)
+		}
+		occurrences = append(occurrences, Occurrence{Start: start, End: WindowEnd(start, fm.Duration, fm.BusinessDays)})
+	}
+	return occurrences, nil
+}
+
+// activeSearchRange bounds the occurrences that can be active at now: those
+// starting from dtstart up to the end of now's day. Sub-day windows only
+// need to look back one duration, plus an hour for DST changes.
+func activeSearchRange(fm *FrontMatterWithDefaults, now time.Time) (time.Time, time.Time) {
+	if fm.Duration.Intraday() {
+		return windowStart(now, fm.Duration, false).Add(-time.Hour), now
+	}
+	return fm.DTStart, now.Truncate(24 * time.Hour).Add(24 * time.Hour)
+}
+
+// ActiveOccurrence returns the start and exclusive end of the occurrence
+// whose window contains now. Activity, due dates and progress all come from
+// it, so they always agree. ok is false when no window is active; err
+// reports why a rule can't be evaluated, such as hitting the occurrence cap.
+func ActiveOccurrence(fm *FrontMatterWithDefaults, now time.Time) (start, end *time.Time, ok bool, err error) {
+	occurrence, ok, err := activeOccurrence(fm, now)
+	if err != nil || !ok {
+		return nil, nil, false, err
+	}
+	return &occurrence.Start, &occurrence.End, true, nil
+}
+
+// CurrentActiveWindow is ActiveOccurrence for callers that only need the
+// window. Rules that fail to parse have no active window.
+func CurrentActiveWindow(fm *FrontMatterWithDefaults, now time.Time) (start, end time.Time, ok bool) {
+	startPtr, endPtr, ok, err := ActiveOccurrence(fm, now)
+	if err != nil || !ok {
+		return time.Time{}, time.Time{}, false
+	}
+	return *startPtr, *endPtr, true
+}
+
+// activeOccurrence is ActiveOccurrence returning the whole Occurrence
+func activeOccurrence(fm *FrontMatterWithDefaults, now time.Time) (Occurrence, bool, error) {
+	from, to := activeSearchRange(fm, now)
+	if fm.RRule == "" {
+		// A countdown window starts before dtstart
+		from, to = time.Time{}, fm.DTStart
+	}
+	occurrences, err := Occurrences(fm, from, to, now)
+	if err != nil {
+		return Occurrence{}, false, err
+	}
+	for _, occurrence := range occurrences {
+		if occurrence.Active {
+			return occurrence, true, nil
+		}
+	}
+	return Occurrence{}, false, nil
+}
+
+// CurrentDueDate returns the last day of the window active at now, or nil
+// when the task is not active
+func CurrentDueDate(fm *FrontMatterWithDefaults, now time.Time) *time.Time {
+	_, end, ok, err := ActiveOccurrence(fm, now)
+	if err != nil || !ok {
+		return nil
+	}
+	dueDate := lastDay(*end)
+	return &dueDate
+}
+
+// ElapsedPercent returns how far through its active window a task is at
+// now, from 0 to 100. ok is false when no window is active.
+func ElapsedPercent(fm *FrontMatterWithDefaults, now time.Time) (percent int, ok bool) {
+	occurrence, ok, err := activeOccurrence(fm, now)
+	if err != nil || !ok {
+		return 0, false
+	}
+	return occurrence.ElapsedPercent(now), true
+}
+
+// lastDay returns the day containing the final instant before an exclusive end
+func lastDay(end time.Time) time.Time {
+	return DayOf(end.Add(-time.Nanosecond))
+}
+
+// DayOf returns t's calendar date in its own zone as midnight UTC, the form
+// dates take throughout. For UTC times it is t truncated to the day.
+func DayOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
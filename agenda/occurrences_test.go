@@ -0,0 +1,245 @@
+package agenda
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOccurrences(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2025, 3, d, 0, 0, 0, 0, time.UTC) }
+	at := func(d, h int) time.Time { return time.Date(2025, 3, d, h, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name     string
+		fm       FrontMatterWithDefaults
+		from, to time.Time
+		now      time.Time
+		expected []Occurrence
+	}{
+		{
+			name:     "daily single day",
+			fm:       FrontMatterWithDefaults{RRule: "FREQ=DAILY", Duration: CalendarDuration{Duration: 24 * time.Hour}, DTStart: day(1)},
+			from:     day(3),
+			to:       day(5),
+			now:      at(4, 15),
+			expected: []Occurrence{{day(3), day(4), false}, {day(4), day(5), true}, {day(5), day(6), false}},
+		},
+		{
+			name:     "weekly overlapping windows",
+			fm:       FrontMatterWithDefaults{RRule: "FREQ=WEEKLY;BYDAY=MO", Duration: CalendarDuration{Duration: 10 * 24 * time.Hour}, DTStart: day(3)},
+			from:     day(3),
+			to:       day(12),
+			now:      at(11, 8),
+			expected: []Occurrence{{day(3), day(13), true}, {day(10), day(20), true}},
+		},
+		{
+			name:     "business days skip the weekend",
+			fm:       FrontMatterWithDefaults{RRule: "FREQ=WEEKLY;BYDAY=FR", Duration: CalendarDuration{Duration: 2 * 24 * time.Hour}, DTStart: day(7), BusinessDays: true},
+			from:     day(7),
+			to:       day(7),
+			now:      at(9, 12),
+			expected: []Occurrence{{day(7), day(11), true}},
+		},
+		{
+			name:     "intraday compares the time of day",
+			fm:       FrontMatterWithDefaults{RRule: "FREQ=DAILY", Duration: CalendarDuration{Duration: 4 * time.Hour}, DTStart: at(1, 22)},
+			from:     at(3, 0),
+			to:       at(4, 23),
+			now:      at(4, 1),
+			expected: []Occurrence{{at(3, 22), at(4, 2), true}, {at(4, 22), at(5, 2), false}},
+		},
+		{
+			name:     "exrule removes occurrences",
+			fm:       FrontMatterWithDefaults{RRule: "FREQ=DAILY", ExRule: "FREQ=WEEKLY;BYDAY=SA,SU", Duration: CalendarDuration{Duration: 24 * time.Hour}, DTStart: day(7)},
+			from:     day(7),
+			to:       day(10),
+			now:      at(8, 9),
+			expected: []Occurrence{{day(7), day(8), false}, {day(10), day(11), false}},
+		},
+		{
+			name:     "one-time event in range",
+			fm:       FrontMatterWithDefaults{Duration: CalendarDuration{Duration: 3 * 24 * time.Hour}, DTStart: day(10)},
+			from:     day(1),
+			to:       day(31),
+			now:      at(12, 0),
+			expected: []Occurrence{{day(10), day(13), true}},
+		},
+		{
+			name:     "one-time countdown runs up to dtstart",
+			fm:       FrontMatterWithDefaults{Duration: CalendarDuration{Duration: 3 * 24 * time.Hour}, DTStart: day(10), Countdown: true},
+			from:     day(1),
+			to:       day(31),
+			now:      at(9, 0),
+			expected: []Occurrence{{day(7), day(10), true}},
+		},
+		{
+			name: "one-time event out of range",
+			fm:   FrontMatterWithDefaults{Duration: CalendarDuration{Duration: 24 * time.Hour}, DTStart: day(10)},
+			from: day(11),
+			to:   day(31),
+			now:  at(10, 0),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Occurrences(&tt.fm, tt.from, tt.to, tt.now)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(got) != len(tt.expected) {
+				t.Fatalf("expected %d occurrences, got %v", len(tt.expected), got)
+			}
+			for i := range got {
+				if !got[i].Start.Equal(tt.expected[i].Start) || !got[i].End.Equal(tt.expected[i].End) || got[i].Active != tt.expected[i].Active {
+					t.Errorf("occurrence %d: expected %+v, got %+v", i, tt.expected[i], got[i])
+				}
+			}
+		})
+	}
+}
+
+func TestOccurrencesInvalidRRule(t *testing.T) {
+	fm := &FrontMatterWithDefaults{RRule: "FREQ=SOMETIMES", Duration: CalendarDuration{Duration: 24 * time.Hour}}
+	now := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := Occurrences(fm, now.AddDate(0, -1, 0), now, now); err == nil {
+		t.Error("expected an error for an invalid rrule")
+	}
+}
+
+func TestOccurrenceDueDate(t *testing.T) {
+	tests := []struct {
+		occurrence Occurrence
+		expected   time.Time
+	}{
+		{Occurrence{End: time.Date(2025, 3, 4, 0, 0, 0, 0, time.UTC)}, time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC)},
+		{Occurrence{End: time.Date(2025, 3, 4, 2, 0, 0, 0, time.UTC)}, time.Date(2025, 3, 4, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		if got := tt.occurrence.DueDate(); !got.Equal(tt.expected) {
+			t.Errorf("end %v: expected due %v, got %v", tt.occurrence.End, tt.expected, got)
+		}
+	}
+}
+
+func TestActiveOccurrence(t *testing.T) {
+	fm := &FrontMatterWithDefaults{
+		RRule:    "FREQ=WEEKLY;BYDAY=MO",
+		DTStart:  time.Date(2025, 1, 6, 0, 0, 0, 0, time.UTC),
+		Duration: dayDuration(2),
+	}
+	monday := time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC)
+
+	start, end, ok, err := ActiveOccurrence(fm, monday.Add(30*time.Hour))
+	if err != nil || !ok {
+		t.Fatalf("Expected an active occurrence on Tuesday, got ok=%v err=%v", ok, err)
+	}
+	if !start.Equal(monday) || !end.Equal(monday.AddDate(0, 0, 2)) {
+		t.Errorf("Expected [2025-12-01, 2025-12-03), got [%v, %v)", start, end)
+	}
+	if due := CurrentDueDate(fm, monday.Add(30*time.Hour)); due == nil || !due.Equal(monday.AddDate(0, 0, 1)) {
+		t.Errorf("Expected the due date to be the window's last day, got %v", due)
+	}
+
+	start, end, ok, err = ActiveOccurrence(fm, monday.AddDate(0, 0, 3))
+	if err != nil || ok || start != nil || end != nil {
+		t.Errorf("Expected no occurrence on Thursday, got [%v, %v) ok=%v err=%v", start, end, ok, err)
+	}
+
+	fm.RRule = "FREQ=SOMETIMES"
+	if _, _, ok, err := ActiveOccurrence(fm, monday); err == nil || ok {
+		t.Errorf("Expected an error for an invalid rule, got ok=%v err=%v", ok, err)
+	}
+}
+
+func TestActiveTasksHaveDueDate(t *testing.T) {
+	rules := []FrontMatter{
+		{RRule: "FREQ=DAILY", Duration: "P1D"},
+		{RRule: "FREQ=DAILY;INTERVAL=3", Duration: "P2D"},
+		{RRule: "FREQ=WEEKLY;BYDAY=MO", Duration: "P3D"},
+		{RRule: "FREQ=WEEKLY;BYDAY=MO,WE,FR", Duration: "P10D"},
+		{RRule: "FREQ=WEEKLY;BYDAY=FR", Duration: "P2BD"},
+		{RRule: "FREQ=MONTHLY;BYMONTHDAY=1", Duration: "P3D"},
+		{RRule: "FREQ=MONTHLY;BYMONTHDAY=-5", Duration: "P5D"},
+		{RRule: "FREQ=YEARLY;BYMONTH=3;BYMONTHDAY=10", Duration: "P1M"},
+		{RRule: "FREQ=DAILY", ExRule: "FREQ=WEEKLY;BYDAY=SA,SU", Duration: "P1D"},
+		{RRule: "FREQ=DAILY;COUNT=5", DTStart: "2025-03-01", Duration: "P1D"},
+		{RRule: "FREQ=DAILY", DTStart: "2025-03-01T22:00:00", Duration: "PT4H"},
+		{RRule: "FREQ=WEEKLY;BYDAY=TU", DTStart: "2025-03-04T09:00:00", Duration: "PT90M"},
+	}
+	start := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, fm := range rules {
+		for hour := 0; hour < 60*24; hour += 5 {
+			now := start.Add(time.Duration(hour) * time.Hour)
+			fmWithDefaults, err := ApplyDefaults(&fm, now)
+			if err != nil {
+				t.Fatalf("%s: %v", fm.RRule, err)
+			}
+			active, err := IsTaskActive(fmWithDefaults, now)
+			if err != nil {
+				t.Fatalf("%s: %v", fm.RRule, err)
+			}
+			due := CurrentDueDate(fmWithDefaults, now)
+			if active != (due != nil) {
+				t.Errorf("%s %s at %v: active %v but due date %v", fm.RRule, fm.Duration, now, active, due)
+			}
+			if due != nil && due.Before(now.Truncate(24*time.Hour)) {
+				t.Errorf("%s %s at %v: due date %v is in the past", fm.RRule, fm.Duration, now, due)
+			}
+		}
+	}
+}
+
+func TestOccurrenceStage(t *testing.T) {
+	day := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	tenDays := Occurrence{Start: day, End: day.AddDate(0, 0, 10)}
+	fourHours := Occurrence{Start: day.Add(9 * time.Hour), End: day.Add(13 * time.Hour)}
+
+	tests := []struct {
+		name       string
+		occurrence Occurrence
+		now        time.Time
+		expected   Stage
+	}{
+		{"first day", tenDays, day.Add(8 * time.Hour), Stage{Current: 1, Total: 10}},
+		{"seventh day", tenDays, day.AddDate(0, 0, 6).Add(23 * time.Hour), Stage{Current: 7, Total: 10}},
+		{"last day", tenDays, day.AddDate(0, 0, 9), Stage{Current: 10, Total: 10}},
+		{"before the window", tenDays, day.AddDate(0, 0, -1), Stage{Current: 1, Total: 10}},
+		{"first hour", fourHours, day.Add(9 * time.Hour), Stage{Current: 1, Total: 4, Hours: true}},
+		{"second hour", fourHours, day.Add(10*time.Hour + 30*time.Minute), Stage{Current: 2, Total: 4, Hours: true}},
+		{"partial hour", Occurrence{Start: day, End: day.Add(90 * time.Minute)}, day.Add(80 * time.Minute), Stage{Current: 2, Total: 2, Hours: true}},
+	}
+	for _, tt := range tests {
+		if got := tt.occurrence.Stage(tt.now); got != tt.expected {
+			t.Errorf("%s: expected %+v, got %+v", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestElapsedPercent(t *testing.T) {
+	start := time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC) // Monday
+	weekly := &FrontMatterWithDefaults{RRule: "FREQ=WEEKLY;BYDAY=MO", Duration: CalendarDuration{Duration: 4 * 24 * time.Hour}, DTStart: start}
+	once := &FrontMatterWithDefaults{Duration: CalendarDuration{Duration: 10 * time.Hour}, DTStart: start.Add(8 * time.Hour)}
+
+	tests := []struct {
+		name     string
+		fm       *FrontMatterWithDefaults
+		now      time.Time
+		expected int
+		ok       bool
+	}{
+		{"start of window", weekly, start, 0, true},
+		{"middle of window", weekly, start.Add(48 * time.Hour), 50, true},
+		{"near the end", weekly, start.Add(96*time.Hour - time.Minute), 99, true},
+		{"next week's window", weekly, start.AddDate(0, 0, 7).Add(24 * time.Hour), 25, true},
+		{"inactive", weekly, start.Add(5 * 24 * time.Hour), 0, false},
+		{"one-time sub-day window", once, start.Add(13 * time.Hour), 50, true},
+	}
+	for _, tt := range tests {
+		got, ok := ElapsedPercent(tt.fm, tt.now)
+		if got != tt.expected || ok != tt.ok {
+			t.Errorf("%s: expected %d%% (ok %v), got %d%% (ok %v)", tt.name, tt.expected, tt.ok, got, ok)
+		}
+	}
+}
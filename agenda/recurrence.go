@@ -0,0 +1,254 @@
+package agenda
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/teambition/rrule-go"
+)
+
+// WeekStart is the WKST injected into rules that don't set one explicitly.
+// Empty keeps the RFC 5545 default of Monday.
+var WeekStart = ""
+
+// NormalizeRRule uppercases rule names and values, which RFC 5545 defines as
+// case-insensitive, so that "freq=weekly;byday=fr" is accepted
+func NormalizeRRule(rule string) string {
+	rule = strings.ToUpper(strings.TrimSpace(rule))
+	return strings.TrimPrefix(rule, "RRULE:")
+}
+
+// ParseWeekStart validates a week_start config value such as MO or su
+func ParseWeekStart(value string) (string, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	switch value {
+	case "MO", "TU", "WE", "TH", "FR", "SA", "SU":
+		return value, nil
+	}
+	return "", fmt.Errorf("invalid week_start %q: must be a weekday such as MO or SU", value)
+}
+
+// newRRule builds a single recurrence rule anchored at the given start date
+func newRRule(rule string, startDate time.Time) (*rrule.RRule, error) {
+	rule = NormalizeRRule(rule)
+	if WeekStart != "" && !strings.Contains(rule, "WKST=") {
+		rule += ";WKST=" + WeekStart
+	}
+	opt, err := rrule.StrToROption(rule)
+	if err != nil {
+		return nil, err
+	}
+	// Anchor in startDate's own location so occurrences keep their wall-clock
+	// time across DST changes
+	opt.Dtstart = startDate
+	return rrule.NewRRule(*opt)
+}
+
+// NewRecurrence builds the task's recurrence from its rrule, optional exrule
+// and excluded instants, anchored at the given start date. It is the one
+// place rules are parsed, so a bad rule always fails as errBadRRule naming
+// the rule.
+func NewRecurrence(rule, exRule string, exDates []time.Time, startDate time.Time) (*Recurrence, error) {
+	r, err := newRRule(rule, startDate)
+	if err != nil {
+		return nil, Categorize(ErrBadRRule, fmt.Errorf("invalid rrule %q: %w", rule, err))
+	}
+	rec := &Recurrence{rule: r, exDates: exDates}
+	if strings.TrimSpace(exRule) != "" {
+		if rec.exRule, err = newRRule(exRule, startDate); err != nil {
+			return nil, Categorize(ErrBadRRule, fmt.Errorf("invalid exrule %q: %w", exRule, err))
+		}
+	}
+	return rec, nil
+}
+
+// Recurrence is an rrule set minus the instants matched by an optional
+// EXRULE. rrule-go's Set has no EXRULE support, so exclusions are filtered here.
+type Recurrence struct {
+	rule    *rrule.RRule
+	exDates []time.Time
+	exRule  *rrule.RRule
+}
+
+// maxExcludedSkips bounds After when an exrule swallows every occurrence
+const maxExcludedSkips = 10000
+
+// MaxOccurrences caps the instants within one query's range that it may
+// step through, so a dense unbounded rule such as FREQ=SECONDLY fails
+// instead of hanging
+var MaxOccurrences = 100000
+
+// skippedOccurrencesFactor bounds the instants before a query's range that
+// it may step over, as a multiple of MaxOccurrences. Sub-day rules in UTC
+// skip ahead instead (see reanchor), so only dense zoned rules get near it.
+const skippedOccurrencesFactor = 100
+
+// errOccurrenceCap is returned when a query steps through more than
+// MaxOccurrences instants
+var errOccurrenceCap = errors.New("occurrence cap exceeded")
+
+// occurrenceCapError reports a query that stepped through too many instants
+func occurrenceCapError() error {
+	return Categorize(ErrBadRRule, fmt.Errorf("%w: stepped through more than %d occurrences (raise max_occurrences if the rule is that dense)", errOccurrenceCap, MaxOccurrences))
+}
+
+// walkOccurrences calls yield with each instant of next from from on, in
+// order, until it returns false or the instants run out. Only the instants
+// yielded count towards MaxOccurrences; earlier ones are stepped over up to
+// skippedOccurrencesFactor times that.
+func walkOccurrences(next func() (time.Time, bool), from time.Time, yield func(t time.Time) bool) error {
+	skipped, yielded := 0, 0
+	for {
+		t, ok := next()
+		if !ok {
+			return nil
+		}
+		if t.Before(from) {
+			if skipped++; skipped > skippedOccurrencesFactor*MaxOccurrences {
+				return occurrenceCapError()
+			}
+			continue
+		}
+		if yielded >= MaxOccurrences {
+			return occurrenceCapError()
+		}
+		yielded++
+		if !yield(t) {
+			return nil
+		}
+	}
+}
+
+// between returns the instants of next between after and before, like
+// rrule-go's Between but capped
+func between(next func() (time.Time, bool), after, before time.Time, inc bool) ([]time.Time, error) {
+	var instants []time.Time
+	err := walkOccurrences(next, after, func(t time.Time) bool {
+		if inc && t.After(before) || !inc && !t.Before(before) {
+			return false
+		}
+		if inc || t.After(after) {
+			instants = append(instants, t)
+		}
+		return true
+	})
+	return instants, err
+}
+
+// subDailyPeriods are the fixed lengths of the frequencies reanchor handles
+var subDailyPeriods = map[rrule.Frequency]time.Duration{
+	rrule.SECONDLY: time.Second,
+	rrule.MINUTELY: time.Minute,
+	rrule.HOURLY:   time.Hour,
+}
+
+// reanchor returns rule restarted at the last whole interval a period
+// before from, which yields the same instants from there on, so a query
+// needn't step through every instant since dtstart. Only rules that step by
+// a fixed period in UTC without COUNT or BYSETPOS qualify; others are
+// returned as they are.
+func reanchor(rule *rrule.RRule, from time.Time) *rrule.RRule {
+	opts := rule.OrigOptions
+	period := subDailyPeriods[opts.Freq]
+	if period == 0 || opts.Count > 0 || len(opts.Bysetpos) > 0 || opts.Dtstart.Location() != time.UTC {
+		return rule
+	}
+	step := time.Duration(max(opts.Interval, 1)) * period
+	intervals := from.Sub(opts.Dtstart) / step
+	if intervals < 2 {
+		return rule
+	}
+	opts.Dtstart = opts.Dtstart.Add((intervals - 1) * step)
+	anchored, err := rrule.NewRRule(opts)
+	if err != nil {
+		return rule
+	}
+	return anchored
+}
+
+// iterator steps through the rule's non-excluded-by-date instants, starting
+// near from where the rule allows it
+func (r *Recurrence) iterator(from time.Time) func() (time.Time, bool) {
+	set := &rrule.Set{}
+	set.RRule(reanchor(r.rule, from))
+	for _, exDate := range r.exDates {
+		set.ExDate(exDate)
+	}
+	return set.Iterator()
+}
+
+// Between returns the non-excluded occurrences between after and before
+func (r *Recurrence) Between(after, before time.Time, inc bool) ([]time.Time, error) {
+	occurrences, err := between(r.iterator(after), after, before, inc)
+	if err != nil || r.exRule == nil {
+		return occurrences, err
+	}
+
+	exclusions, err := between(reanchor(r.exRule, after).Iterator(), after, before, inc)
+	if err != nil {
+		return nil, err
+	}
+	excluded := make(map[time.Time]bool)
+	for _, t := range exclusions {
+		excluded[t] = true
+	}
+
+	kept := occurrences[:0]
+	for _, t := range occurrences {
+		if !excluded[t] {
+			kept = append(kept, t)
+		}
+	}
+	return kept, nil
+}
+
+// After returns the first non-excluded occurrence after dt, or the zero
+// time. The exrule's instants are walked alongside the rule's, once.
+func (r *Recurrence) After(dt time.Time, inc bool) (time.Time, error) {
+	var nextExclusion func() (time.Time, bool)
+	var exclusion time.Time
+	hasExclusion := false
+	if r.exRule != nil {
+		nextExclusion = reanchor(r.exRule, dt).Iterator()
+		exclusion, hasExclusion = nextExclusion()
+	}
+
+	var found time.Time
+	skips := 0
+	err := walkOccurrences(r.iterator(dt), dt, func(t time.Time) bool {
+		if !inc && t.Equal(dt) {
+			return true
+		}
+		for hasExclusion && exclusion.Before(t) {
+			exclusion, hasExclusion = nextExclusion()
+		}
+		if hasExclusion && exclusion.Equal(t) {
+			skips++
+			return skips < maxExcludedSkips
+		}
+		found = t
+		return false
+	})
+	return found, err
+}
+
+// All returns every non-excluded occurrence; only use it with bounded rules
+func (r *Recurrence) All() ([]time.Time, error) {
+	var occurrences []time.Time
+	err := walkOccurrences(r.iterator(time.Time{}), time.Time{}, func(t time.Time) bool {
+		occurrences = append(occurrences, t)
+		return true
+	})
+	if err != nil || len(occurrences) == 0 {
+		return occurrences, err
+	}
+	return r.Between(occurrences[0], occurrences[len(occurrences)-1], true)
+}
+
+// bounds returns the rule's COUNT and UNTIL, both zero for an unbounded rule
+func (r *Recurrence) bounds() (int, time.Time) {
+	opts := r.rule.OrigOptions
+	return opts.Count, opts.Until
+}
@@ -0,0 +1,340 @@
+package agenda
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestNormalizeRRule(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"FREQ=WEEKLY;BYDAY=FR", "FREQ=WEEKLY;BYDAY=FR"},
+		{"freq=weekly;byday=fr", "FREQ=WEEKLY;BYDAY=FR"},
+		{"Freq=Monthly;ByMonthDay=-5", "FREQ=MONTHLY;BYMONTHDAY=-5"},
+		{" rrule:freq=daily;until=20251231t000000z ", "FREQ=DAILY;UNTIL=20251231T000000Z"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if result := NormalizeRRule(tt.input); result != tt.expected {
+				t.Errorf("For input %q: expected %q, got %q", tt.input, tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestNewRRule_WeekStart(t *testing.T) {
+	t.Cleanup(func() { WeekStart = "" })
+
+	// RFC 5545 example: the week start changes which Sunday pairs with each Tuesday
+	rule := "FREQ=WEEKLY;INTERVAL=2;COUNT=4;BYDAY=TU,SU"
+	start := time.Date(1997, 8, 5, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		WeekStart string
+		expected  []int
+	}{
+		{"", []int{5, 10, 19, 24}},
+		{"MO", []int{5, 10, 19, 24}},
+		{"SU", []int{5, 17, 19, 31}},
+	}
+
+	for _, tt := range tests {
+		t.Run("wkst_"+tt.WeekStart, func(t *testing.T) {
+			WeekStart = tt.WeekStart
+			r, err := newRRule(rule, start)
+			if err != nil {
+				t.Fatalf("newRRule failed: %v", err)
+			}
+
+			occurrences := r.All()
+			if len(occurrences) != len(tt.expected) {
+				t.Fatalf("Expected %d occurrences, got %v", len(tt.expected), occurrences)
+			}
+			for i, day := range tt.expected {
+				if occurrences[i].Day() != day {
+					t.Errorf("Occurrence %d: expected Aug %d, got %v", i, day, occurrences[i])
+				}
+			}
+		})
+	}
+
+	t.Run("explicit_wkst_wins", func(t *testing.T) {
+		WeekStart = "SU"
+		r, err := newRRule(rule+";WKST=MO", start)
+		if err != nil {
+			t.Fatalf("newRRule failed: %v", err)
+		}
+		if day := r.All()[1].Day(); day != 10 {
+			t.Errorf("Expected explicit WKST=MO to give Aug 10, got Aug %d", day)
+		}
+	})
+}
+
+func TestParseWeekStart(t *testing.T) {
+	if ws, err := ParseWeekStart("su"); err != nil || ws != "SU" {
+		t.Errorf("Expected SU, got %q (err %v)", ws, err)
+	}
+	if _, err := ParseWeekStart("sunday"); err == nil {
+		t.Errorf("Expected error for invalid week start")
+	}
+}
+
+func TestRecurrence_ExRule(t *testing.T) {
+	start := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC) // Monday
+	r, err := NewRecurrence("FREQ=DAILY", "FREQ=WEEKLY;BYDAY=SA,SU", nil, start)
+	if err != nil {
+		t.Fatalf("newRecurrence failed: %v", err)
+	}
+
+	occurrences, err := r.Between(start, start.AddDate(0, 0, 13), true)
+	if err != nil {
+		t.Fatalf("Between failed: %v", err)
+	}
+	if len(occurrences) != 10 {
+		t.Errorf("Expected 10 weekday occurrences in two weeks, got %d: %v", len(occurrences), occurrences)
+	}
+	for _, occurrence := range occurrences {
+		if wd := occurrence.Weekday(); wd == time.Saturday || wd == time.Sunday {
+			t.Errorf("Weekend occurrence not excluded: %v", occurrence)
+		}
+	}
+
+	// The first occurrence after Friday skips the weekend
+	friday := time.Date(2025, 9, 5, 0, 0, 0, 0, time.UTC)
+	if next, err := r.After(friday, false); err != nil || !next.Equal(time.Date(2025, 9, 8, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected next occurrence on Monday Sep 8, got %v (err %v)", next, err)
+	}
+
+	if _, err := NewRecurrence("FREQ=DAILY", "FREQ=WEEKY", nil, start); err == nil {
+		t.Errorf("Expected error for invalid exrule")
+	}
+}
+
+func TestIsTaskActive_ExRule(t *testing.T) {
+	fm := &FrontMatter{RRule: "FREQ=DAILY", ExRule: "freq=weekly;byday=sa,su", DTStart: "2025-01-01"}
+
+	tests := []struct {
+		date     time.Time
+		expected bool
+	}{
+		{time.Date(2025, 9, 26, 12, 0, 0, 0, time.UTC), true},  // Friday
+		{time.Date(2025, 9, 27, 12, 0, 0, 0, time.UTC), false}, // Saturday
+		{time.Date(2025, 9, 28, 12, 0, 0, 0, time.UTC), false}, // Sunday
+		{time.Date(2025, 9, 29, 12, 0, 0, 0, time.UTC), true},  // Monday
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.date.Weekday().String(), func(t *testing.T) {
+			fmWithDefaults, err := ApplyDefaults(fm, tt.date)
+			if err != nil {
+				t.Fatalf("ApplyDefaults failed: %v", err)
+			}
+			result, err := IsTaskActive(fmWithDefaults, tt.date)
+			if err != nil {
+				t.Fatalf("IsTaskActive failed: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("On %s: expected %v, got %v", tt.date.Format("Mon 2006-01-02"), tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestIsTaskActive_ExDate(t *testing.T) {
+	monday := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		fm       FrontMatter
+		at       time.Time
+		expected bool
+		next     time.Time
+	}{
+		{
+			name:     "excluded_monday",
+			fm:       FrontMatter{RRule: "FREQ=WEEKLY;BYDAY=MO", DTStart: "2025-01-06", ExDate: []string{"2025-03-10", "2025-03-24"}},
+			at:       monday,
+			expected: false,
+			next:     time.Date(2025, 3, 17, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "other_monday",
+			fm:       FrontMatter{RRule: "FREQ=WEEKLY;BYDAY=MO", DTStart: "2025-01-06", ExDate: []string{"2025-03-03"}},
+			at:       monday,
+			expected: true,
+			next:     time.Date(2025, 3, 17, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "sub_day_bare_date",
+			fm:       FrontMatter{RRule: "FREQ=DAILY", DTStart: "2025-01-01T09:00:00", Duration: "PT4H", ExDate: []string{"2025-03-10"}},
+			at:       time.Date(2025, 3, 10, 10, 0, 0, 0, time.UTC),
+			expected: false,
+			next:     time.Date(2025, 3, 11, 9, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fmWithDefaults, err := ApplyDefaults(&tt.fm, tt.at)
+			if err != nil {
+				t.Fatalf("ApplyDefaults failed: %v", err)
+			}
+			active, err := IsTaskActive(fmWithDefaults, tt.at)
+			if err != nil {
+				t.Fatalf("IsTaskActive failed: %v", err)
+			}
+			if active != tt.expected {
+				t.Errorf("Expected active %v, got %v", tt.expected, active)
+			}
+			if next, err := NextOccurrence(fmWithDefaults, tt.at); err != nil || next == nil || !next.Equal(tt.next) {
+				t.Errorf("Expected next start %v, got %v (err %v)", tt.next, next, err)
+			}
+		})
+	}
+
+	if _, err := ApplyDefaults(&FrontMatter{RRule: "FREQ=DAILY", ExDate: []string{"someday"}}, monday); ErrorCategory(err) != ErrBadExDate {
+		t.Errorf("Expected an exdate error for an invalid exdate, got %v", err)
+	}
+}
+
+func TestDTStartTZIDAcrossDST(t *testing.T) {
+	// Kyiv moves from UTC+2 to UTC+3 on 2025-03-30
+	now := time.Date(2025, 3, 28, 0, 0, 0, 0, time.UTC)
+	from, to := time.Date(2025, 3, 29, 0, 0, 0, 0, time.UTC), time.Date(2025, 3, 31, 23, 0, 0, 0, time.UTC)
+
+	starts := func(fm *FrontMatter) []time.Time {
+		t.Helper()
+		fmWithDefaults, err := ApplyDefaults(fm, now)
+		if err != nil {
+			t.Fatalf("ApplyDefaults failed: %v", err)
+		}
+		occurrences, err := Occurrences(fmWithDefaults, from, to, now)
+		if err != nil {
+			t.Fatalf("Occurrences failed: %v", err)
+		}
+		var times []time.Time
+		for _, occurrence := range occurrences {
+			times = append(times, occurrence.Start.UTC())
+		}
+		return times
+	}
+	utcHours := func(times []time.Time) []int {
+		var hours []int
+		for _, t := range times {
+			hours = append(hours, t.Hour())
+		}
+		return hours
+	}
+
+	plain := starts(&FrontMatter{RRule: "FREQ=DAILY", DTStart: "2025-03-01T09:00:00", Duration: "PT1H"})
+	if got := utcHours(plain); len(got) != 3 || got[0] != 9 || got[1] != 9 || got[2] != 9 {
+		t.Errorf("Without a TZID expected 09:00 UTC daily, got %v", plain)
+	}
+
+	zoned := starts(&FrontMatter{RRule: "FREQ=DAILY", DTStart: "2025-03-01T09:00:00", DTStartTZID: "Europe/Kyiv", Duration: "PT1H"})
+	if got := utcHours(zoned); len(got) != 3 || got[0] != 7 || got[1] != 6 || got[2] != 6 {
+		t.Errorf("With Europe/Kyiv expected 09:00 local (07:00 then 06:00 UTC), got %v", zoned)
+	}
+
+	embedded, err := ParseFrontMatter("---\nrrule: \"DTSTART;TZID=Europe/Kyiv:20250301T090000\\nRRULE:FREQ=DAILY\"\nduration: PT1H\n---\n")
+	if err != nil {
+		t.Fatalf("ParseFrontMatter failed: %v", err)
+	}
+	if embedded.DTStartTZID != "Europe/Kyiv" {
+		t.Fatalf("Expected the embedded TZID, got %q", embedded.DTStartTZID)
+	}
+	if got := starts(embedded); !slices.Equal(got, zoned) {
+		t.Errorf("Expected the embedded TZID to match dtstart_tzid, got %v", got)
+	}
+}
+
+func TestDTStartTZIDInvalid(t *testing.T) {
+	fm := &FrontMatter{RRule: "FREQ=DAILY", DTStart: "2025-03-01T09:00:00", DTStartTZID: "Mars/Olympus", Duration: "PT1H"}
+	if _, err := ApplyDefaults(fm, time.Now()); !errors.Is(err, ErrBadDTStart) {
+		t.Errorf("Expected a bad dtstart error, got %v", err)
+	}
+}
+
+func TestRecurrence_OccurrenceCap(t *testing.T) {
+	saved := MaxOccurrences
+	MaxOccurrences = 1000
+	t.Cleanup(func() { MaxOccurrences = saved })
+
+	// An unbounded secondly rule has tens of thousands of instants per day
+	start := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	r, err := NewRecurrence("FREQ=SECONDLY", "", nil, start)
+	if err != nil {
+		t.Fatalf("newRecurrence failed: %v", err)
+	}
+
+	if _, err := r.Between(start, start.AddDate(0, 0, 1), true); !errors.Is(err, errOccurrenceCap) {
+		t.Errorf("Between: expected the occurrence cap, got %v", err)
+	}
+	// Only the instants within a query count, not those since dtstart
+	if next, err := r.After(start.Add(time.Hour), false); err != nil || !next.Equal(start.Add(time.Hour+time.Second)) {
+		t.Errorf("After: expected the next second, got %v (err %v)", next, err)
+	}
+	swallowed, err := NewRecurrence("FREQ=SECONDLY", "FREQ=SECONDLY", nil, start)
+	if err != nil {
+		t.Fatalf("newRecurrence failed: %v", err)
+	}
+	if _, err := swallowed.After(start.Add(time.Hour), false); !errors.Is(err, errOccurrenceCap) {
+		t.Errorf("After: expected the occurrence cap, got %v", err)
+	}
+	if _, err := r.All(); !errors.Is(err, errOccurrenceCap) {
+		t.Errorf("All: expected the occurrence cap, got %v", err)
+	}
+
+	// Queries that stay under the cap still work
+	occurrences, err := r.Between(start, start.Add(time.Minute), false)
+	if err != nil || len(occurrences) != 59 {
+		t.Errorf("Expected 59 occurrences within a minute, got %d (err %v)", len(occurrences), err)
+	}
+
+	// A task with the rule is reported as errored instead of hanging
+	fm := &FrontMatterWithDefaults{RRule: "FREQ=SECONDLY", DTStart: start, Duration: CalendarDuration{Duration: time.Second}}
+	if _, err := IsTaskActive(fm, start.AddDate(0, 0, 1)); !errors.Is(err, errOccurrenceCap) || ErrorCategory(err) != ErrBadRRule {
+		t.Errorf("IsTaskActive: expected a bad-rrule occurrence cap error, got %v", err)
+	}
+}
+
+func TestRecurrence_DenseRuleFarFromDTStart(t *testing.T) {
+	now := time.Date(2025, 9, 26, 10, 30, 0, 0, time.UTC)
+	kyiv, err := time.LoadLocation("Europe/Kyiv")
+	if err != nil {
+		t.Skip("Europe/Kyiv zone not available")
+	}
+	tests := []struct {
+		name  string
+		rule  string
+		start time.Time
+		next  time.Time
+	}{
+		{"hourly_eleven_years", "FREQ=HOURLY", time.Date(2014, 9, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 9, 26, 11, 0, 0, 0, time.UTC)},
+		{"every_three_hours", "FREQ=HOURLY;INTERVAL=3", time.Date(2014, 9, 1, 1, 0, 0, 0, time.UTC), time.Date(2025, 9, 26, 13, 0, 0, 0, time.UTC)},
+		{"minutely_months", "FREQ=MINUTELY;INTERVAL=15", time.Date(2025, 3, 1, 0, 5, 0, 0, time.UTC), time.Date(2025, 9, 26, 10, 35, 0, 0, time.UTC)},
+		{"hourly_zoned", "FREQ=HOURLY", time.Date(2015, 9, 1, 0, 0, 0, 0, kyiv), time.Date(2025, 9, 26, 11, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRecurrence(tt.rule, "", nil, tt.start)
+			if err != nil {
+				t.Fatalf("newRecurrence failed: %v", err)
+			}
+			next, err := r.After(now, false)
+			if err != nil || !next.Equal(tt.next) {
+				t.Errorf("Expected next %v, got %v (err %v)", tt.next, next, err)
+			}
+
+			fm := &FrontMatterWithDefaults{RRule: tt.rule, DTStart: tt.start, Duration: CalendarDuration{Duration: 30 * time.Minute}}
+			if _, err := IsTaskActive(fm, now); err != nil {
+				t.Errorf("IsTaskActive failed: %v", err)
+			}
+		})
+	}
+}
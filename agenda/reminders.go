@@ -0,0 +1,52 @@
+package agenda
+
+import (
+	"fmt"
+	"time"
+)
+
+// Reminder is the period from a task's remind_before date, counted back from
+// the start of its next occurrence, up to that occurrence's due date
+type Reminder struct {
+	On  time.Time
+	Due time.Time
+}
+
+// ReminderDate returns the day reminders start for a task that starts on
+// start. Months and years are calendar offsets, so P1M before March 31 is
+// February 28 (29 in leap years).
+func ReminderDate(start time.Time, remindBefore string) (time.Time, error) {
+	offset, err := ParseCalendarDuration(remindBefore)
+	if err != nil {
+		return time.Time{}, Categorize(ErrBadDuration, fmt.Errorf("remind_before: %w", err))
+	}
+	return DayOf(windowStart(DayOf(start), offset, offset.BusinessDays)), nil
+}
+
+// taskReminder computes the reminder for a task's next occurrence: it starts
+// remind_before ahead of that occurrence and lasts until its last day
+func taskReminder(remindBefore string, fm *FrontMatterWithDefaults, task Task) (*Reminder, error) {
+	if task.NextStart == nil {
+		return nil, nil
+	}
+	start := *task.NextStart
+	due := lastDay(WindowEnd(start, fm.Duration, fm.BusinessDays))
+
+	on, err := ReminderDate(start, remindBefore)
+	if err != nil {
+		return nil, err
+	}
+	return &Reminder{On: on, Due: due}, nil
+}
+
+// DueReminders returns the tasks whose reminder period includes now's day
+func DueReminders(tasks []Task, now time.Time) []Task {
+	today := now.Truncate(24 * time.Hour)
+	var due []Task
+	for _, task := range tasks {
+		if task.Reminder != nil && !today.Before(task.Reminder.On) && !today.After(task.Reminder.Due) {
+			due = append(due, task)
+		}
+	}
+	return due
+}
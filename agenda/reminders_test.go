@@ -0,0 +1,98 @@
+package agenda
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReminderDate(t *testing.T) {
+	start := time.Date(2025, 10, 3, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		remindBefore string
+		expected     time.Time
+		hasError     bool
+	}{
+		{"P2D", time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC), false},
+		{"P1W", time.Date(2025, 9, 26, 0, 0, 0, 0, time.UTC), false},
+		{"PT12H", time.Date(2025, 10, 2, 0, 0, 0, 0, time.UTC), false},
+		{"P1M", time.Date(2025, 9, 3, 0, 0, 0, 0, time.UTC), false},
+		{"P2BD", time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC), false},
+		{"soon", time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ReminderDate(start, tt.remindBefore)
+		if tt.hasError {
+			if err == nil {
+				t.Errorf("%s: expected error", tt.remindBefore)
+			}
+			continue
+		}
+		if err != nil || !got.Equal(tt.expected) {
+			t.Errorf("%s: expected %v, got %v (err %v)", tt.remindBefore, tt.expected, got, err)
+		}
+	}
+
+	// Calendar months, not 30-day approximations
+	if got, _ := ReminderDate(time.Date(2025, 3, 31, 0, 0, 0, 0, time.UTC), "P1M"); !got.Equal(time.Date(2025, 2, 28, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("P1M before March 31: expected 2025-02-28, got %v", got)
+	}
+	// Over a weekend in business days
+	if got, _ := ReminderDate(time.Date(2025, 10, 6, 0, 0, 0, 0, time.UTC), "P2BD"); !got.Equal(time.Date(2025, 10, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("P2BD before Monday: expected Thursday 2025-10-02, got %v", got)
+	}
+}
+
+func TestDueReminders(t *testing.T) {
+	due := time.Date(2025, 10, 3, 0, 0, 0, 0, time.UTC)
+	tasks := []Task{
+		{Name: "rent", Reminder: &Reminder{On: time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC), Due: due}},
+		{Name: "plain"},
+	}
+
+	tests := []struct {
+		day      int
+		expected int
+	}{
+		{30, 0}, // Sep 30, before the reminder
+		{31, 1}, // Oct 1, reminder day
+		{33, 1}, // Oct 3, due day
+		{34, 0}, // Oct 4, past due
+	}
+	for _, tt := range tests {
+		now := time.Date(2025, 9, tt.day, 9, 0, 0, 0, time.UTC)
+		if got := DueReminders(tasks, now); len(got) != tt.expected {
+			t.Errorf("%s: expected %d reminders, got %+v", now.Format("2006-01-02"), tt.expected, got)
+		}
+	}
+}
+
+func TestProcessFile_RemindBefore(t *testing.T) {
+	dir := t.TempDir()
+	// Not active yet: the reminder counts back from the next occurrence's start
+	upcoming := writeNote(t, dir, "trip.md", "---\ndtstart: 2999-01-10\nduration: P3D\nremind_before: P2D\n---\n")
+	meeting := writeNote(t, dir, "meeting.md", "---\ndtstart: 2999-01-10T09:00:00\nduration: PT1H\nremind_before: P1D\n---\n")
+	invalid := writeNote(t, dir, "bad.md", "---\nrrule: FREQ=DAILY\nremind_before: soon\n---\n")
+
+	task, _ := processFile(upcoming, Clock(), ReadFile)
+	if task.Reminder == nil {
+		t.Fatalf("Expected a reminder, got %+v", task)
+	}
+	if got := task.Reminder.Due.Format("2006-01-02"); got != "2999-01-12" {
+		t.Errorf("Expected reminder due 2999-01-12, got %s", got)
+	}
+	if got := task.Reminder.On.Format("2006-01-02"); got != "2999-01-08" {
+		t.Errorf("Expected reminder from 2999-01-08, got %s", got)
+	}
+
+	// An intraday window is due on its own day, not the day before
+	task, _ = processFile(meeting, Clock(), ReadFile)
+	if task.Reminder == nil || task.Reminder.Due.Format("2006-01-02") != "2999-01-10" || task.Reminder.On.Format("2006-01-02") != "2999-01-09" {
+		t.Errorf("Expected a reminder from 2999-01-09 due 2999-01-10, got %+v", task.Reminder)
+	}
+
+	if task, _ := processFile(invalid, Clock(), ReadFile); task.Error == nil || !strings.Contains(task.Error.Error(), "remind_before") {
+		t.Errorf("Expected a remind_before error, got %+v", task)
+	}
+}
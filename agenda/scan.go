@@ -0,0 +1,465 @@
+package agenda
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ScanResult is the classified outcome of scanning a notes directory
+type ScanResult struct {
+	Active       []Task
+	Inactive     []Task
+	Errored      []Task
+	Completed    []Task // done for good
+	FilesScanned int
+	TasksFound   int
+	Elapsed      time.Duration
+	Slowest      []FileTiming // the slowest files to process, slowest first
+}
+
+// Merge adds the tasks, counts and timings of another scan to r, keeping
+// the slowest files of both
+func (r *ScanResult) Merge(other ScanResult) {
+	r.Active = append(r.Active, other.Active...)
+	r.Inactive = append(r.Inactive, other.Inactive...)
+	r.Errored = append(r.Errored, other.Errored...)
+	r.Completed = append(r.Completed, other.Completed...)
+	r.FilesScanned += other.FilesScanned
+	r.TasksFound += other.TasksFound
+	r.Elapsed += other.Elapsed
+
+	slowest := &slowestFiles{n: slowestFileCount}
+	for _, timing := range slices.Concat(r.Slowest, other.Slowest) {
+		slowest.add(timing)
+	}
+	r.Slowest = slowest.sorted()
+}
+
+// slowestFileCount is how many of the slowest files a scan keeps
+const slowestFileCount = 5
+
+// FileTiming is how long one note took to parse and classify
+type FileTiming struct {
+	Path    string
+	Elapsed time.Duration
+}
+
+// timingHeap is a min-heap of file timings, so the fastest of the kept
+// files is the one evicted
+type timingHeap []FileTiming
+
+func (h timingHeap) Len() int           { return len(h) }
+func (h timingHeap) Less(i, j int) bool { return h[i].Elapsed < h[j].Elapsed }
+func (h timingHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *timingHeap) Push(x any)        { *h = append(*h, x.(FileTiming)) }
+func (h *timingHeap) Pop() any {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
+
+// slowestFiles keeps the n slowest timings seen
+type slowestFiles struct {
+	n int
+	h timingHeap
+}
+
+func (s *slowestFiles) add(timing FileTiming) {
+	if len(s.h) < s.n {
+		heap.Push(&s.h, timing)
+	} else if len(s.h) > 0 && timing.Elapsed > s.h[0].Elapsed {
+		s.h[0] = timing
+		heap.Fix(&s.h, 0)
+	}
+}
+
+// sorted returns the kept timings, slowest first
+func (s *slowestFiles) sorted() []FileTiming {
+	h := append(timingHeap(nil), s.h...)
+	timings := make([]FileTiming, len(h))
+	for i := len(h) - 1; i >= 0; i-- {
+		timings[i] = heap.Pop(&h).(FileTiming)
+	}
+	return timings
+}
+
+// Task classifications reported by WalkTasks
+const (
+	StatusActive    = "active"
+	StatusInactive  = "inactive"
+	StatusError     = "error"
+	StatusCompleted = "completed"
+)
+
+// ScanNotes walks root and classifies every markdown task note. It stops
+// early when ctx is done.
+func ScanNotes(ctx context.Context, root string) (ScanResult, error) {
+	return scanNotes(ctx, root, Clock())
+}
+
+// scanNotes is ScanNotes as of now, a Clock reading
+func scanNotes(ctx context.Context, root string, now time.Time) (ScanResult, error) {
+	var result ScanResult
+	started := time.Now()
+	slowest := &slowestFiles{n: slowestFileCount}
+
+	filesScanned, err := walkTasks(ctx, root, now, slowest, func(task Task, status string) {
+		result.TasksFound++
+		switch status {
+		case StatusActive:
+			result.Active = append(result.Active, task)
+		case StatusInactive:
+			result.Inactive = append(result.Inactive, task)
+		case StatusCompleted:
+			result.Completed = append(result.Completed, task)
+		default:
+			result.Errored = append(result.Errored, task)
+		}
+	})
+
+	// Workers finish in any order; keep results stable
+	for _, tasks := range [][]Task{result.Active, result.Inactive, result.Errored, result.Completed} {
+		slices.SortFunc(tasks, func(a, b Task) int { return strings.Compare(a.FilePath, b.FilePath) })
+	}
+	result.FilesScanned = filesScanned
+	result.Elapsed = time.Since(started)
+	result.Slowest = slowest.sorted()
+	return result, err
+}
+
+// scanAt is ScanNotes as of the instant at, seen from Timezone
+func scanAt(dir string, at time.Time) (ScanResult, error) {
+	return scanNotes(context.Background(), dir, WallClock(at, Timezone))
+}
+
+// ScanVault scans dir and returns its task notes, ordered by file path, as
+// they stand at the instant at, seen from Timezone. Each task's Status tells
+// which section it belongs to. The time is passed down to the scan rather
+// than through Clock, so calls may run concurrently with each other and
+// with other scans.
+func ScanVault(dir string, at time.Time) ([]Task, error) {
+	result, err := scanAt(dir, at)
+	if err != nil {
+		return nil, err
+	}
+	tasks := slices.Concat(result.Active, result.Inactive, result.Errored, result.Completed)
+	slices.SortFunc(tasks, func(a, b Task) int { return strings.Compare(a.FilePath, b.FilePath) })
+	return tasks, nil
+}
+
+// ScanVaultSections is ScanVault split into the sections the CLI prints,
+// each ordered by file path. Completed tasks are left out.
+func ScanVaultSections(root string, now time.Time) (active, inactive, errored []Task, err error) {
+	result, err := scanAt(root, now)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return result.Active, result.Inactive, result.Errored, nil
+}
+
+// FollowSymlinks makes walks descend into symlinked directories
+var FollowSymlinks = false
+
+// MaxFiles caps the markdown files one walk may scan, so a vault that loops
+// through bind mounts or symlinks fails instead of running forever
+var MaxFiles = 200000
+
+// ArchiveDirs names folders of finished notes that scans skip, compared
+// case-insensitively
+var ArchiveDirs = []string{"archive", "_archive"}
+
+// IncludeArchived makes scans descend into archive folders too
+var IncludeArchived = false
+
+// IsArchiveDir reports whether a folder name is one of ArchiveDirs
+func IsArchiveDir(name string) bool {
+	for _, archive := range ArchiveDirs {
+		if strings.EqualFold(name, archive) {
+			return true
+		}
+	}
+	return false
+}
+
+// SkipDir reports whether walks leave out a folder: hidden ones such as
+// .obsidian, which holds plugin files rather than notes, and archive folders
+// unless IncludeArchived is set
+func SkipDir(name string) bool {
+	return strings.HasPrefix(name, ".") || !IncludeArchived && IsArchiveDir(name)
+}
+
+// Workers is how many notes are classified at once. It can be overridden
+// with --workers.
+var Workers = runtime.NumCPU()
+
+// WalkTasks walks root and calls visit with each task note as soon as it is
+// classified, returning the number of markdown files scanned. The paths are
+// collected first, then classified by a pool of workers; visit is only ever
+// called from the calling goroutine, in completion order. When ctx is done
+// the walk stops, even in the middle of a hung read, and reports how many
+// files were processed.
+func WalkTasks(ctx context.Context, root string, visit func(task Task, status string)) (int, error) {
+	return walkTasks(ctx, root, Clock(), nil, visit)
+}
+
+// walkTasks is WalkTasks as of now, recording per-file timings in slowest
+// when it is non-nil. Clock and ReadFile are read once here, so workers
+// never touch them and a scan can't see them change midway.
+func walkTasks(ctx context.Context, root string, now time.Time, slowest *slowestFiles, visit func(task Task, status string)) (int, error) {
+	w := &walker{root: root, visited: map[string]bool{}}
+	if canonical, err := filepath.EvalSymlinks(root); err == nil {
+		w.visited[canonical] = true
+	}
+	if err := w.walk(root, root); err != nil {
+		return len(w.paths), err
+	}
+	for _, sidecar := range w.orphanSidecars() {
+		visit(orphanSidecar(sidecar), StatusError)
+	}
+
+	processed, err := classifyAll(ctx, w.paths, now, ReadFile, slowest, visit)
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		err = fmt.Errorf("scan timed out after processing %d files: %w", processed, err)
+	case errors.Is(err, context.Canceled):
+		err = fmt.Errorf("scan canceled after processing %d files: %w", processed, err)
+	}
+	return len(w.paths), err
+}
+
+// classifiedFile is one worker's result
+type classifiedFile struct {
+	task    Task
+	status  string
+	elapsed time.Duration
+	path    string
+	err     error
+}
+
+// classifyAll classifies paths with a bounded pool of workers, passing each
+// task note to visit, and returns how many files were processed. It stops at
+// the first error, which is only ever ctx's, and returns once every worker
+// has finished.
+func classifyAll(ctx context.Context, paths []string, now time.Time, read func(string) ([]byte, error), slowest *slowestFiles, visit func(task Task, status string)) (int, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	read = readContext(ctx, read)
+
+	jobs := make(chan string)
+	results := make(chan classifiedFile)
+	go func() {
+		defer close(jobs)
+		for _, path := range paths {
+			select {
+			case jobs <- path:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for range max(Workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range jobs {
+				started := time.Now()
+				task, status, err := classifyFileContext(ctx, path, now, read)
+				results <- classifiedFile{task, status, time.Since(started), path, err}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	processed := 0
+	var firstErr error
+	for result := range results {
+		if result.err != nil {
+			if firstErr == nil {
+				firstErr = result.err
+				cancel()
+			}
+			continue
+		}
+		if firstErr != nil {
+			continue
+		}
+		processed++
+		if slowest != nil {
+			slowest.add(FileTiming{Path: result.path, Elapsed: result.elapsed})
+		}
+		if result.task.Name != "" {
+			visit(result.task, result.status)
+		}
+	}
+	return processed, firstErr
+}
+
+// walker holds the state of one directory walk
+type walker struct {
+	root     string
+	visited  map[string]bool // canonical paths of directories entered
+	paths    []string        // markdown files found, as displayed
+	sidecars []string        // sidecar files found, as displayed
+}
+
+// orphanSidecars returns the sidecar files found without their note
+func (w *walker) orphanSidecars() []string {
+	notes := make(map[string]bool, len(w.paths))
+	for _, path := range w.paths {
+		notes[path] = true
+	}
+	var orphans []string
+	for _, sidecar := range w.sidecars {
+		if !notes[strings.TrimSuffix(sidecar, sidecarSuffix)+".md"] {
+			orphans = append(orphans, sidecar)
+		}
+	}
+	return orphans
+}
+
+// walk collects the markdown files under dir, reporting paths under display
+// instead. They differ once the walk has followed a symlink: dir is the link
+// target, display the link.
+func (w *walker) walk(dir, display string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		shown := filepath.Join(display, rel)
+
+		if path != dir && (d.IsDir() || FollowSymlinks && isDirSymlink(path, d)) {
+			return w.enter(path, shown, d)
+		}
+		if !d.IsDir() && strings.HasSuffix(d.Name(), sidecarSuffix) {
+			w.sidecars = append(w.sidecars, shown)
+			return nil
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), ".md") {
+			return nil
+		}
+
+		if len(w.paths) >= MaxFiles {
+			return fmt.Errorf("scanned more than %d markdown files under %s, giving up (raise max_files if the vault is that large)", MaxFiles, w.root)
+		}
+		w.paths = append(w.paths, shown)
+		return nil
+	})
+}
+
+// enter decides whether to descend into a directory or directory symlink,
+// skipping the folders SkipDir leaves out and any whose resolved path was
+// already scanned
+func (w *walker) enter(path, shown string, d fs.DirEntry) error {
+	if SkipDir(d.Name()) {
+		return skipEntry(d)
+	}
+	canonical, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		Debugf("skipping %s: %v", shown, err)
+		return skipEntry(d)
+	}
+	if w.visited[canonical] {
+		Debugf("skipping %s: already scanned as %s", shown, canonical)
+		return skipEntry(d)
+	}
+	w.visited[canonical] = true
+	if d.IsDir() {
+		return nil
+	}
+	return w.walk(canonical, shown)
+}
+
+// isDirSymlink reports whether an entry is a symlink to a directory
+func isDirSymlink(path string, d fs.DirEntry) bool {
+	if d.Type()&fs.ModeSymlink == 0 {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// skipEntry skips a directory's contents, or nothing for other entries
+func skipEntry(d fs.DirEntry) error {
+	if d.IsDir() {
+		return fs.SkipDir
+	}
+	return nil
+}
+
+// classifyFileContext runs classifyFile unless ctx is done first, and
+// reports ctx's error instead of the task when ctx ends during the read
+func classifyFileContext(ctx context.Context, path string, now time.Time, read func(string) ([]byte, error)) (Task, string, error) {
+	if err := ctx.Err(); err != nil {
+		return Task{}, "", err
+	}
+	task, status := classifyFile(path, now, read)
+	if err := ctx.Err(); err != nil {
+		return Task{}, "", err
+	}
+	return task, status, nil
+}
+
+// readContext wraps read so that a read that never returns is abandoned
+// once ctx is done. Only the raw read runs in the abandoned goroutine, so it
+// touches no package state after the scan returns.
+func readContext(ctx context.Context, read func(string) ([]byte, error)) func(string) ([]byte, error) {
+	return func(path string) ([]byte, error) {
+		type readResult struct {
+			data []byte
+			err  error
+		}
+		done := make(chan readResult, 1)
+		go func() {
+			data, err := read(path)
+			done <- readResult{data, err}
+		}()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case r := <-done:
+			return r.data, r.err
+		}
+	}
+}
+
+// ClassifyFile processes one note and reports its status. The task has an
+// empty name when the file is not a task note.
+func ClassifyFile(path string) (Task, string) {
+	return classifyFile(path, Clock(), ReadFile)
+}
+
+// classifyFile is ClassifyFile as of now, reading files with read
+func classifyFile(path string, now time.Time, read func(string) ([]byte, error)) (Task, string) {
+	task, active := processFile(path, now, read)
+	switch {
+	case task.Name == "" || task.Error != nil:
+		task.Status = StatusError
+	case task.Completed:
+		task.Status = StatusCompleted
+	case active:
+		task.Status = StatusActive
+	default:
+		task.Status = StatusInactive
+	}
+	return task, task.Status
+}
@@ -0,0 +1,407 @@
+package agenda
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeNote(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	return path
+}
+
+func TestScanNotes(t *testing.T) {
+	dir := t.TempDir()
+	writeNote(t, dir, "daily.md", "---\nrrule: FREQ=DAILY\n---\n")
+	writeNote(t, dir, "sub/future.md", "---\ndtstart: 2999-01-01\n---\n")
+	writeNote(t, dir, "broken.md", "---\nrrule: FREQ=WEEKY\n---\n")
+	writeNote(t, dir, "plain.md", "# Just a note\n")
+	writeNote(t, dir, "ignored.txt", "---\nrrule: FREQ=DAILY\n---\n")
+
+	result, err := ScanNotes(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("scanNotes failed: %v", err)
+	}
+
+	if result.FilesScanned != 4 {
+		t.Errorf("FilesScanned: expected 4, got %d", result.FilesScanned)
+	}
+	if result.TasksFound != 3 {
+		t.Errorf("TasksFound: expected 3, got %d", result.TasksFound)
+	}
+	if len(result.Active) != 1 || result.Active[0].Name != "daily" {
+		t.Errorf("Active: expected [daily], got %+v", result.Active)
+	}
+	if len(result.Inactive) != 1 || result.Inactive[0].Name != "future" {
+		t.Errorf("Inactive: expected [future], got %+v", result.Inactive)
+	}
+	if len(result.Errored) != 1 || result.Errored[0].Name != "broken" {
+		t.Errorf("Errored: expected [broken], got %+v", result.Errored)
+	}
+	if result.Elapsed <= 0 {
+		t.Errorf("Elapsed: expected a positive duration, got %v", result.Elapsed)
+	}
+	if len(result.Slowest) != 4 {
+		t.Errorf("Slowest: expected all 4 files to be timed, got %+v", result.Slowest)
+	}
+}
+
+func TestScanVault(t *testing.T) {
+	originalTimezone, originalClock := Timezone, Clock
+	t.Cleanup(func() { Timezone, Clock = originalTimezone, originalClock })
+	Timezone = time.UTC
+	Clock = func() time.Time {
+		t.Error("Expected the scan to take its time from its argument, not Clock")
+		return time.Now()
+	}
+
+	dir := t.TempDir()
+	writeNote(t, dir, "monday.md", "---\nrrule: FREQ=WEEKLY;BYDAY=MO\ndtstart: 2025-01-06\nduration: P1D\n---\n")
+	writeNote(t, dir, "broken.md", "---\nrrule: FREQ=WEEKY\n---\n")
+	writeNote(t, dir, "plain.md", "# Just a note\n")
+
+	tests := []struct {
+		at       time.Time
+		expected string
+	}{
+		{time.Date(2025, 12, 1, 12, 0, 0, 0, time.UTC), StatusActive},
+		{time.Date(2025, 12, 2, 12, 0, 0, 0, time.UTC), StatusInactive},
+	}
+	for _, tt := range tests {
+		tasks, err := ScanVault(dir, tt.at)
+		if err != nil {
+			t.Fatalf("ScanVault failed: %v", err)
+		}
+		if len(tasks) != 2 || tasks[0].Name != "broken" || tasks[1].Name != "monday" {
+			t.Fatalf("Expected [broken monday] ordered by path, got %+v", tasks)
+		}
+		if tasks[0].Status != StatusError {
+			t.Errorf("broken: expected status %s, got %s", StatusError, tasks[0].Status)
+		}
+		if tasks[1].Status != tt.expected {
+			t.Errorf("monday at %s: expected status %s, got %s", tt.at.Format("2006-01-02"), tt.expected, tasks[1].Status)
+		}
+	}
+}
+
+func TestScanVaultSections(t *testing.T) {
+	originalTimezone, originalClock := Timezone, Clock
+	t.Cleanup(func() { Timezone, Clock = originalTimezone, originalClock })
+	Timezone = time.UTC
+	Clock = func() time.Time {
+		t.Error("Expected the scan to take its time from its argument, not Clock")
+		return time.Now()
+	}
+
+	dir := t.TempDir()
+	writeNote(t, dir, "monday.md", "---\nrrule: FREQ=WEEKLY;BYDAY=MO\ndtstart: 2025-01-06\nduration: P1D\n---\n")
+	writeNote(t, dir, "sub/later.md", "---\ndtstart: 2026-01-01\n---\n")
+	writeNote(t, dir, "broken.md", "---\nrrule: FREQ=WEEKY\n---\n")
+	writeNote(t, dir, "done.md", "---\ndtstart: 2025-11-01\ndone: true\n---\n")
+
+	active, inactive, errored, err := ScanVaultSections(dir, time.Date(2025, 12, 1, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("ScanVaultSections failed: %v", err)
+	}
+	if len(active) != 1 || active[0].Name != "monday" {
+		t.Errorf("Active: expected [monday], got %+v", active)
+	}
+	if len(inactive) != 1 || inactive[0].Name != "later" {
+		t.Errorf("Inactive: expected [later], got %+v", inactive)
+	}
+	if len(errored) != 1 || errored[0].Name != "broken" {
+		t.Errorf("Errored: expected [broken], got %+v", errored)
+	}
+
+	if _, _, _, err := ScanVaultSections(filepath.Join(dir, "missing"), time.Now()); err == nil {
+		t.Error("Expected an error for a missing directory")
+	}
+}
+
+func TestSlowestFiles(t *testing.T) {
+	slowest := &slowestFiles{n: 3}
+	for i, ms := range []int{5, 1, 9, 3, 7, 2} {
+		slowest.add(FileTiming{Path: string(rune('a' + i)), Elapsed: time.Duration(ms) * time.Millisecond})
+	}
+
+	got := slowest.sorted()
+	want := []string{"c", "e", "a"} // 9ms, 7ms, 5ms
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d timings, got %+v", len(want), got)
+	}
+	for i, path := range want {
+		if got[i].Path != path {
+			t.Errorf("Position %d: expected %s, got %s (%v)", i, path, got[i].Path, got[i].Elapsed)
+		}
+	}
+
+	// sorted doesn't consume the heap
+	if again := slowest.sorted(); len(again) != 3 || again[0].Path != "c" {
+		t.Errorf("Expected sorted to be repeatable, got %+v", again)
+	}
+}
+
+func TestScanNotes_Sidecar(t *testing.T) {
+	dir := t.TempDir()
+	note := writeNote(t, dir, "2025-01-01 Water plants.md", "# Water plants\nEvery day.\n")
+	writeNote(t, dir, "2025-01-01 Water plants.task.yaml", "rrule: FREQ=DAILY\nduration: P1D\n")
+	writeNote(t, dir, "inline.md", "---\nrrule: FREQ=DAILY\n---\n")
+	writeNote(t, dir, "inline.task.yaml", "dtstart: 2999-01-01\n")
+	writeNote(t, dir, "bad.md", "no front matter\n")
+	writeNote(t, dir, "bad.task.yaml", "rrule: [\n")
+	writeNote(t, dir, "orphan.task.yaml", "rrule: FREQ=DAILY\n")
+
+	result, err := ScanNotes(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("scanNotes failed: %v", err)
+	}
+
+	if len(result.Active) != 2 {
+		t.Fatalf("Active: expected the sidecar and inline tasks, got %+v", result.Active)
+	}
+	var sidecarTask Task
+	for _, task := range result.Active {
+		if task.FilePath == note {
+			sidecarTask = task
+		}
+	}
+	if sidecarTask.Name != "Water plants" || sidecarTask.RRule != "FREQ=DAILY" {
+		t.Errorf("Expected the sidecar schedule on the adjacent note, got %+v", sidecarTask)
+	}
+	if sidecarTask.Snippet != "# Water plants" {
+		t.Errorf("Expected the snippet from the note body, got %q", sidecarTask.Snippet)
+	}
+	if len(result.Inactive) != 0 {
+		t.Errorf("Expected in-note front matter to take precedence over a sidecar, got %+v", result.Inactive)
+	}
+	if len(result.Errored) != 2 || result.Errored[0].Name != "bad" || result.Errored[1].Name != "orphan" {
+		t.Fatalf("Errored: expected [bad orphan], got %+v", result.Errored)
+	}
+	if !strings.Contains(result.Errored[1].Error.Error(), "no note orphan.md") {
+		t.Errorf("Expected the orphaned sidecar to name its missing note, got %v", result.Errored[1].Error)
+	}
+}
+
+func TestWalkTasksSymlinkLoop(t *testing.T) {
+	original := FollowSymlinks
+	FollowSymlinks = true
+	t.Cleanup(func() { FollowSymlinks = original })
+
+	dir := t.TempDir()
+	writeNote(t, dir, "Daily.md", "---\nrrule: FREQ=DAILY\nduration: P1D\n---\n")
+	writeNote(t, dir, "sub/Weekly.md", "---\nrrule: FREQ=WEEKLY\nduration: P1D\n---\n")
+	// Without cycle detection sub/loop/sub/loop/... would never end
+	if err := os.Symlink(dir, filepath.Join(dir, "sub", "loop")); err != nil {
+		t.Skipf("symlinks unsupported: %v", err)
+	}
+
+	result, err := ScanNotes(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("scanNotes failed: %v", err)
+	}
+	if result.FilesScanned != 2 || result.TasksFound != 2 {
+		t.Errorf("Expected each note once, got %d files and %d tasks", result.FilesScanned, result.TasksFound)
+	}
+}
+
+func TestWalkTasksFollowsSymlinkedFolder(t *testing.T) {
+	original := FollowSymlinks
+	t.Cleanup(func() { FollowSymlinks = original })
+
+	dir := t.TempDir()
+	shared := t.TempDir()
+	writeNote(t, shared, "Shared.md", "---\nrrule: FREQ=DAILY\nduration: P1D\n---\n")
+	if err := os.Symlink(shared, filepath.Join(dir, "shared")); err != nil {
+		t.Skipf("symlinks unsupported: %v", err)
+	}
+
+	FollowSymlinks = false
+	if result, _ := ScanNotes(context.Background(), dir); result.TasksFound != 0 {
+		t.Errorf("Expected symlinked folders to be skipped by default, got %d tasks", result.TasksFound)
+	}
+
+	FollowSymlinks = true
+	result, err := ScanNotes(context.Background(), dir)
+	if err != nil || result.TasksFound != 1 {
+		t.Fatalf("Expected the linked note, got %d tasks (err %v)", result.TasksFound, err)
+	}
+	if path := result.Active[0].FilePath; path != filepath.Join(dir, "shared", "Shared.md") {
+		t.Errorf("Expected the path through the link, got %s", path)
+	}
+}
+
+func TestWalkTasksMaxFiles(t *testing.T) {
+	original := MaxFiles
+	MaxFiles = 2
+	t.Cleanup(func() { MaxFiles = original })
+
+	dir := t.TempDir()
+	for _, name := range []string{"A.md", "B.md", "C.md"} {
+		writeNote(t, dir, name, "# note\n")
+	}
+	if _, err := ScanNotes(context.Background(), dir); err == nil || !strings.Contains(err.Error(), "max_files") {
+		t.Errorf("Expected the scan to stop at max_files, got %v", err)
+	}
+}
+
+func TestScanNotesSkipsArchives(t *testing.T) {
+	original := IncludeArchived
+	t.Cleanup(func() { IncludeArchived = original })
+
+	dir := t.TempDir()
+	note := "---\nrrule: FREQ=DAILY\nduration: P1D\n---\n"
+	writeNote(t, dir, "Daily.md", note)
+	writeNote(t, dir, "Archive/Old.md", note)
+	writeNote(t, dir, "projects/_ARCHIVE/Older.md", note)
+	writeNote(t, dir, "projects/Archived notes/Kept.md", note)
+	writeNote(t, dir, ".obsidian/plugins/templater/Template.md", note)
+
+	IncludeArchived = false
+	result, err := ScanNotes(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("scanNotes failed: %v", err)
+	}
+	if result.TasksFound != 2 {
+		t.Errorf("Expected archive folders to be skipped, got %d tasks", result.TasksFound)
+	}
+
+	IncludeArchived = true
+	if result, _ := ScanNotes(context.Background(), dir); result.TasksFound != 4 {
+		t.Errorf("Expected --include-archived to scan every folder, got %d tasks", result.TasksFound)
+	}
+}
+
+func TestIsArchiveDirConfigured(t *testing.T) {
+	original := ArchiveDirs
+	t.Cleanup(func() { ArchiveDirs = original })
+
+	if !IsArchiveDir("Archive") || !IsArchiveDir("_archive") || IsArchiveDir("Done") {
+		t.Error("Unexpected default archive folders")
+	}
+	ArchiveDirs = []string{"Done"}
+	if IsArchiveDir("Archive") || !IsArchiveDir("done") {
+		t.Error("Expected archive_dirs to replace the defaults")
+	}
+}
+
+func TestScanNotesTimeout(t *testing.T) {
+	dir := t.TempDir()
+	note := "---\nrrule: FREQ=DAILY\nduration: P1D\n---\n"
+	for _, name := range []string{"A.md", "B.md", "Hang.md", "Z.md"} {
+		writeNote(t, dir, name, note)
+	}
+
+	// A slow filesystem where one read never returns
+	release := make(chan struct{})
+	origReadFile := ReadFile
+	t.Cleanup(func() { ReadFile = origReadFile })
+	t.Cleanup(func() { close(release) })
+	ReadFile = func(name string) ([]byte, error) {
+		if filepath.Base(name) == "Hang.md" {
+			<-release
+		}
+		time.Sleep(5 * time.Millisecond)
+		return os.ReadFile(name)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	result, err := ScanNotes(ctx, dir)
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected a deadline error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "after processing 2 files") {
+		t.Errorf("Expected the processed count in %q", err)
+	}
+	if len(result.Active) != 2 {
+		t.Errorf("Expected the 2 tasks read before the hang, got %d", len(result.Active))
+	}
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Errorf("Expected the scan to give up promptly, took %v", elapsed)
+	}
+}
+
+func TestScanNotesWorkers(t *testing.T) {
+	saved := Workers
+	t.Cleanup(func() { Workers = saved })
+
+	dir := t.TempDir()
+	for i := range 40 {
+		switch i % 3 {
+		case 0:
+			writeNote(t, dir, fmt.Sprintf("n%02d.md", i), "---\nrrule: FREQ=DAILY\n---\n")
+		case 1:
+			writeNote(t, dir, fmt.Sprintf("sub/n%02d.md", i), "---\ndtstart: 2999-01-01\n---\n")
+		default:
+			writeNote(t, dir, fmt.Sprintf("n%02d.md", i), "---\nrrule: FREQ=WEEKY\n---\n")
+		}
+	}
+
+	paths := func(tasks []Task) []string {
+		var paths []string
+		for _, task := range tasks {
+			paths = append(paths, task.FilePath)
+		}
+		return paths
+	}
+
+	Workers = 1
+	sequential, err := ScanNotes(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("scanNotes failed: %v", err)
+	}
+	for _, n := range []int{2, 8, 64} {
+		Workers = n
+		parallel, err := ScanNotes(context.Background(), dir)
+		if err != nil {
+			t.Fatalf("scanNotes with %d workers failed: %v", n, err)
+		}
+		if parallel.FilesScanned != 40 || parallel.TasksFound != 40 {
+			t.Errorf("%d workers: expected 40 files and tasks, got %d and %d", n, parallel.FilesScanned, parallel.TasksFound)
+		}
+		if !slices.Equal(paths(parallel.Active), paths(sequential.Active)) ||
+			!slices.Equal(paths(parallel.Inactive), paths(sequential.Inactive)) ||
+			!slices.Equal(paths(parallel.Errored), paths(sequential.Errored)) {
+			t.Errorf("%d workers: results differ from a sequential scan", n)
+		}
+	}
+	if len(sequential.Active) != 14 || len(sequential.Inactive) != 13 || len(sequential.Errored) != 13 {
+		t.Errorf("Unexpected split: %d active, %d inactive, %d errored", len(sequential.Active), len(sequential.Inactive), len(sequential.Errored))
+	}
+}
+
+func TestClassifyFileReadsOnce(t *testing.T) {
+	dir := t.TempDir()
+	path := writeNote(t, dir, "daily.md", "---\nrrule: FREQ=DAILY\nremind_before: P1D\n---\nbody\n")
+
+	origReadFile := ReadFile
+	t.Cleanup(func() { ReadFile = origReadFile })
+	reads := 0
+	ReadFile = func(name string) ([]byte, error) {
+		reads++
+		return os.ReadFile(name)
+	}
+
+	if _, status := ClassifyFile(path); status != StatusActive {
+		t.Fatalf("Expected an active task, got %s", status)
+	}
+	if reads != 1 {
+		t.Errorf("Expected the note to be read once, got %d reads", reads)
+	}
+}
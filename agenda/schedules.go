@@ -0,0 +1,37 @@
+package agenda
+
+import (
+	"fmt"
+)
+
+// Schedule is a named rrule and duration shared by notes through their
+// schedule field, defined under schedules in the config file
+type Schedule struct {
+	RRule    string `yaml:"rrule"`
+	Duration string `yaml:"duration"`
+}
+
+// Schedules maps names to shared schedules. It is set from the config file.
+var Schedules = map[string]Schedule{}
+
+// ResolveSchedule fills a note's rrule and duration from its named schedule.
+// Fields set in the note itself take precedence. Notes without a schedule
+// are returned unchanged.
+func ResolveSchedule(fm *FrontMatter) (*FrontMatter, error) {
+	if fm.Schedule == "" {
+		return fm, nil
+	}
+	schedule, ok := Schedules[fm.Schedule]
+	if !ok {
+		return nil, fmt.Errorf("unknown schedule %q", fm.Schedule)
+	}
+
+	resolved := *fm
+	if resolved.RRule == "" {
+		resolved.RRule = schedule.RRule
+	}
+	if resolved.Duration == "" {
+		resolved.Duration = schedule.Duration
+	}
+	return &resolved, nil
+}
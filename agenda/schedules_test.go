@@ -0,0 +1,77 @@
+package agenda
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func withSchedules(t *testing.T, s map[string]Schedule) {
+	t.Helper()
+	original := Schedules
+	Schedules = s
+	t.Cleanup(func() { Schedules = original })
+}
+
+func TestApplyDefaults_Schedule(t *testing.T) {
+	withSchedules(t, map[string]Schedule{
+		"monthly-report": {RRule: "FREQ=MONTHLY;BYMONTHDAY=1", Duration: "P3D"},
+	})
+	currentTime := time.Date(2025, 9, 2, 12, 0, 0, 0, time.UTC)
+
+	fm, err := ParseFrontMatter("---\nschedule: monthly-report\ndtstart: 2025-01-01\n---")
+	if err != nil {
+		t.Fatalf("ParseFrontMatter failed: %v", err)
+	}
+	fmWithDefaults, err := ApplyDefaults(fm, currentTime)
+	if err != nil {
+		t.Fatalf("ApplyDefaults failed: %v", err)
+	}
+	if fmWithDefaults.RRule != "FREQ=MONTHLY;BYMONTHDAY=1" || fmWithDefaults.Duration != dayDuration(3) {
+		t.Errorf("Expected the schedule's rrule and duration, got %q %v", fmWithDefaults.RRule, fmWithDefaults.Duration)
+	}
+	if active, err := IsTaskActive(fmWithDefaults, currentTime); err != nil || !active {
+		t.Errorf("Expected task active on Sep 2, got %v (err %v)", active, err)
+	}
+	if fm.RRule != "" {
+		t.Errorf("Expected the parsed front matter to be left untouched, got rrule %q", fm.RRule)
+	}
+
+	// Fields in the note override the schedule
+	fm = &FrontMatter{Schedule: "monthly-report", Duration: "P1D"}
+	fmWithDefaults, err = ApplyDefaults(fm, currentTime)
+	if err != nil {
+		t.Fatalf("ApplyDefaults failed: %v", err)
+	}
+	if fmWithDefaults.Duration != dayDuration(1) {
+		t.Errorf("Expected the note's duration to win, got %v", fmWithDefaults.Duration)
+	}
+}
+
+func TestApplyDefaults_UnknownSchedule(t *testing.T) {
+	withSchedules(t, map[string]Schedule{})
+
+	_, err := ApplyDefaults(&FrontMatter{Schedule: "weekly-sync"}, time.Now())
+	if err == nil || !strings.Contains(err.Error(), `unknown schedule "weekly-sync"`) {
+		t.Errorf("Expected unknown schedule error, got %v", err)
+	}
+}
+
+func TestScanNotes_Schedule(t *testing.T) {
+	withSchedules(t, map[string]Schedule{"daily": {RRule: "FREQ=DAILY"}})
+	dir := t.TempDir()
+	writeNote(t, dir, "standup.md", "---\nschedule: daily\n---\n")
+	writeNote(t, dir, "typo.md", "---\nschedule: dialy\n---\n")
+
+	result, err := ScanNotes(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("scanNotes failed: %v", err)
+	}
+	if len(result.Active) != 1 || result.Active[0].RRule != "FREQ=DAILY" {
+		t.Errorf("Active: expected standup with the daily rule, got %+v", result.Active)
+	}
+	if len(result.Errored) != 1 || result.Errored[0].Name != "typo" {
+		t.Errorf("Errored: expected the unknown schedule to be reported, got %+v", result.Errored)
+	}
+}
@@ -0,0 +1,99 @@
+package agenda
+
+import (
+	"fmt"
+	"time"
+)
+
+// Position locates the current or next occurrence of a COUNT- or
+// UNTIL-limited series
+type Position struct {
+	Index int       // 1-based position of the current or next occurrence
+	Total int       // number of occurrences in the series
+	Until time.Time // end of an UNTIL-limited series, zero for COUNT
+}
+
+// String renders the position as shown after the schedule
+func (p Position) String() string {
+	if !p.Until.IsZero() {
+		return fmt.Sprintf("%d remaining until %s", p.Total-p.Index, p.Until.Format("2006-01-02"))
+	}
+	return fmt.Sprintf("occurrence %d of %d", p.Index, p.Total)
+}
+
+// SeriesPosition returns where the current (or else the next) occurrence
+// falls within a bounded series. It returns nil for unbounded rules and for
+// series that have already ended.
+func SeriesPosition(fm *FrontMatterWithDefaults, currentTime time.Time) (*Position, error) {
+	if fm.RRule == "" {
+		return nil, nil
+	}
+	r, err := NewRecurrence(fm.RRule, fm.ExRule, fm.ExDates, fm.DTStart)
+	if err != nil {
+		return nil, err
+	}
+	count, until := r.bounds()
+	if count == 0 && until.IsZero() {
+		return nil, nil
+	}
+
+	reference := currentTime.Truncate(24 * time.Hour)
+	if fm.Duration.Intraday() {
+		reference = currentTime
+	}
+
+	occurrences, err := r.All()
+	if err != nil {
+		return nil, err
+	}
+	for i, occurrence := range occurrences {
+		start := occurrence
+		if !fm.Duration.Intraday() {
+			start = occurrence.Truncate(24 * time.Hour)
+		}
+		if WindowEnd(start, fm.Duration, fm.BusinessDays).After(reference) {
+			position := &Position{Index: i + 1, Total: len(occurrences)}
+			if count == 0 {
+				position.Until = until
+			}
+			return position, nil
+		}
+	}
+	return nil, nil
+}
+
+// FirstOccurrence returns the first occurrence at or after dtstart. One-time
+// events occur once, on dtstart.
+func FirstOccurrence(fm *FrontMatterWithDefaults) (time.Time, error) {
+	if fm.RRule == "" {
+		return fm.DTStart, nil
+	}
+	r, err := NewRecurrence(fm.RRule, fm.ExRule, fm.ExDates, fm.DTStart)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return r.After(fm.DTStart, true)
+}
+
+// LastOccurrence returns the final occurrence of a COUNT- or UNTIL-limited
+// series. bounded is false for rules that repeat forever.
+func LastOccurrence(fm *FrontMatterWithDefaults) (last time.Time, bounded bool, err error) {
+	if fm.RRule == "" {
+		return fm.DTStart, true, nil
+	}
+	r, err := NewRecurrence(fm.RRule, fm.ExRule, fm.ExDates, fm.DTStart)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	if count, until := r.bounds(); count == 0 && until.IsZero() {
+		return time.Time{}, false, nil
+	}
+	occurrences, err := r.All()
+	if err != nil {
+		return time.Time{}, true, err
+	}
+	if len(occurrences) == 0 {
+		return time.Time{}, true, nil
+	}
+	return occurrences[len(occurrences)-1], true, nil
+}
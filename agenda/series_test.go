@@ -0,0 +1,145 @@
+package agenda
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSeriesPosition_Count(t *testing.T) {
+	fm := &FrontMatter{RRule: "FREQ=DAILY;COUNT=5", DTStart: "2025-01-01", Duration: "P1D"}
+
+	tests := []struct {
+		day      int
+		expected string
+	}{
+		{-1, "occurrence 1 of 5"}, // Dec 31: the first one is next
+		{0, "occurrence 1 of 5"},
+		{2, "occurrence 3 of 5"},
+		{4, "occurrence 5 of 5"},
+		{5, ""}, // series over
+	}
+
+	for _, tt := range tests {
+		currentTime := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC).AddDate(0, 0, tt.day)
+		fmWithDefaults, err := ApplyDefaults(fm, currentTime)
+		if err != nil {
+			t.Fatalf("ApplyDefaults failed: %v", err)
+		}
+		position, err := SeriesPosition(fmWithDefaults, currentTime)
+		if err != nil {
+			t.Fatalf("SeriesPosition failed: %v", err)
+		}
+		got := ""
+		if position != nil {
+			got = position.String()
+		}
+		if got != tt.expected {
+			t.Errorf("%s: expected %q, got %q", currentTime.Format("2006-01-02"), tt.expected, got)
+		}
+	}
+}
+
+func TestSeriesPosition_Until(t *testing.T) {
+	fm := &FrontMatter{RRule: "FREQ=DAILY;UNTIL=20250110T000000Z", DTStart: "2025-01-01", Duration: "P1D"}
+	currentTime := time.Date(2025, 1, 3, 12, 0, 0, 0, time.UTC)
+
+	fmWithDefaults, err := ApplyDefaults(fm, currentTime)
+	if err != nil {
+		t.Fatalf("ApplyDefaults failed: %v", err)
+	}
+	position, err := SeriesPosition(fmWithDefaults, currentTime)
+	if err != nil {
+		t.Fatalf("SeriesPosition failed: %v", err)
+	}
+	if position == nil || position.String() != "7 remaining until 2025-01-10" {
+		t.Errorf("Expected 7 remaining until 2025-01-10, got %v", position)
+	}
+}
+
+func TestSeriesPosition_Unbounded(t *testing.T) {
+	fm := &FrontMatter{RRule: "FREQ=DAILY", DTStart: "2025-01-01"}
+	currentTime := time.Date(2025, 1, 3, 12, 0, 0, 0, time.UTC)
+
+	fmWithDefaults, err := ApplyDefaults(fm, currentTime)
+	if err != nil {
+		t.Fatalf("ApplyDefaults failed: %v", err)
+	}
+	if position, err := SeriesPosition(fmWithDefaults, currentTime); err != nil || position != nil {
+		t.Errorf("Expected nothing for an unbounded rule, got %v (err %v)", position, err)
+	}
+}
+
+func TestFirstAndLastOccurrence(t *testing.T) {
+	now := time.Date(2025, 9, 26, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		fm          FrontMatter
+		first       string
+		last        string
+		wantBounded bool
+	}{
+		{"count", FrontMatter{RRule: "FREQ=WEEKLY;COUNT=3", DTStart: "2025-01-06"}, "2025-01-06", "2025-01-20", true},
+		{"until", FrontMatter{RRule: "FREQ=MONTHLY;BYMONTHDAY=15;UNTIL=20251231T000000Z", DTStart: "2025-01-01"}, "2025-01-15", "2025-12-15", true},
+		{"count_with_exrule", FrontMatter{RRule: "FREQ=DAILY;COUNT=7", ExRule: "FREQ=WEEKLY;BYDAY=SA,SU", DTStart: "2025-01-06"}, "2025-01-06", "2025-01-10", true},
+		{"unbounded", FrontMatter{RRule: "FREQ=DAILY", DTStart: "2025-01-01"}, "2025-01-01", "", false},
+		{"one_time", FrontMatter{DTStart: "2025-10-18"}, "2025-10-18", "2025-10-18", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fmWithDefaults, err := ApplyDefaults(&tt.fm, now)
+			if err != nil {
+				t.Fatalf("ApplyDefaults failed: %v", err)
+			}
+
+			first, err := FirstOccurrence(fmWithDefaults)
+			if err != nil {
+				t.Fatalf("FirstOccurrence failed: %v", err)
+			}
+			if got := first.Format("2006-01-02"); got != tt.first {
+				t.Errorf("First: expected %s, got %s", tt.first, got)
+			}
+
+			last, bounded, err := LastOccurrence(fmWithDefaults)
+			if err != nil {
+				t.Fatalf("LastOccurrence failed: %v", err)
+			}
+			if bounded != tt.wantBounded {
+				t.Fatalf("Expected bounded=%v, got %v", tt.wantBounded, bounded)
+			}
+			if bounded && last.Format("2006-01-02") != tt.last {
+				t.Errorf("Last: expected %s, got %s", tt.last, last.Format("2006-01-02"))
+			}
+		})
+	}
+}
+
+func TestFinishedSeriesIsInactive(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"count", "---\nrrule: FREQ=WEEKLY;COUNT=2\ndtstart: 2020-01-01\n---\n"},
+		{"until", "---\nrrule: FREQ=DAILY;UNTIL=20200105T000000Z\ndtstart: 2020-01-01\n---\n"},
+		// UNTIL is absolute, so the series ends even without a dtstart
+		{"until_without_dtstart", "---\nrrule: FREQ=DAILY;UNTIL=20200105T000000Z\n---\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			task, status := ClassifyFile(writeNote(t, dir, tt.name+".md", tt.content))
+			if status != StatusInactive || task.NextStart != nil || task.DueDate != nil {
+				t.Errorf("Expected an inactive task with no next start, got %s %+v", status, task)
+			}
+		})
+	}
+}
+
+func TestCountWithoutDTStart(t *testing.T) {
+	dir := t.TempDir()
+	task, status := ClassifyFile(writeNote(t, dir, "count.md", "---\nrrule: FREQ=DAILY;COUNT=5\n---\n"))
+	if status != StatusError || !errors.Is(task.Error, ErrBadDTStart) {
+		t.Errorf("Expected a dtstart error, got %s %v", status, task.Error)
+	}
+}
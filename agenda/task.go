@@ -0,0 +1,484 @@
+// Package agenda finds recurring and one-time task notes in an Obsidian vault
+// and decides which are active: front matter and duration parsing, recurrence
+// evaluation, vault detection and scanning. The obsidian-tasks command is a
+// thin CLI over it.
+package agenda
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type FrontMatter struct {
+	RRule    string   `yaml:"rrule"`
+	ExRule   string   `yaml:"exrule"`
+	ExDate   []string `yaml:"exdate"`
+	Duration string   `yaml:"duration"`
+	DTStart  string   `yaml:"dtstart"`
+	Tags     []string `yaml:"tags"`
+
+	// SingleDay makes each occurrence active only on its start day,
+	// regardless of duration and the configured default
+	SingleDay bool `yaml:"single_day"`
+
+	// Countdown treats a one-time dtstart as a deadline: the task is active
+	// for the duration leading up to it and is due on dtstart
+	Countdown bool `yaml:"countdown"`
+
+	// SkipWeekends counts the duration's days as weekdays only, so the
+	// window stretches over any Saturday and Sunday it spans
+	SkipWeekends bool `yaml:"skip_weekends"`
+
+	// Schedule names a shared rrule/duration from the schedules config
+	Schedule string `yaml:"schedule"`
+
+	// RemindBefore lists the task under Reminders this long before it is due
+	RemindBefore string `yaml:"remind_before"`
+
+	// DTStartTZID is the IANA zone a sub-day task's dtstart is local to, so
+	// its occurrences keep their wall-clock time in that zone
+	DTStartTZID string `yaml:"dtstart_tzid"`
+
+	// TZ is the IANA zone whose calendar decides which day it is for this
+	// note, overriding the timezone config key
+	TZ string `yaml:"tz"`
+
+	// Done marks a task finished: a one-time event, or a whole series
+	Done bool `yaml:"done"`
+
+	// Completed is the date the task was last done. It finishes a one-time
+	// event, and for a recurring task the occurrence active on that date.
+	Completed string `yaml:"completed"`
+
+	// Title is the task name to show instead of the cleaned file name
+	Title string `yaml:"title"`
+
+	// Body is the note content after the closing ---
+	Body string `yaml:"-"`
+
+	// Warnings are non-fatal problems found while parsing
+	Warnings []string `yaml:"-"`
+}
+
+type FrontMatterWithDefaults struct {
+	RRule        string
+	ExRule       string
+	ExDates      []time.Time
+	Duration     CalendarDuration
+	DTStart      time.Time
+	Tags         []string
+	Countdown    bool
+	BusinessDays bool
+	Completed    time.Time // zero when not set
+}
+
+type Task struct {
+	Name      string
+	RRule     string
+	Duration  string
+	NextStart *time.Time
+	DueDate   *time.Time
+	Error     error
+	FilePath  string
+	New       bool   // became active or due since the last --since-last-run
+	Snippet   string // first non-empty body line, shown with --snippet
+	Estimate  string // "est:" hint from the body of notes without a duration, shown with --body-hints
+	Series    *Position
+	Reminder  *Reminder // set for notes with remind_before
+	Progress  *int      // percent of the active window elapsed, shown with --progress
+	Stage     *Stage    // day (or hour) of the active window, shown with --progress
+	Tags      []string  // front matter tags, matched by --tag
+	Completed bool      // done for good, shown with --show-completed
+	Status    string    // StatusActive, StatusInactive, StatusError or StatusCompleted
+
+	// The resolved schedule, shown with --verbose: dtstart after defaults,
+	// the parsed duration, and the occurrence active now (nil when inactive)
+	Start  time.Time
+	Length CalendarDuration
+	Window *Occurrence
+
+	// Vault is the Obsidian vault holding the note, used for obsidian://
+	// links; nil outside a vault
+	Vault *VaultInfo
+
+	// Root is the notes directory the note was found under, when several
+	// are scanned; --group-by folder names folders relative to it
+	Root string
+
+	// Schedule is the note's schedule after defaults and Now the time it
+	// was evaluated at, as seen from the note, so output built after the
+	// scan needn't read the note again. Schedule is nil when the note
+	// can't be evaluated.
+	Schedule *FrontMatterWithDefaults
+	Now      time.Time
+}
+
+// NextOccurrence returns the first occurrence after the day of currentTime,
+// which for a recurrence anchored in the future is its first occurrence at or
+// after dtstart. It returns nil when the rule has no further occurrences.
+func NextOccurrence(fm *FrontMatterWithDefaults, currentTime time.Time) (*time.Time, error) {
+	if fm.RRule == "" {
+		return nil, nil
+	}
+
+	r, err := NewRecurrence(fm.RRule, fm.ExRule, fm.ExDates, fm.DTStart)
+	if err != nil {
+		return nil, err
+	}
+
+	if fm.Duration.Intraday() {
+		// Sub-day tasks keep their time of day, so a later slot today counts
+		next, err := r.After(currentTime, false)
+		if err != nil || next.IsZero() {
+			return nil, err
+		}
+		return &next, nil
+	}
+
+	today := currentTime.Truncate(24 * time.Hour)
+	next, err := r.After(today.Add(24*time.Hour), true)
+	if err != nil {
+		return nil, err
+	}
+	if next.IsZero() {
+		return nil, nil
+	}
+	next = DayOf(next)
+	return &next, nil
+}
+
+func getOneTimeDueDate(fm *FrontMatter) *time.Time {
+	if fm.DTStart == "" {
+		return nil
+	}
+
+	fmWithDefaults, err := ApplyDefaults(fm, noteNow(fm, Clock()))
+	if err != nil {
+		return nil
+	}
+	dueDate := oneTimeDueDate(fmWithDefaults)
+	return &dueDate
+}
+
+// oneTimeDueDate returns the day a one-time event is due: its deadline for
+// countdowns, otherwise the last day of its window
+func oneTimeDueDate(fm *FrontMatterWithDefaults) time.Time {
+	if fm.Countdown {
+		return DayOf(fm.DTStart)
+	}
+	_, end := OneTimeWindow(fm.DTStart, fm.Duration, false, fm.BusinessDays)
+	return lastDay(end)
+}
+
+// OneTimeWindow returns the active window of a one-time event: it starts at
+// dtstart, or for countdowns runs up to dtstart
+func OneTimeWindow(dtStart time.Time, duration CalendarDuration, countdown, businessDays bool) (time.Time, time.Time) {
+	if countdown {
+		return windowStart(dtStart, duration, businessDays), dtStart
+	}
+	return dtStart, WindowEnd(dtStart, duration, businessDays)
+}
+
+// isIntraday reports whether a duration is evaluated at time granularity
+// rather than in whole days (PT4H, P1DT2H)
+func isIntraday(duration time.Duration) bool {
+	return duration%(24*time.Hour) != 0
+}
+
+// IsOneTimeTaskActive checks if one-time task is active at given time
+func IsOneTimeTaskActive(fm *FrontMatterWithDefaults, currentTime time.Time) bool {
+	_, _, ok := CurrentActiveWindow(fm, currentTime)
+	return ok
+}
+
+// isOneTimeTaskActive wrapper for backward compatibility
+func isOneTimeTaskActive(fm *FrontMatter) bool {
+	if fm.DTStart == "" {
+		return false
+	}
+
+	today := noteNow(fm, Clock()).Truncate(24 * time.Hour)
+	duration, err := taskDuration(fm)
+	if err != nil {
+		return false
+	}
+
+	startDate, endDate := OneTimeWindow(parseStartDate(fm.DTStart), duration, fm.Countdown, usesBusinessDays(fm, duration))
+
+	// Check if today falls within the event's active window
+	return (today.Equal(startDate) || today.After(startDate)) && today.Before(endDate)
+}
+
+// ParseStartDate parses dtstart string with fallback, keeping any time of day
+func ParseStartDate(dtStartStr string, fallbackDate time.Time) time.Time {
+	if dtStartStr == "" {
+		return fallbackDate
+	}
+
+	// Try parsing common date formats
+	formats := append([]string{
+		"2006-01-02",
+		"2006-01-02T15:04:05Z",
+		"2006-01-02T15:04:05",
+		"2006-01-02T15:04",
+		"20060102T150405Z",
+		"20060102T150405",
+		"20060102",
+	}, coarseDateFormats...)
+
+	for _, format := range formats {
+		if t, err := time.Parse(format, dtStartStr); err == nil {
+			return t
+		}
+	}
+
+	// If parsing fails, use fallback
+	return fallbackDate
+}
+
+// coarseDateFormats are dtstart forms naming only a year or a month, which
+// expand to January 1st and the first of the month
+var coarseDateFormats = []string{"2006", "2006-01"}
+
+// isCoarseDate reports whether dtstart uses one of coarseDateFormats
+func isCoarseDate(dtStartStr string) bool {
+	for _, format := range coarseDateFormats {
+		if _, err := time.Parse(format, dtStartStr); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// parseStartDate wrapper for backward compatibility
+func parseStartDate(dtStartStr string) time.Time {
+	fallback := Clock().AddDate(-1, 0, 0).Truncate(24 * time.Hour)
+	return ParseStartDate(dtStartStr, fallback).Truncate(24 * time.Hour)
+}
+
+// ApplyDefaults applies default values to frontmatter
+func ApplyDefaults(fm *FrontMatter, currentTime time.Time) (*FrontMatterWithDefaults, error) {
+	fm, err := ResolveSchedule(fm)
+	if err != nil {
+		return nil, err
+	}
+	duration, err := taskDuration(fm)
+	if err != nil {
+		return nil, Categorize(ErrBadDuration, fmt.Errorf("duration parsing error: %w", err))
+	}
+	if fm.DTStart != "" && ParseStartDate(fm.DTStart, time.Time{}).IsZero() {
+		return nil, Categorize(ErrBadDTStart, fmt.Errorf("invalid dtstart %q", fm.DTStart))
+	}
+	if fm.TZ != "" {
+		if _, err := time.LoadLocation(fm.TZ); err != nil {
+			return nil, Categorize(ErrBadTimezone, fmt.Errorf("invalid tz %q: %w", fm.TZ, err))
+		}
+	}
+	if fm.DTStart == "" && hasCount(fm.RRule) {
+		// Counting from a fallback that moves every day would never finish
+		return nil, Categorize(ErrBadDTStart, fmt.Errorf("rrule with COUNT needs a dtstart to count from"))
+	}
+
+	fallbackStartDate := currentTime.AddDate(-1, 0, 0).Truncate(24 * time.Hour)
+	startDate := ParseStartDate(fm.DTStart, fallbackStartDate)
+	if !duration.Intraday() {
+		// Day-granularity tasks ignore the time of day, and so its zone
+		startDate = startDate.Truncate(24 * time.Hour)
+	} else if fm.DTStartTZID != "" {
+		location, err := time.LoadLocation(fm.DTStartTZID)
+		if err != nil {
+			return nil, Categorize(ErrBadDTStart, fmt.Errorf("invalid dtstart_tzid %q: %w", fm.DTStartTZID, err))
+		}
+		if !strings.HasSuffix(strings.ToUpper(fm.DTStart), "Z") {
+			// A floating dtstart is wall-clock time in the zone
+			startDate = time.Date(startDate.Year(), startDate.Month(), startDate.Day(),
+				startDate.Hour(), startDate.Minute(), startDate.Second(), 0, location)
+		}
+		startDate = startDate.In(location)
+	}
+	exDates, err := parseExDates(fm.ExDate, startDate)
+	if err != nil {
+		return nil, err
+	}
+	completed, err := parseCompleted(fm.Completed)
+	if err != nil {
+		return nil, err
+	}
+	if fm.RRule != "" {
+		// Fail here rather than in each query, so every caller sees the rule error
+		if _, err := NewRecurrence(fm.RRule, fm.ExRule, exDates, startDate); err != nil {
+			return nil, err
+		}
+	}
+
+	return &FrontMatterWithDefaults{
+		RRule:        fm.RRule,
+		ExRule:       fm.ExRule,
+		ExDates:      exDates,
+		Duration:     duration,
+		DTStart:      startDate,
+		Tags:         fm.Tags,
+		Countdown:    fm.Countdown,
+		BusinessDays: usesBusinessDays(fm, duration),
+		Completed:    completed,
+	}, nil
+}
+
+// parseExDates parses exdate entries into the instants they exclude. A bare
+// date takes dtstart's time of day and zone, so it matches that day's
+// occurrence, and a date-time without a Z takes dtstart's zone.
+func parseExDates(values []string, startDate time.Time) ([]time.Time, error) {
+	var exDates []time.Time
+	for _, value := range values {
+		date := ParseStartDate(value, time.Time{})
+		if date.IsZero() {
+			return nil, Categorize(ErrBadExDate, fmt.Errorf("invalid exdate %q", value))
+		}
+		if isDateOnly(value) {
+			date = time.Date(date.Year(), date.Month(), date.Day(),
+				startDate.Hour(), startDate.Minute(), startDate.Second(), 0, startDate.Location())
+		} else if !strings.HasSuffix(strings.ToUpper(value), "Z") {
+			date = AtZone(date, startDate.Location())
+		}
+		exDates = append(exDates, date)
+	}
+	return exDates, nil
+}
+
+// isDateOnly reports whether a date value has no time of day, as in
+// 2025-01-05 or the iCal form 20250105
+func isDateOnly(value string) bool {
+	for _, format := range []string{"2006-01-02", "20060102"} {
+		if _, err := time.Parse(format, value); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// hasCount reports whether a rule is limited by COUNT. Rules that don't
+// parse report false and fail later with a parse error.
+func hasCount(rule string) bool {
+	if rule == "" {
+		return false
+	}
+	r, err := newRRule(rule, time.Time{})
+	return err == nil && r.OrigOptions.Count > 0
+}
+
+// processFile reads and parses a note once, returning its task and whether
+// it is active now. The task is named by the note's title, or else its
+// cleaned file name. The task has an empty name when the file is not a task
+// note, and carries the error when the note can't be evaluated. Defaults are
+// applied once and the active occurrence is looked up once, so activity, due
+// date, progress and stage all come from the same window at the same now.
+// now is the scan's Clock reading and read its file reader.
+func processFile(path string, now time.Time, read func(string) ([]byte, error)) (Task, bool) {
+	filename := cleanFilename(filepath.Base(path))
+
+	fm, err := readFrontMatter(path, read)
+	if err != nil {
+		if !errors.Is(err, ErrNoFrontMatter) {
+			return Task{Name: filename, Error: err, FilePath: path}, false
+		}
+		return Task{}, false
+	}
+
+	for _, warning := range fm.Warnings {
+		Warnf("%s: %s", path, warning)
+	}
+	if title := strings.TrimSpace(fm.Title); title != "" {
+		filename = title
+	}
+	fm, err = ResolveSchedule(fm)
+	if err != nil {
+		return Task{Name: filename, Error: err, FilePath: path}, false
+	}
+	if isCoarseDate(fm.DTStart) {
+		Debugf("%s: dtstart %q expanded to %s", path, fm.DTStart, ParseStartDate(fm.DTStart, time.Time{}).Format("2006-01-02"))
+	}
+
+	if fm.RRule == "" && fm.DTStart == "" {
+		return Task{}, false
+	}
+	task := Task{Name: filename, RRule: fm.RRule, Duration: fm.Duration, FilePath: path, Snippet: firstBodyLine(fm.Body), Tags: fm.Tags}
+	if fm.RRule == "" {
+		task.RRule = "ONCE"
+	}
+
+	now = noteNow(fm, now)
+	fmWithDefaults, err := ApplyDefaults(fm, now)
+	if err != nil {
+		task.Error = err
+		return task, false
+	}
+	occurrence, active, err := activeOccurrence(fmWithDefaults, now)
+	if err != nil {
+		task.Error = err
+		return task, false
+	}
+	task.Schedule, task.Now = fmWithDefaults, now
+
+	if fm.RRule != "" {
+		task.NextStart, _ = NextOccurrence(fmWithDefaults, now)
+		task.Series, _ = SeriesPosition(fmWithDefaults, now)
+		if active {
+			dueDate := occurrence.DueDate()
+			task.DueDate = &dueDate
+		}
+	} else {
+		startDate, _ := OneTimeWindow(fmWithDefaults.DTStart, fmWithDefaults.Duration, fmWithDefaults.Countdown, fmWithDefaults.BusinessDays)
+		dueDate := oneTimeDueDate(fmWithDefaults)
+		task.NextStart, task.DueDate = &startDate, &dueDate
+	}
+
+	task.Completed = isCompleted(fm)
+	if active && !task.Completed && occurrenceCompleted(fmWithDefaults, occurrence) {
+		// The current occurrence is done; wait for the next one
+		active, task.DueDate = false, nil
+	}
+	if fm.Duration == "" {
+		task.Estimate = estimateHint(fm.Body)
+	}
+	task.Start, task.Length = fmWithDefaults.DTStart, fmWithDefaults.Duration
+	if active {
+		progress := occurrence.ElapsedPercent(now)
+		stage := occurrence.Stage(now)
+		task.Window, task.Progress, task.Stage = &occurrence, &progress, &stage
+	}
+	if fm.RemindBefore != "" {
+		task.Reminder, task.Error = taskReminder(fm.RemindBefore, fmWithDefaults, task)
+	}
+	return task, active && task.Error == nil
+}
+
+// IsTaskActive checks if task is active at given time
+func IsTaskActive(fm *FrontMatterWithDefaults, currentTime time.Time) (bool, error) {
+	if fm.RRule == "" && fm.DTStart.IsZero() {
+		return false, nil
+	}
+	_, _, ok, err := ActiveOccurrence(fm, currentTime)
+	return ok, err
+}
+
+// DefaultFilenamePrefix matches date prefixes like "2025-05-22 ",
+// "2025-05-22_" and "2025.05.22 "
+var DefaultFilenamePrefix = regexp.MustCompile(`^(\d{4}[-_.]\d{1,2}[-_.]\d{1,2}[\s_-]*)+`)
+
+// FilenamePrefix is what cleanFilename strips from the start of a note's
+// file name. It can be overridden with filename_prefix_regex in the config
+// file.
+var FilenamePrefix = DefaultFilenamePrefix
+
+// cleanFilename turns a note's file name into its task name, without the
+// FilenamePrefix and the .md extension
+func cleanFilename(filename string) string {
+	cleaned := FilenamePrefix.ReplaceAllString(filename, "")
+	cleaned = strings.TrimSuffix(cleaned, ".md")
+
+	return cleaned
+}
@@ -0,0 +1,679 @@
+package agenda
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIsTaskActive(t *testing.T) {
+	// Create temporary directory for test files
+	tempDir := t.TempDir()
+
+	// Evaluate as of Friday, September 26, 2025 (as in current output)
+	currentTime := time.Date(2025, 9, 26, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		frontMatter string
+		expected    bool
+		description string
+	}{
+		{
+			name: "monthly_task_active_1",
+			frontMatter: `---
+rrule: FREQ=MONTHLY;BYMONTHDAY=20
+duration: P10D
+dtstart: 2024-01-20
+---`,
+			expected:    true,
+			description: "Monthly task on 20th with 10-day duration should be active on Sep 26",
+		},
+		{
+			name: "monthly_task_active_2",
+			frontMatter: `---
+rrule: FREQ=MONTHLY;BYMONTHDAY=-5
+duration: P5D
+dtstart: 2024-01-26
+---`,
+			expected:    true,
+			description: "Monthly task on last 5th day with 5-day duration should be active on Sep 26",
+		},
+		{
+			name: "monthly_task_inactive_1",
+			frontMatter: `---
+rrule: FREQ=MONTHLY;BYMONTHDAY=12
+duration: P6D
+dtstart: 2024-01-12
+---`,
+			expected:    false,
+			description: "Monthly task on 12th with 6-day duration should be inactive on Sep 26",
+		},
+		{
+			name: "monthly_task_inactive_2",
+			frontMatter: `---
+rrule: FREQ=MONTHLY;BYMONTHDAY=1
+dtstart: 2024-01-01
+---`,
+			expected:    false,
+			description: "Monthly task on 1st with default duration should be inactive on Sep 26",
+		},
+		{
+			name: "monthly_task_inactive_3",
+			frontMatter: `---
+rrule: FREQ=MONTHLY;BYMONTHDAY=1
+duration: P3D
+dtstart: 2024-01-01
+---`,
+			expected:    false,
+			description: "Monthly task on 1st with 3-day duration should be inactive on Sep 26",
+		},
+		{
+			name: "weekly_task_should_be_active",
+			frontMatter: `---
+rrule: FREQ=WEEKLY;BYDAY=FR
+dtstart: 2024-01-05
+---`,
+			expected:    true,
+			description: "Weekly Friday task should be active on Friday Sep 26",
+		},
+		{
+			name: "one_time_task_inactive",
+			frontMatter: `---
+dtstart: 2025-10-18
+duration: P6D
+---`,
+			expected:    false,
+			description: "One-time task starting Oct 18 should be inactive on Sep 26",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Create temporary test file
+			testFile := filepath.Join(tempDir, tt.name+".md")
+			err := os.WriteFile(testFile, []byte(tt.frontMatter), 0644)
+			if err != nil {
+				t.Fatalf("Failed to create test file: %v", err)
+			}
+
+			// Test the function
+			fm, err := ReadFrontMatter(testFile)
+			if err != nil {
+				t.Fatalf("parseFrontMatter failed: %v", err)
+			}
+			fmWithDefaults, err := ApplyDefaults(fm, currentTime)
+			if err != nil {
+				t.Fatalf("ApplyDefaults failed: %v", err)
+			}
+			result, err := IsTaskActive(fmWithDefaults, currentTime)
+			if err != nil && tt.expected {
+				t.Errorf("%s: unexpected error: %v - %s", tt.name, err, tt.description)
+			}
+			if result != tt.expected {
+				t.Errorf("%s: expected %v, got %v - %s", tt.name, tt.expected, result, tt.description)
+			}
+		})
+	}
+}
+
+func TestPipeline_Integration(t *testing.T) {
+	// Test the full pipeline: ParseFrontMatter -> ApplyDefaults -> IsTaskActive
+	currentTime := time.Date(2025, 9, 26, 12, 0, 0, 0, time.UTC) // Friday, Sep 26, 2025
+
+	content := `---
+rrule: FREQ=WEEKLY;BYDAY=FR
+duration: P1D
+dtstart: 2024-01-05
+---
+
+# Weekly Friday Task`
+
+	// Step 1: Parse
+	fm, err := ParseFrontMatter(content)
+	if err != nil {
+		t.Fatalf("ParseFrontMatter failed: %v", err)
+	}
+
+	// Step 2: Apply defaults
+	fmWithDefaults, err := ApplyDefaults(fm, currentTime)
+	if err != nil {
+		t.Fatalf("ApplyDefaults failed: %v", err)
+	}
+
+	// Step 3: Check if active
+	isActive, err := IsTaskActive(fmWithDefaults, currentTime)
+	if err != nil {
+		t.Fatalf("IsTaskActive failed: %v", err)
+	}
+
+	// Should be active on Friday
+	if !isActive {
+		t.Errorf("Expected Friday task to be active on Friday, but got false")
+	}
+}
+
+func TestIsTaskActive_LowercaseRRule(t *testing.T) {
+	currentTime := time.Date(2025, 9, 26, 12, 0, 0, 0, time.UTC) // Friday
+
+	tests := []struct {
+		rrule     string
+		duration  string
+		expected  bool
+		expectErr bool
+	}{
+		{"freq=weekly;byday=fr", "P1D", true, false},
+		{"Freq=Weekly;ByDay=Mo", "P1D", false, false},
+		{"freq=monthly;bymonthday=20", "P10D", true, false},
+		{"freq=weeky;byday=fr", "P1D", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rrule, func(t *testing.T) {
+			fm := &FrontMatter{RRule: tt.rrule, Duration: tt.duration, DTStart: "2024-01-05"}
+			fmWithDefaults, err := ApplyDefaults(fm, currentTime)
+			if tt.expectErr {
+				// Bad rules are rejected up front
+				if err == nil {
+					t.Errorf("Expected error for %q, got none", tt.rrule)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ApplyDefaults failed: %v", err)
+			}
+
+			result, err := IsTaskActive(fmWithDefaults, currentTime)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("For %q: expected %v, got %v", tt.rrule, tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestIsTaskActive_SingleDay(t *testing.T) {
+	t.Cleanup(func() { DefaultDuration = dayDuration(1) })
+	DefaultDuration = dayDuration(7)
+
+	content := `---
+rrule: FREQ=MONTHLY;BYMONTHDAY=20
+dtstart: 2024-01-20
+single_day: true
+---`
+	fm, err := ParseFrontMatter(content)
+	if err != nil {
+		t.Fatalf("ParseFrontMatter failed: %v", err)
+	}
+
+	for day, expected := range map[int]bool{19: false, 20: true, 21: false} {
+		currentTime := time.Date(2025, 9, day, 12, 0, 0, 0, time.UTC)
+		fmWithDefaults, err := ApplyDefaults(fm, currentTime)
+		if err != nil {
+			t.Fatalf("ApplyDefaults failed: %v", err)
+		}
+		active, err := IsTaskActive(fmWithDefaults, currentTime)
+		if err != nil {
+			t.Fatalf("IsTaskActive failed: %v", err)
+		}
+		if active != expected {
+			t.Errorf("Sep %d: expected %v, got %v", day, expected, active)
+		}
+	}
+}
+
+func TestIsOneTimeTaskActive_Countdown(t *testing.T) {
+	content := `---
+dtstart: 2025-10-18
+duration: P6D
+countdown: true
+---`
+	fm, err := ParseFrontMatter(content)
+	if err != nil {
+		t.Fatalf("ParseFrontMatter failed: %v", err)
+	}
+	if !fm.Countdown {
+		t.Fatalf("Expected countdown to be parsed")
+	}
+
+	tests := []struct {
+		day      int
+		expected bool
+	}{
+		{11, false}, // before the run-up
+		{12, true},  // first day of the run-up (18 - 6)
+		{15, true},
+		{17, true},  // last day before the deadline
+		{18, false}, // the deadline itself ends the window
+		{20, false},
+	}
+
+	for _, tt := range tests {
+		currentTime := time.Date(2025, 10, tt.day, 12, 0, 0, 0, time.UTC)
+		fmWithDefaults, err := ApplyDefaults(fm, currentTime)
+		if err != nil {
+			t.Fatalf("ApplyDefaults failed: %v", err)
+		}
+		if active := IsOneTimeTaskActive(fmWithDefaults, currentTime); active != tt.expected {
+			t.Errorf("Oct %d: expected %v, got %v", tt.day, tt.expected, active)
+		}
+	}
+
+	expectedDue := time.Date(2025, 10, 18, 0, 0, 0, 0, time.UTC)
+	if due := getOneTimeDueDate(fm); due == nil || !due.Equal(expectedDue) {
+		t.Errorf("Expected countdown due date %v, got %v", expectedDue, due)
+	}
+}
+
+func TestNextOccurrence_FutureAnchored(t *testing.T) {
+	currentTime := time.Date(2025, 9, 26, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		fm       FrontMatter
+		expected time.Time
+	}{
+		{
+			name:     "monthly_anchored_next_month",
+			fm:       FrontMatter{RRule: "FREQ=MONTHLY;BYMONTHDAY=15", DTStart: "2025-11-15"},
+			expected: time.Date(2025, 11, 15, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "weekly_anchored_before_first_byday",
+			fm:       FrontMatter{RRule: "FREQ=WEEKLY;BYDAY=FR", DTStart: "2025-12-01"}, // a Monday
+			expected: time.Date(2025, 12, 5, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "anchored_more_than_a_year_ahead",
+			fm:       FrontMatter{RRule: "FREQ=YEARLY", DTStart: "2027-03-01"},
+			expected: time.Date(2027, 3, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fmWithDefaults, err := ApplyDefaults(&tt.fm, currentTime)
+			if err != nil {
+				t.Fatalf("ApplyDefaults failed: %v", err)
+			}
+
+			active, err := IsTaskActive(fmWithDefaults, currentTime)
+			if err != nil {
+				t.Fatalf("IsTaskActive failed: %v", err)
+			}
+			if active {
+				t.Errorf("Expected a recurrence anchored in the future to be inactive")
+			}
+
+			next, err := NextOccurrence(fmWithDefaults, currentTime)
+			if err != nil {
+				t.Fatalf("NextOccurrence failed: %v", err)
+			}
+			if next == nil || !next.Equal(tt.expected) {
+				t.Errorf("Expected next start %v, got %v", tt.expected, next)
+			}
+		})
+	}
+}
+
+func TestProcessFile_FutureAnchoredRecurring(t *testing.T) {
+	dtStart := time.Now().UTC().AddDate(0, 2, 0).Truncate(24 * time.Hour)
+	path := writeNote(t, t.TempDir(), "future.md",
+		"---\nrrule: FREQ=DAILY\ndtstart: "+dtStart.Format("2006-01-02")+"\n---\n")
+
+	task, active := processFile(path, Clock(), ReadFile)
+	if task.RRule != "FREQ=DAILY" {
+		t.Fatalf("Expected a recurring task, got %+v", task)
+	}
+	if task.NextStart == nil || !task.NextStart.Equal(dtStart) {
+		t.Errorf("Expected next start at dtstart %v, got %v", dtStart, task.NextStart)
+	}
+	if task.DueDate != nil {
+		t.Errorf("Expected no due date before the recurrence starts, got %v", task.DueDate)
+	}
+	if active || task.Error != nil {
+		t.Errorf("Expected inactive, got %v (err %v)", active, task.Error)
+	}
+}
+
+func TestIsTaskActive_SpanningMidnight(t *testing.T) {
+	content := `---
+rrule: FREQ=WEEKLY
+dtstart: 2024-01-05T22:00:00
+duration: PT4H
+---`
+	fm, err := ParseFrontMatter(content)
+	if err != nil {
+		t.Fatalf("ParseFrontMatter failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		at       time.Time
+		expected bool
+	}{
+		{"friday_before_window", time.Date(2025, 9, 26, 21, 59, 0, 0, time.UTC), false},
+		{"friday_window_start", time.Date(2025, 9, 26, 22, 0, 0, 0, time.UTC), true},
+		{"friday_late_night", time.Date(2025, 9, 26, 23, 0, 0, 0, time.UTC), true},
+		{"saturday_early_morning", time.Date(2025, 9, 27, 1, 0, 0, 0, time.UTC), true},
+		{"saturday_window_end", time.Date(2025, 9, 27, 2, 0, 0, 0, time.UTC), false},
+		{"saturday_midday", time.Date(2025, 9, 27, 12, 0, 0, 0, time.UTC), false},
+		{"thursday_late_night", time.Date(2025, 9, 25, 23, 0, 0, 0, time.UTC), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fmWithDefaults, err := ApplyDefaults(fm, tt.at)
+			if err != nil {
+				t.Fatalf("ApplyDefaults failed: %v", err)
+			}
+			active, err := IsTaskActive(fmWithDefaults, tt.at)
+			if err != nil {
+				t.Fatalf("IsTaskActive failed: %v", err)
+			}
+			if active != tt.expected {
+				t.Errorf("At %s: expected %v, got %v", tt.at.Format(time.RFC3339), tt.expected, active)
+			}
+		})
+	}
+}
+
+func TestIsOneTimeTaskActive_SpanningMidnight(t *testing.T) {
+	fm := &FrontMatter{DTStart: "2025-10-18T22:00:00", Duration: "PT4H"}
+
+	for at, expected := range map[time.Time]bool{
+		time.Date(2025, 10, 18, 21, 0, 0, 0, time.UTC): false,
+		time.Date(2025, 10, 18, 23, 0, 0, 0, time.UTC): true,
+		time.Date(2025, 10, 19, 1, 0, 0, 0, time.UTC):  true,
+		time.Date(2025, 10, 19, 3, 0, 0, 0, time.UTC):  false,
+	} {
+		fmWithDefaults, err := ApplyDefaults(fm, at)
+		if err != nil {
+			t.Fatalf("ApplyDefaults failed: %v", err)
+		}
+		if active := IsOneTimeTaskActive(fmWithDefaults, at); active != expected {
+			t.Errorf("At %s: expected %v, got %v", at.Format(time.RFC3339), expected, active)
+		}
+	}
+}
+
+func TestNextOccurrence_Intraday(t *testing.T) {
+	fm := &FrontMatter{RRule: "FREQ=DAILY", DTStart: "2025-01-01T09:00", Duration: "PT2H"}
+
+	for at, expected := range map[time.Time]time.Time{
+		time.Date(2025, 3, 10, 8, 0, 0, 0, time.UTC):  time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC),
+		time.Date(2025, 3, 10, 10, 0, 0, 0, time.UTC): time.Date(2025, 3, 11, 9, 0, 0, 0, time.UTC),
+		time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC): time.Date(2025, 3, 11, 9, 0, 0, 0, time.UTC),
+	} {
+		fmWithDefaults, err := ApplyDefaults(fm, at)
+		if err != nil {
+			t.Fatalf("ApplyDefaults failed: %v", err)
+		}
+		next, err := NextOccurrence(fmWithDefaults, at)
+		if err != nil {
+			t.Fatalf("NextOccurrence failed: %v", err)
+		}
+		if next == nil || !next.Equal(expected) {
+			t.Errorf("At %s: expected next start %v, got %v", at.Format(time.RFC3339), expected, next)
+		}
+	}
+}
+
+func TestProcessFile_IntradayOneTime(t *testing.T) {
+	now := time.Date(2025, 3, 10, 10, 0, 0, 0, time.UTC)
+	original := Clock
+	Clock = func() time.Time { return now }
+	t.Cleanup(func() { Clock = original })
+
+	path := writeNote(t, t.TempDir(), "call.md", "---\ndtstart: 2025-03-10T09:00\nduration: PT2H\n---\n")
+	task, active := processFile(path, Clock(), ReadFile)
+	if !active || task.Error != nil {
+		t.Fatalf("Expected the 9:00-11:00 event to be active at 10:00, got %v (err %v)", active, task.Error)
+	}
+	if start := time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC); task.NextStart == nil || !task.NextStart.Equal(start) {
+		t.Errorf("Expected start %v, got %v", start, task.NextStart)
+	}
+	if due := time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC); task.DueDate == nil || !task.DueDate.Equal(due) {
+		t.Errorf("Expected due date %v, got %v", due, task.DueDate)
+	}
+}
+
+func TestProcessFile_Schedule(t *testing.T) {
+	original := Clock
+	t.Cleanup(func() { Clock = original })
+	dir := t.TempDir()
+	path := writeNote(t, dir, "monday.md", "---\nrrule: FREQ=WEEKLY;BYDAY=MO\ndtstart: 2025-01-06\nduration: P2D\n---\n")
+
+	Clock = func() time.Time { return time.Date(2025, 12, 2, 12, 0, 0, 0, time.UTC) }
+	task, active := processFile(path, Clock(), ReadFile)
+	if !active {
+		t.Fatalf("Expected the task to be active on Tuesday, got %+v", task)
+	}
+	if !task.Start.Equal(time.Date(2025, 1, 6, 0, 0, 0, 0, time.UTC)) || task.Length.String() != "P2D" {
+		t.Errorf("Expected dtstart 2025-01-06 and duration P2D, got %v %s", task.Start, task.Length)
+	}
+	monday := time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC)
+	if task.Window == nil || !task.Window.Start.Equal(monday) || !task.Window.End.Equal(monday.AddDate(0, 0, 2)) {
+		t.Errorf("Expected the window [2025-12-01, 2025-12-03), got %+v", task.Window)
+	}
+
+	Clock = func() time.Time { return time.Date(2025, 12, 4, 12, 0, 0, 0, time.UTC) }
+	if task, active := processFile(path, Clock(), ReadFile); active || task.Window != nil || task.Start.IsZero() {
+		t.Errorf("Expected an inactive task with a dtstart and no window, got %+v", task)
+	}
+}
+
+func TestApplyDefaults_DayGranularityIgnoresTimeOfDay(t *testing.T) {
+	currentTime := time.Date(2025, 9, 26, 8, 0, 0, 0, time.UTC)
+	fm := &FrontMatter{RRule: "FREQ=WEEKLY", DTStart: "2024-01-05T22:00:00", Duration: "P1D"}
+
+	fmWithDefaults, err := ApplyDefaults(fm, currentTime)
+	if err != nil {
+		t.Fatalf("ApplyDefaults failed: %v", err)
+	}
+	if !fmWithDefaults.DTStart.Equal(time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected dtstart truncated to the day, got %v", fmWithDefaults.DTStart)
+	}
+	if active, err := IsTaskActive(fmWithDefaults, currentTime); err != nil || !active {
+		t.Errorf("Expected weekly day task to be active all Friday, got %v (err %v)", active, err)
+	}
+}
+
+func TestIsTaskActive_BusinessDays(t *testing.T) {
+	// Weekly on Fridays; days are counted from Friday 2025-09-26
+	friday := time.Date(2025, 9, 26, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		content  string
+		days     int
+		expected bool
+	}{
+		{"bd_friday", "rrule: FREQ=WEEKLY;BYDAY=FR\ndtstart: 2025-09-05\nduration: P3BD", 0, true},
+		{"bd_saturday", "rrule: FREQ=WEEKLY;BYDAY=FR\ndtstart: 2025-09-05\nduration: P3BD", 1, true},
+		{"bd_monday", "rrule: FREQ=WEEKLY;BYDAY=FR\ndtstart: 2025-09-05\nduration: P3BD", 3, true},
+		{"bd_tuesday", "rrule: FREQ=WEEKLY;BYDAY=FR\ndtstart: 2025-09-05\nduration: P3BD", 4, true},
+		{"bd_wednesday", "rrule: FREQ=WEEKLY;BYDAY=FR\ndtstart: 2025-09-05\nduration: P3BD", 5, false},
+		{"skip_weekends_tuesday", "rrule: FREQ=WEEKLY;BYDAY=FR\ndtstart: 2025-09-05\nduration: P3D\nskip_weekends: true", 4, true},
+		{"calendar_days_monday", "rrule: FREQ=WEEKLY;BYDAY=FR\ndtstart: 2025-09-05\nduration: P3D", 3, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fm, err := ParseFrontMatter("---\n" + tt.content + "\n---")
+			if err != nil {
+				t.Fatalf("ParseFrontMatter failed: %v", err)
+			}
+			currentTime := friday.AddDate(0, 0, tt.days)
+			fmWithDefaults, err := ApplyDefaults(fm, currentTime)
+			if err != nil {
+				t.Fatalf("ApplyDefaults failed: %v", err)
+			}
+			active, err := IsTaskActive(fmWithDefaults, currentTime)
+			if err != nil {
+				t.Fatalf("IsTaskActive failed: %v", err)
+			}
+			if active != tt.expected {
+				t.Errorf("%s: expected %v, got %v", currentTime.Format("Mon 2006-01-02"), tt.expected, active)
+			}
+		})
+	}
+}
+
+func TestNextOccurrence_CoarseDTStart(t *testing.T) {
+	// An unquoted year is a YAML integer and must still reach dtstart
+	content := `---
+rrule: FREQ=MONTHLY;INTERVAL=2
+dtstart: 2025
+duration: P1D
+---`
+	fm, err := ParseFrontMatter(content)
+	if err != nil {
+		t.Fatalf("ParseFrontMatter failed: %v", err)
+	}
+
+	currentTime := time.Date(2025, 2, 10, 12, 0, 0, 0, time.UTC)
+	fmWithDefaults, err := ApplyDefaults(fm, currentTime)
+	if err != nil {
+		t.Fatalf("ApplyDefaults failed: %v", err)
+	}
+	next, err := NextOccurrence(fmWithDefaults, currentTime)
+	if err != nil {
+		t.Fatalf("NextOccurrence failed: %v", err)
+	}
+	// Anchored at Jan 1, every other month falls on Mar 1
+	expected := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	if next == nil || !next.Equal(expected) {
+		t.Errorf("Expected next occurrence %v, got %v", expected, next)
+	}
+}
+
+func TestIsTaskActive_DSTSpringForward(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("tzdata unavailable: %v", err)
+	}
+
+	// Clocks in Berlin jump from 02:00 to 03:00 on 2025-03-30
+	fm := &FrontMatterWithDefaults{
+		RRule:    "FREQ=DAILY",
+		Duration: CalendarDuration{Duration: 4 * time.Hour},
+		DTStart:  time.Date(2025, 3, 28, 9, 0, 0, 0, berlin),
+	}
+
+	tests := []struct {
+		name     string
+		at       time.Time
+		expected bool
+	}{
+		{"before_start", time.Date(2025, 3, 30, 8, 59, 0, 0, berlin), false},
+		{"starts_at_nine", time.Date(2025, 3, 30, 9, 0, 0, 0, berlin), true},
+		{"late_morning", time.Date(2025, 3, 30, 12, 59, 0, 0, berlin), true},
+		{"ends_at_one", time.Date(2025, 3, 30, 13, 0, 0, 0, berlin), false},
+		{"day_before_ends_at_one", time.Date(2025, 3, 29, 13, 0, 0, 0, berlin), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			active, err := IsTaskActive(fm, tt.at.UTC())
+			if err != nil {
+				t.Fatalf("IsTaskActive failed: %v", err)
+			}
+			if active != tt.expected {
+				t.Errorf("At %s: expected %v, got %v", tt.at.Format(time.RFC3339), tt.expected, active)
+			}
+		})
+	}
+}
+
+func TestProcessFile_TZ(t *testing.T) {
+	now := time.Date(2025, 3, 10, 2, 0, 0, 0, time.UTC)
+	originalClock, originalZone := Clock, Timezone
+	Clock, Timezone = func() time.Time { return now }, time.UTC
+	t.Cleanup(func() { Clock, Timezone = originalClock, originalZone })
+
+	dir := t.TempDir()
+	if _, active := processFile(writeNote(t, dir, "utc.md", "---\ndtstart: 2025-03-10\n---\n"), Clock(), ReadFile); !active {
+		t.Errorf("Expected the task to be active on the 10th in UTC")
+	}
+	task, active := processFile(writeNote(t, dir, "ny.md", "---\ndtstart: 2025-03-10\ntz: America/New_York\n---\n"), Clock(), ReadFile)
+	if active || task.Error != nil {
+		t.Errorf("Expected the task to wait for the 10th in New York, got %v (err %v)", active, task.Error)
+	}
+	task, _ = processFile(writeNote(t, dir, "bad.md", "---\nrrule: FREQ=DAILY\ntz: Mars/Olympus\n---\n"), Clock(), ReadFile)
+	if ErrorCategory(task.Error) != ErrBadTimezone {
+		t.Errorf("Expected a tz error for an unknown tz, got %v", task.Error)
+	}
+}
+
+func TestProcessFile_BadRRule(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"typo.md":   "---\nrrule: FREQ=WEEKY\ndtstart: 2025-01-01\n---\n",
+		"exrule.md": "---\nrrule: FREQ=DAILY\nexrule: FREQ=WEEKLY;BYDAY=XX\n---\n",
+	} {
+		task, active := processFile(writeNote(t, dir, name, content), Clock(), ReadFile)
+		if active || ErrorCategory(task.Error) != ErrBadRRule {
+			t.Errorf("%s: expected a bad rrule error, got %v (active %v)", name, task.Error, active)
+			continue
+		}
+		if !strings.Contains(task.Error.Error(), "WEEKY") && !strings.Contains(task.Error.Error(), "XX") {
+			t.Errorf("%s: expected the error to quote the rule, got %v", name, task.Error)
+		}
+		if task.NextStart != nil || task.DueDate != nil {
+			t.Errorf("%s: expected no dates for a bad rule, got %v / %v", name, task.NextStart, task.DueDate)
+		}
+	}
+}
+
+func TestCleanFilename(t *testing.T) {
+	tests := []struct {
+		filename string
+		expected string
+	}{
+		{"2025-05-22 Pay rent.md", "Pay rent"},
+		{"2025_05_22_Pay rent.md", "Pay rent"},
+		{"2025.5.2 2025-05-03 Pay rent.md", "Pay rent"},
+		{"20250926 - Pay rent.md", "20250926 - Pay rent"},
+		{"Pay rent.md", "Pay rent"},
+	}
+	for _, tt := range tests {
+		if got := cleanFilename(tt.filename); got != tt.expected {
+			t.Errorf("%q: expected %q, got %q", tt.filename, tt.expected, got)
+		}
+	}
+}
+
+func TestCleanFilenameCustomPrefix(t *testing.T) {
+	original := FilenamePrefix
+	t.Cleanup(func() { FilenamePrefix = original })
+	FilenamePrefix = regexp.MustCompile(`^\d{8}\s*-\s*`)
+
+	if got := cleanFilename("20250926 - Pay rent.md"); got != "Pay rent" {
+		t.Errorf("Expected the custom prefix to be stripped, got %q", got)
+	}
+	if got := cleanFilename("2025-09-26 Pay rent.md"); got != "2025-09-26 Pay rent" {
+		t.Errorf("Expected the default prefix to be kept once overridden, got %q", got)
+	}
+}
+
+func TestProcessFile_Title(t *testing.T) {
+	dir := t.TempDir()
+	path := writeNote(t, dir, "2025-01-01 rent.md", "---\ntitle: \" Pay the rent \"\nrrule: FREQ=DAILY\n---\n")
+	untitled := writeNote(t, dir, "2025-01-01 water.md", "---\nrrule: FREQ=DAILY\n---\n")
+
+	task, _ := processFile(path, Clock(), ReadFile)
+	if task.Name != "Pay the rent" {
+		t.Errorf("Expected the title as the name, got %q", task.Name)
+	}
+	if task.FilePath != path {
+		t.Errorf("Expected the real file path %q, got %q", path, task.FilePath)
+	}
+	if task, _ := processFile(untitled, Clock(), ReadFile); task.Name != "water" {
+		t.Errorf("Expected the cleaned file name without a title, got %q", task.Name)
+	}
+}
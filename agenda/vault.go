@@ -0,0 +1,48 @@
+package agenda
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// VaultInfo names the Obsidian vault a notes directory belongs to
+type VaultInfo struct {
+	Name string
+	Path string
+}
+
+// DetectVault finds the vault containing notesDir: the nearest directory at
+// or above it with an .obsidian folder. It returns nil outside any vault.
+func DetectVault(notesDir string) *VaultInfo {
+	// Work on the absolute path, so a vault at or above the working
+	// directory is found and named
+	currentPath := notesDir
+	if absolute, err := filepath.Abs(notesDir); err == nil {
+		currentPath = absolute
+	}
+
+	for {
+		// Check if .obsidian folder exists in current directory
+		obsidianPath := filepath.Join(currentPath, ".obsidian")
+		if _, err := os.Stat(obsidianPath); err == nil {
+			// Found .obsidian folder, extract vault name from directory name
+			vaultName := filepath.Base(currentPath)
+			return &VaultInfo{
+				Name: vaultName,
+				Path: currentPath,
+			}
+		}
+
+		// Move up one directory
+		parentPath := filepath.Dir(currentPath)
+
+		// filepath.Dir returns its argument at the root, on every platform
+		if parentPath == currentPath {
+			break
+		}
+
+		currentPath = parentPath
+	}
+
+	return nil
+}
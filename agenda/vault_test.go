@@ -0,0 +1,42 @@
+package agenda
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetectVault_RelativePath(t *testing.T) {
+	vault := filepath.Join(t.TempDir(), "Second Brain")
+	notes := filepath.Join(vault, "projects", "home", "tasks")
+	if err := os.MkdirAll(filepath.Join(vault, ".obsidian"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(notes, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Relative paths used to stop at "." before reaching the vault
+	for _, dir := range []string{vault, filepath.Join(vault, "projects")} {
+		t.Run(filepath.Base(dir), func(t *testing.T) {
+			t.Chdir(dir)
+			relative, err := filepath.Rel(dir, notes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			info := DetectVault(relative)
+			if info == nil {
+				t.Fatalf("Expected the vault above %s to be found", relative)
+			}
+			// The working directory may be reported through symlinks
+			// resolved, as with macOS temp dirs
+			if _, err := os.Stat(filepath.Join(info.Path, ".obsidian")); info.Name != "Second Brain" || err != nil {
+				t.Errorf("Expected vault %q at %s, got %+v", "Second Brain", vault, info)
+			}
+		})
+	}
+
+	if info := DetectVault(t.TempDir()); info != nil {
+		t.Errorf("Expected no vault outside one, got %+v", info)
+	}
+}
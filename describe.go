@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/harnyk/obsidian-tasks/agenda"
+)
+
+// weekdayNames maps RRULE weekday codes to English names
+var weekdayNames = map[string]string{
+	"MO": "Monday", "TU": "Tuesday", "WE": "Wednesday", "TH": "Thursday",
+	"FR": "Friday", "SA": "Saturday", "SU": "Sunday",
+}
+
+// ordinalWords names the positions BYDAY prefixes commonly use
+var ordinalWords = map[int]string{1: "first", 2: "second", 3: "third", 4: "fourth", 5: "fifth"}
+
+// frequencyUnits gives each supported FREQ its adverb and plural unit
+var frequencyUnits = map[string][2]string{
+	"DAILY":   {"daily", "days"},
+	"WEEKLY":  {"weekly", "weeks"},
+	"MONTHLY": {"monthly", "months"},
+	"YEARLY":  {"yearly", "years"},
+}
+
+// DescribeRRule renders common rules in plain English, e.g.
+// FREQ=MONTHLY;BYMONTHDAY=-5 as "monthly on the 5th-to-last day". It returns
+// "" for rules using parts it can't describe, so callers fall back to the
+// raw rule.
+func DescribeRRule(rule string) string {
+	parts := map[string]string{}
+	for part := range strings.SplitSeq(agenda.NormalizeRRule(rule), ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return ""
+		}
+		parts[key] = value
+	}
+
+	units, ok := frequencyUnits[parts["FREQ"]]
+	if !ok {
+		return ""
+	}
+	description := units[0]
+	if interval := parts["INTERVAL"]; interval != "" && interval != "1" {
+		n, err := strconv.Atoi(interval)
+		if err != nil || n < 1 {
+			return ""
+		}
+		description = fmt.Sprintf("every %d %s", n, units[1])
+	}
+
+	for key := range parts {
+		switch key {
+		case "FREQ", "INTERVAL", "WKST", "BYDAY", "BYMONTHDAY", "BYMONTH", "COUNT", "UNTIL":
+		default:
+			return ""
+		}
+	}
+
+	// Phrases follow a fixed order whatever the order of the rule's parts
+	phrases := []struct {
+		key, separator string
+		describe       func(string) string
+	}{
+		{"BYDAY", " ", describeWeekdays},
+		{"BYMONTHDAY", " ", describeMonthDays},
+		{"BYMONTH", " ", describeMonths},
+		{"COUNT", ", ", describeCount},
+		{"UNTIL", ", ", describeUntil},
+	}
+	for _, p := range phrases {
+		value, ok := parts[p.key]
+		if !ok {
+			continue
+		}
+		phrase := p.describe(value)
+		if phrase == "" {
+			return ""
+		}
+		description += p.separator + phrase
+	}
+	return description
+}
+
+// describeCount renders a COUNT value: once, 5 times
+func describeCount(value string) string {
+	n, err := strconv.Atoi(value)
+	switch {
+	case err != nil || n < 1:
+		return ""
+	case n == 1:
+		return "once"
+	default:
+		return fmt.Sprintf("%d times", n)
+	}
+}
+
+// describeUntil renders an UNTIL value as its date
+func describeUntil(value string) string {
+	until := agenda.ParseStartDate(value, time.Time{})
+	if until.IsZero() {
+		return ""
+	}
+	return "until " + until.Format("2006-01-02")
+}
+
+// describeWeekdays renders a BYDAY value such as MO,WE or -1FR
+func describeWeekdays(value string) string {
+	switch value {
+	case "MO,TU,WE,TH,FR":
+		return "on weekdays"
+	case "SA,SU", "SU,SA":
+		return "on weekends"
+	}
+
+	var days []string
+	for code := range strings.SplitSeq(value, ",") {
+		name, ok := weekdayNames[code[max(len(code)-2, 0):]]
+		if !ok {
+			return ""
+		}
+		prefix := code[:len(code)-2]
+		if prefix == "" {
+			days = append(days, name)
+			continue
+		}
+		n, err := strconv.Atoi(prefix)
+		if err != nil {
+			return ""
+		}
+		position := positionWord(n)
+		if position == "" {
+			return ""
+		}
+		days = append(days, "the "+position+" "+name)
+	}
+	return "on " + joinWords(days)
+}
+
+// describeMonthDays renders a BYMONTHDAY value such as 1,15 or -5
+func describeMonthDays(value string) string {
+	var days []string
+	for day := range strings.SplitSeq(value, ",") {
+		n, err := strconv.Atoi(day)
+		switch {
+		case err != nil || n == 0 || n > 31 || n < -31:
+			return ""
+		case n == -1:
+			days = append(days, "last day")
+		case n < 0:
+			days = append(days, ordinalNumber(-n)+"-to-last day")
+		default:
+			days = append(days, ordinalNumber(n))
+		}
+	}
+	return "on the " + joinWords(days)
+}
+
+// describeMonths renders a BYMONTH value such as 3 or 3,9
+func describeMonths(value string) string {
+	var months []string
+	for month := range strings.SplitSeq(value, ",") {
+		n, err := strconv.Atoi(month)
+		if err != nil || n < 1 || n > 12 {
+			return ""
+		}
+		months = append(months, time.Month(n).String())
+	}
+	return "in " + joinWords(months)
+}
+
+// positionWord names a BYDAY position: first, second, last, second-to-last
+func positionWord(n int) string {
+	switch {
+	case n == -1:
+		return "last"
+	case n < 0:
+		if word, ok := ordinalWords[-n]; ok {
+			return word + "-to-last"
+		}
+		return ""
+	default:
+		return ordinalWords[n]
+	}
+}
+
+// ordinalNumber renders 1 as 1st, 22 as 22nd, 13 as 13th
+func ordinalNumber(n int) string {
+	suffix := "th"
+	if n%100 < 11 || n%100 > 13 {
+		switch n % 10 {
+		case 1:
+			suffix = "st"
+		case 2:
+			suffix = "nd"
+		case 3:
+			suffix = "rd"
+		}
+	}
+	return strconv.Itoa(n) + suffix
+}
+
+// joinWords lists words as "a", "a and b" or "a, b and c"
+func joinWords(words []string) string {
+	if len(words) <= 1 {
+		return strings.Join(words, "")
+	}
+	return strings.Join(words[:len(words)-1], ", ") + " and " + words[len(words)-1]
+}
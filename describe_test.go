@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/harnyk/obsidian-tasks/agenda"
+)
+
+func TestDescribeRRule(t *testing.T) {
+	tests := []struct {
+		rule     string
+		expected string
+	}{
+		{"FREQ=DAILY", "daily"},
+		{"FREQ=DAILY;INTERVAL=3", "every 3 days"},
+		{"FREQ=WEEKLY;BYDAY=MO", "weekly on Monday"},
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE,FR", "every 2 weeks on Monday, Wednesday and Friday"},
+		{"FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR", "weekly on weekdays"},
+		{"FREQ=MONTHLY;BYMONTHDAY=1", "monthly on the 1st"},
+		{"FREQ=MONTHLY;BYMONTHDAY=-5", "monthly on the 5th-to-last day"},
+		{"FREQ=MONTHLY;BYMONTHDAY=-1", "monthly on the last day"},
+		{"FREQ=MONTHLY;BYMONTHDAY=1,15,22", "monthly on the 1st, 15th and 22nd"},
+		{"FREQ=MONTHLY;BYDAY=-1FR", "monthly on the last Friday"},
+		{"FREQ=MONTHLY;BYDAY=2TU", "monthly on the second Tuesday"},
+		{"FREQ=YEARLY;BYMONTH=3;BYMONTHDAY=10", "yearly on the 10th in March"},
+		{"FREQ=DAILY;COUNT=5", "daily, 5 times"},
+		{"FREQ=WEEKLY;BYDAY=SA;UNTIL=20251231T000000Z", "weekly on Saturday, until 2025-12-31"},
+		{"rrule:freq=daily;count=1", "daily, once"},
+		{"FREQ=WEEKLY;WKST=SU;BYDAY=SU", "weekly on Sunday"},
+		// Unsupported patterns fall back to the raw rule
+		{"FREQ=HOURLY", ""},
+		{"FREQ=MONTHLY;BYSETPOS=-1;BYDAY=MO,TU,WE,TH,FR", ""},
+		{"FREQ=MONTHLY;BYDAY=7MO", ""},
+		{"FREQ=DAILY;INTERVAL=x", ""},
+		{"not a rule", ""},
+	}
+
+	for _, tt := range tests {
+		if got := DescribeRRule(tt.rule); got != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.rule, tt.expected, got)
+		}
+	}
+}
+
+func TestOrdinalNumber(t *testing.T) {
+	for n, expected := range map[int]string{1: "1st", 2: "2nd", 3: "3rd", 4: "4th", 11: "11th", 12: "12th", 13: "13th", 21: "21st", 23: "23rd"} {
+		if got := ordinalNumber(n); got != expected {
+			t.Errorf("%d: expected %s, got %s", n, expected, got)
+		}
+	}
+}
+
+func TestPrintTaskLinesDescribeRRule(t *testing.T) {
+	originalNoColor := color.NoColor
+	color.NoColor = true
+	t.Cleanup(func() { color.NoColor = originalNoColor })
+
+	tasks := []agenda.Task{
+		{Name: "Meters", RRule: "FREQ=MONTHLY;BYMONTHDAY=-5", Duration: "P5D"},
+		{Name: "Odd", RRule: "FREQ=HOURLY"},
+	}
+	var out strings.Builder
+	printTaskLines(&out, tasks, "  - ", 0, color.FgGreen, Options{DescribeRRule: true})
+
+	expected := "  - Meters (FREQ=MONTHLY;BYMONTHDAY=-5 [monthly on the 5th-to-last day], P5D)\n  - Odd (FREQ=HOURLY)\n"
+	if out.String() != expected {
+		t.Errorf("Expected:\n%q\ngot:\n%q", expected, out.String())
+	}
+}
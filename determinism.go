@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/harnyk/obsidian-tasks/agenda"
+)
+
+// taskFingerprint summarizes what a scan computed for one note, for
+// comparing scans
+func taskFingerprint(task agenda.Task, status string) string {
+	fingerprint := fmt.Sprintf("%s, next %s, due %s", status, formatDate(task.NextStart), formatDate(task.DueDate))
+	if task.Error != nil {
+		fingerprint += ", error " + task.Error.Error()
+	}
+	return fingerprint
+}
+
+// scanFingerprints maps each note of a scan to its fingerprint
+func scanFingerprints(result agenda.ScanResult) map[string]string {
+	fingerprints := map[string]string{}
+	for status, tasks := range map[string][]agenda.Task{
+		agenda.StatusActive:    result.Active,
+		agenda.StatusInactive:  result.Inactive,
+		agenda.StatusError:     result.Errored,
+		agenda.StatusCompleted: result.Completed,
+	} {
+		for _, task := range tasks {
+			fingerprints[task.FilePath] = taskFingerprint(task, status)
+		}
+	}
+	return fingerprints
+}
+
+// compareScans lists the notes two scans disagree about, sorted by path, as
+// "path: first -> second" lines. Notes only one scan found show "missing".
+func compareScans(first, second agenda.ScanResult) []string {
+	a, b := scanFingerprints(first), scanFingerprints(second)
+	var paths []string
+	for path := range a {
+		paths = append(paths, path)
+	}
+	for path := range b {
+		if _, ok := a[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	slices.Sort(paths)
+
+	var differences []string
+	for _, path := range paths {
+		before, ok := a[path]
+		if !ok {
+			before = "missing"
+		}
+		after, ok := b[path]
+		if !ok {
+			after = "missing"
+		}
+		if before != after {
+			differences = append(differences, fmt.Sprintf("%s: %s -> %s", path, before, after))
+		}
+	}
+	return differences
+}
+
+// runDeterministicCheck scans roots twice with the clock frozen and reports
+// every note classified differently, returning the exit code
+func runDeterministicCheck(ctx context.Context, w io.Writer, roots []string, opts Options) int {
+	frozen := agenda.Clock()
+	original := agenda.Clock
+	agenda.Clock = func() time.Time { return frozen }
+	defer func() { agenda.Clock = original }()
+
+	var results [2]agenda.ScanResult
+	for i := range results {
+		result, err := scanRoots(ctx, roots, opts)
+		if err != nil {
+			fmt.Fprintln(w, "Walk error:", err)
+			return 1
+		}
+		results[i] = result
+	}
+
+	differences := compareScans(results[0], results[1])
+	for _, difference := range differences {
+		fmt.Fprintln(w, difference)
+	}
+	if len(differences) > 0 {
+		fmt.Fprintf(w, "%d of %d tasks differ between scans at %s\n", len(differences), results[0].TasksFound, frozen.Format(time.RFC3339))
+		return 1
+	}
+	fmt.Fprintf(w, "Scans identical: %d tasks at %s\n", results[0].TasksFound, frozen.Format(time.RFC3339))
+	return 0
+}
+
+// formatDate renders an optional date as YYYY-MM-DD, or "" when unset
+func formatDate(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format("2006-01-02")
+}
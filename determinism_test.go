@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/harnyk/obsidian-tasks/agenda"
+)
+
+func TestCompareScans(t *testing.T) {
+	due := time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC)
+	later := due.AddDate(0, 0, 1)
+	first := agenda.ScanResult{
+		Active:   []agenda.Task{{FilePath: "/v/A.md", DueDate: &due}, {FilePath: "/v/B.md", DueDate: &due}},
+		Inactive: []agenda.Task{{FilePath: "/v/C.md", NextStart: &due}},
+		Errored:  []agenda.Task{{FilePath: "/v/D.md", Error: errors.New("bad")}},
+	}
+	second := agenda.ScanResult{
+		Active:   []agenda.Task{{FilePath: "/v/B.md", DueDate: &later}, {FilePath: "/v/A.md", DueDate: &due}},
+		Inactive: []agenda.Task{{FilePath: "/v/C.md", NextStart: &due}, {FilePath: "/v/E.md", NextStart: &due}},
+		Errored:  []agenda.Task{{FilePath: "/v/D.md", Error: errors.New("bad")}},
+	}
+
+	if differences := compareScans(first, first); len(differences) != 0 {
+		t.Errorf("Expected identical scans to match, got %v", differences)
+	}
+	expected := []string{
+		"/v/B.md: active, next , due 2025-03-03 -> active, next , due 2025-03-04",
+		"/v/E.md: missing -> inactive, next 2025-03-03, due ",
+	}
+	if got := compareScans(first, second); strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestRunDeterministicCheck(t *testing.T) {
+	dir := t.TempDir()
+	writeNote(t, dir, "Daily.md", "---\nrrule: FREQ=DAILY\nduration: P1D\n---\n")
+	writeNote(t, dir, "Flaky.md", "---\nrrule: FREQ=WEEKLY;BYDAY=MO\nduration: P1D\n---\n")
+
+	var out strings.Builder
+	if code := runDeterministicCheck(context.Background(), &out, []string{dir}, Options{}); code != 0 {
+		t.Fatalf("Expected stable scans to pass, got %d:\n%s", code, out.String())
+	}
+	if !strings.Contains(out.String(), "Scans identical: 2 tasks") {
+		t.Errorf("Unexpected output:\n%s", out.String())
+	}
+
+	// A note whose content changes between scans, each reading it once
+	origReadFile := agenda.ReadFile
+	t.Cleanup(func() { agenda.ReadFile = origReadFile })
+	reads := 0
+	agenda.ReadFile = func(name string) ([]byte, error) {
+		if filepath.Base(name) == "Flaky.md" {
+			reads++
+			if reads > 1 {
+				return []byte("---\nrrule: FREQ=NEVER\n---\n"), nil
+			}
+		}
+		return os.ReadFile(name)
+	}
+
+	out.Reset()
+	if code := runDeterministicCheck(context.Background(), &out, []string{dir}, Options{}); code != 1 {
+		t.Fatalf("Expected a difference to fail the check, got %d", code)
+	}
+	if !strings.Contains(out.String(), "Flaky.md") || strings.Contains(out.String(), "Daily.md") {
+		t.Errorf("Expected only the flaky note to be reported:\n%s", out.String())
+	}
+}
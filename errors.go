@@ -0,0 +1,39 @@
+package main
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/harnyk/obsidian-tasks/agenda"
+)
+
+// errorGroup is the errored tasks of one category
+type errorGroup struct {
+	Name  string
+	Tasks []agenda.Task
+}
+
+// groupErrors splits errored tasks by category, in errorCategories order
+// followed by uncategorized errors. Empty categories are left out and tasks
+// keep their order within a group.
+func groupErrors(tasks []agenda.Task) []errorGroup {
+	byCategory := map[error][]agenda.Task{}
+	for _, task := range tasks {
+		category := agenda.ErrorCategory(task.Error)
+		byCategory[category] = append(byCategory[category], task)
+	}
+
+	var groups []errorGroup
+	for _, category := range slices.Concat(agenda.ErrorCategories, []error{nil}) {
+		if len(byCategory[category]) == 0 {
+			continue
+		}
+		name := "Other"
+		if category != nil {
+			name = category.Error()
+			name = strings.ToUpper(name[:1]) + name[1:]
+		}
+		groups = append(groups, errorGroup{Name: name, Tasks: byCategory[category]})
+	}
+	return groups
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/harnyk/obsidian-tasks/agenda"
+)
+
+func TestGroupErrorsByCategory(t *testing.T) {
+	dir := t.TempDir()
+	writeNote(t, dir, "Rule 1.md", "---\nrrule: FREQ=SOMETIMES\nduration: P1D\n---\n")
+	writeNote(t, dir, "Rule 2.md", "---\nrrule: FREQ=WEEKLY;BYDAY=XX\nduration: P1D\n---\n")
+	writeNote(t, dir, "Length.md", "---\nrrule: FREQ=DAILY\nduration: P1X\n---\n")
+	writeNote(t, dir, "Start.md", "---\nrrule: FREQ=DAILY\ndtstart: next tuesday\nduration: P1D\n---\n")
+	writeNote(t, dir, "Yaml.md", "---\nrrule: [unclosed\n---\n")
+	writeNote(t, dir, "Unreadable.md", "---\nrrule: FREQ=DAILY\n---\n")
+	writeNote(t, dir, "Schedule.md", "---\nschedule: nope\n---\n")
+
+	origReadFile := agenda.ReadFile
+	t.Cleanup(func() { agenda.ReadFile = origReadFile })
+	agenda.ReadFile = func(name string) ([]byte, error) {
+		if filepath.Base(name) == "Unreadable.md" {
+			return nil, os.ErrPermission
+		}
+		return os.ReadFile(name)
+	}
+
+	result, err := agenda.ScanNotes(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("scanNotes failed: %v", err)
+	}
+	sortTasks(result.Errored, "file", false)
+
+	expected := map[string][]string{
+		"Bad rrule":    {"Rule 1", "Rule 2"},
+		"Bad duration": {"Length"},
+		"Bad dtstart":  {"Start"},
+		"YAML error":   {"Yaml"},
+		"IO error":     {"Unreadable"},
+		"Other":        {"Schedule"},
+	}
+	order := []string{"Bad rrule", "Bad duration", "Bad dtstart", "YAML error", "IO error", "Other"}
+
+	groups := groupErrors(result.Errored)
+	if len(groups) != len(order) {
+		t.Fatalf("Expected %d groups, got %+v", len(order), groups)
+	}
+	for i, group := range groups {
+		if group.Name != order[i] {
+			t.Errorf("Group %d: expected %s, got %s", i, order[i], group.Name)
+		}
+		var names []string
+		for _, task := range group.Tasks {
+			names = append(names, task.Name)
+		}
+		if strings.Join(names, ",") != strings.Join(expected[group.Name], ",") {
+			t.Errorf("%s: expected %v, got %v", group.Name, expected[group.Name], names)
+		}
+	}
+}
+
+func TestPrintTasksWithErrorsGrouped(t *testing.T) {
+	originalNoColor := color.NoColor
+	color.NoColor = true
+	t.Cleanup(func() { color.NoColor = originalNoColor })
+
+	tasks := []agenda.Task{
+		{Name: "A", RRule: "FREQ=X", Error: agenda.Categorize(agenda.ErrBadRRule, errors.New("RRULE parsing error: bad"))},
+		{Name: "B", Error: agenda.Categorize(agenda.ErrYAML, errors.New("YAML parsing error: bad"))},
+		{Name: "C", RRule: "FREQ=Y", Error: agenda.Categorize(agenda.ErrBadRRule, errors.New("RRULE parsing error: worse"))},
+	}
+	var out strings.Builder
+	printTasksWithErrors(&out, "Tasks with syntax errors", tasks, color.FgRed, Options{})
+
+	expected := "\nTasks with syntax errors (3):\n" +
+		"  Bad rrule (2):\n" +
+		"    - A (FREQ=X) ❌ RRULE parsing error: bad\n" +
+		"    - C (FREQ=Y) ❌ RRULE parsing error: worse\n" +
+		"  YAML error (1):\n" +
+		"    - B ❌ YAML parsing error: bad\n"
+	if out.String() != expected {
+		t.Errorf("Expected:\n%q\ngot:\n%q", expected, out.String())
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/harnyk/obsidian-tasks/agenda"
+)
+
+// Task kinds distinguished by --only-recurring and --only-onetime
+const (
+	kindRecurring = "recurring"
+	kindOneTime   = "onetime"
+)
+
+// taskKind reports whether a task recurs or happens once, or "" when its
+// schedule is unknown (e.g. its front matter failed to parse)
+func taskKind(task agenda.Task) string {
+	switch task.RRule {
+	case "":
+		return ""
+	case "ONCE":
+		return kindOneTime
+	default:
+		return kindRecurring
+	}
+}
+
+// matchesFilters reports whether a task with the given walkTasks status
+// passes the filters selected in opts. Tasks of unknown kind always pass, so
+// parse errors stay visible.
+func matchesFilters(task agenda.Task, status string, opts Options) bool {
+	if status == agenda.StatusCompleted && !opts.ShowCompleted {
+		return false
+	}
+	if opts.OnlyStatus != "" && status != opts.OnlyStatus {
+		return false
+	}
+	kind := taskKind(task)
+	if opts.OnlyRecurring && kind == kindOneTime {
+		return false
+	}
+	if opts.OnlyOneTime && kind == kindRecurring {
+		return false
+	}
+	if len(opts.Tags) > 0 && kind != "" && !matchesTags(task.Tags, opts.Tags, opts.TagMatch == tagMatchAny) {
+		return false
+	}
+	if opts.DueIn != "" && kind != "" && !dueWithin(task, status, opts.DueDays, agenda.Clock()) {
+		return false
+	}
+	return true
+}
+
+// dueWithin reports whether an active task is due, or an inactive one next
+// starts, no more than days days after now's day. Tasks without that date
+// never are.
+func dueWithin(task agenda.Task, status string, days int, now time.Time) bool {
+	date := task.DueDate
+	if status == agenda.StatusInactive {
+		date = task.NextStart
+	}
+	if date == nil {
+		return false
+	}
+	return !agenda.DayOf(*date).After(agenda.DayOf(now).AddDate(0, 0, days))
+}
+
+// Ways --tag-match combines several --tag filters
+const (
+	tagMatchAll = "all"
+	tagMatchAny = "any"
+)
+
+// normalizeTag lowercases a tag and drops a leading #, so #Work matches work
+func normalizeTag(tag string) string {
+	return strings.TrimPrefix(strings.ToLower(strings.TrimSpace(tag)), "#")
+}
+
+// matchesTags reports whether tags contain all of wanted, or with matchAny
+// at least one of them
+func matchesTags(tags, wanted []string, matchAny bool) bool {
+	normalized := make([]string, len(tags))
+	for i, tag := range tags {
+		normalized[i] = normalizeTag(tag)
+	}
+	for _, tag := range wanted {
+		found := slices.Contains(normalized, normalizeTag(tag))
+		if found && matchAny {
+			return true
+		}
+		if !found && !matchAny {
+			return false
+		}
+	}
+	return !matchAny
+}
+
+// filterTasks returns the tasks of one status that pass the filters
+// selected in opts
+func filterTasks(tasks []agenda.Task, status string, opts Options) []agenda.Task {
+	var kept []agenda.Task
+	for _, task := range tasks {
+		if matchesFilters(task, status, opts) {
+			kept = append(kept, task)
+		}
+	}
+	return kept
+}
+
+// scanFiltered scans root and drops the tasks excluded by the filters in opts
+func scanFiltered(ctx context.Context, root string, opts Options) (agenda.ScanResult, error) {
+	result, err := agenda.ScanNotes(ctx, root)
+	result.Active = filterTasks(result.Active, agenda.StatusActive, opts)
+	result.Inactive = filterTasks(result.Inactive, agenda.StatusInactive, opts)
+	result.Errored = filterTasks(result.Errored, agenda.StatusError, opts)
+	result.Completed = filterTasks(result.Completed, agenda.StatusCompleted, opts)
+	return result, err
+}
+
+// scanRoots is scanFiltered over several notes directories, merged into
+// one result. Each task records the vault detected for its own directory.
+func scanRoots(ctx context.Context, roots []string, opts Options) (agenda.ScanResult, error) {
+	var merged agenda.ScanResult
+	for _, root := range roots {
+		result, err := scanFiltered(ctx, root, opts)
+		vault := agenda.DetectVault(root)
+		for _, tasks := range [][]agenda.Task{result.Active, result.Inactive, result.Errored, result.Completed} {
+			for i := range tasks {
+				tasks[i].Root = root
+				if vault != nil {
+					tasks[i].Vault = vault
+				}
+			}
+		}
+		merged.Merge(result)
+		if err != nil {
+			return merged, err
+		}
+	}
+	return merged, nil
+}
+
+// walkRoots streams the tasks of several notes directories that pass the
+// filters to visit, with the same Root and Vault that scanRoots sets
+func walkRoots(ctx context.Context, roots []string, opts Options, visit func(task agenda.Task, status string)) error {
+	for _, root := range roots {
+		vault := agenda.DetectVault(root)
+		if _, err := agenda.WalkTasks(ctx, root, func(task agenda.Task, status string) {
+			if !matchesFilters(task, status, opts) {
+				return
+			}
+			task.Root = root
+			if vault != nil {
+				task.Vault = vault
+			}
+			visit(task, status)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/harnyk/obsidian-tasks/agenda"
+)
+
+func TestFilterTasks_Kind(t *testing.T) {
+	tasks := []agenda.Task{
+		{Name: "daily", RRule: "FREQ=DAILY"},
+		{Name: "trip", RRule: "ONCE"},
+		{Name: "broken", Error: errors.New("YAML parsing error")},
+	}
+
+	names := func(tasks []agenda.Task) []string {
+		var names []string
+		for _, task := range tasks {
+			names = append(names, task.Name)
+		}
+		return names
+	}
+
+	tests := []struct {
+		name     string
+		opts     Options
+		expected []string
+	}{
+		{"no_filter", Options{}, []string{"daily", "trip", "broken"}},
+		{"only_recurring", Options{OnlyRecurring: true}, []string{"daily", "broken"}},
+		{"only_onetime", Options{OnlyOneTime: true}, []string{"trip", "broken"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := names(filterTasks(tasks, agenda.StatusActive, tt.opts))
+			if len(got) != len(tt.expected) {
+				t.Fatalf("Expected %v, got %v", tt.expected, got)
+			}
+			for i := range got {
+				if got[i] != tt.expected[i] {
+					t.Errorf("Expected %v, got %v", tt.expected, got)
+				}
+			}
+		})
+	}
+}
+
+func TestScanFiltered(t *testing.T) {
+	dir := t.TempDir()
+	writeNote(t, dir, "daily.md", "---\nrrule: FREQ=DAILY\n---\n")
+	writeNote(t, dir, "later.md", "---\ndtstart: 2999-01-01\n---\n")
+
+	result, err := scanFiltered(context.Background(), dir, Options{OnlyRecurring: true})
+	if err != nil {
+		t.Fatalf("scanFiltered failed: %v", err)
+	}
+	if len(result.Active) != 1 || len(result.Inactive) != 0 {
+		t.Errorf("--only-recurring: expected only the daily task, got %+v / %+v", result.Active, result.Inactive)
+	}
+
+	result, err = scanFiltered(context.Background(), dir, Options{OnlyOneTime: true})
+	if err != nil {
+		t.Fatalf("scanFiltered failed: %v", err)
+	}
+	if len(result.Active) != 0 || len(result.Inactive) != 1 {
+		t.Errorf("--only-onetime: expected only the one-time task, got %+v / %+v", result.Active, result.Inactive)
+	}
+}
+
+func TestParseFlagsOnlyKindExclusive(t *testing.T) {
+	if _, err := parseFlags([]string{"--only-recurring", "--only-onetime"}); err == nil {
+		t.Errorf("Expected error when both kind filters are set")
+	}
+}
+
+func TestMatchesTags(t *testing.T) {
+	tags := []string{"Work", "#urgent"}
+	tests := []struct {
+		wanted   []string
+		matchAny bool
+		expected bool
+	}{
+		{[]string{"work"}, false, true},
+		{[]string{"#WORK", "urgent"}, false, true},
+		{[]string{"work", "home"}, false, false},
+		{[]string{"work", "home"}, true, true},
+		{[]string{"home"}, true, false},
+	}
+	for _, tt := range tests {
+		if got := matchesTags(tags, tt.wanted, tt.matchAny); got != tt.expected {
+			t.Errorf("%v (any %v): expected %v, got %v", tt.wanted, tt.matchAny, tt.expected, got)
+		}
+	}
+}
+
+func TestScanFilteredTags(t *testing.T) {
+	dir := t.TempDir()
+	writeNote(t, dir, "work.md", "---\nrrule: FREQ=DAILY\ntags: [rrule, work]\n---\n")
+	writeNote(t, dir, "home.md", "---\nrrule: FREQ=DAILY\ntags: [rrule, Home]\n---\n")
+	writeNote(t, dir, "untagged.md", "---\ndtstart: 2999-01-01\n---\n")
+	writeNote(t, dir, "broken.md", "---\nrrule: [\n---\n")
+
+	result, err := scanFiltered(context.Background(), dir, Options{Tags: stringList{"#work"}, TagMatch: tagMatchAll})
+	if err != nil {
+		t.Fatalf("scanFiltered failed: %v", err)
+	}
+	if len(result.Active) != 1 || result.Active[0].Name != "work" || len(result.Inactive) != 0 {
+		t.Errorf("--tag work: expected only the work task, got %+v / %+v", result.Active, result.Inactive)
+	}
+	// Notes whose front matter can't be read stay visible
+	if len(result.Errored) != 1 {
+		t.Errorf("--tag work: expected the broken note to stay visible, got %+v", result.Errored)
+	}
+
+	result, err = scanFiltered(context.Background(), dir, Options{Tags: stringList{"work", "home"}, TagMatch: tagMatchAny})
+	if err != nil {
+		t.Fatalf("scanFiltered failed: %v", err)
+	}
+	if len(result.Active) != 2 || len(result.Inactive) != 0 {
+		t.Errorf("--tag work --tag home --tag-match any: expected both tagged tasks, got %+v / %+v", result.Active, result.Inactive)
+	}
+}
+
+func TestParseFlagsTagMatch(t *testing.T) {
+	opts, err := parseFlags([]string{"--tag", "work", "--tag", "#home"})
+	if err != nil || len(opts.Tags) != 2 || opts.TagMatch != tagMatchAll {
+		t.Errorf("Expected two tags matched with all, got %+v (err %v)", opts, err)
+	}
+	if _, err := parseFlags([]string{"--tag-match", "some"}); err == nil {
+		t.Errorf("Expected error for invalid --tag-match")
+	}
+}
+
+func TestDueWithin(t *testing.T) {
+	now := time.Date(2025, 3, 10, 15, 0, 0, 0, time.UTC)
+	day := func(d int) *time.Time {
+		date := time.Date(2025, 3, d, 0, 0, 0, 0, time.UTC)
+		return &date
+	}
+	tests := []struct {
+		name     string
+		task     agenda.Task
+		status   string
+		expected bool
+	}{
+		{"due_today", agenda.Task{DueDate: day(10)}, agenda.StatusActive, true},
+		{"due_on_last_day", agenda.Task{DueDate: day(17)}, agenda.StatusActive, true},
+		{"due_later", agenda.Task{DueDate: day(18)}, agenda.StatusActive, false},
+		{"active_without_due_date", agenda.Task{NextStart: day(11)}, agenda.StatusActive, false},
+		{"starts_soon", agenda.Task{NextStart: day(12), DueDate: day(30)}, agenda.StatusInactive, true},
+		{"starts_later", agenda.Task{NextStart: day(20), DueDate: day(12)}, agenda.StatusInactive, false},
+		{"never_starts", agenda.Task{}, agenda.StatusInactive, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dueWithin(tt.task, tt.status, 7, now); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestScanFilteredDueIn(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	original := agenda.Clock
+	agenda.Clock = func() time.Time { return now }
+	t.Cleanup(func() { agenda.Clock = original })
+
+	dir := t.TempDir()
+	writeNote(t, dir, "soon.md", "---\ndtstart: 2025-03-12\n---\n")
+	writeNote(t, dir, "later.md", "---\ndtstart: 2025-04-01\n---\n")
+	writeNote(t, dir, "week.md", "---\ndtstart: 2025-03-10\nduration: P1W\n---\n")
+	writeNote(t, dir, "month.md", "---\ndtstart: 2025-03-10\nduration: P1M\n---\n")
+	writeNote(t, dir, "broken.md", "---\nrrule: [\n---\n")
+
+	opts, err := parseFlags([]string{"--due-in=7"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := scanFiltered(context.Background(), dir, opts)
+	if err != nil {
+		t.Fatalf("scanFiltered failed: %v", err)
+	}
+	if len(result.Active) != 1 || result.Active[0].Name != "week" {
+		t.Errorf("Expected only the weekly task to be due within 7 days, got %+v", result.Active)
+	}
+	if len(result.Inactive) != 1 || result.Inactive[0].Name != "soon" {
+		t.Errorf("Expected only the task starting in 2 days, got %+v", result.Inactive)
+	}
+	if len(result.Errored) != 1 {
+		t.Errorf("Expected the broken note to stay visible, got %+v", result.Errored)
+	}
+}
+
+func TestParseFlagsDueIn(t *testing.T) {
+	opts, err := parseFlags([]string{"--due-in", "0"})
+	if err != nil || opts.DueIn != "0" || opts.DueDays != 0 {
+		t.Errorf("Expected --due-in 0 to parse, got %+v (err %v)", opts, err)
+	}
+	for _, value := range []string{"-1", "week"} {
+		if _, err := parseFlags([]string{"--due-in", value}); err == nil {
+			t.Errorf("Expected error for --due-in %s", value)
+		}
+	}
+}
+
+func TestScanRootsVaultPerRoot(t *testing.T) {
+	personal, work := filepath.Join(t.TempDir(), "Personal"), filepath.Join(t.TempDir(), "Work")
+	for _, vault := range []string{personal, work} {
+		if err := os.MkdirAll(filepath.Join(vault, ".obsidian"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeNote(t, personal, "gym.md", "---\nrrule: FREQ=DAILY\n---\n")
+	writeNote(t, work, "standup.md", "---\nrrule: FREQ=DAILY\n---\n")
+	writeNote(t, work, "broken.md", "---\nrrule: [\n---\n")
+
+	result, err := scanRoots(context.Background(), []string{personal, work}, Options{})
+	if err != nil {
+		t.Fatalf("scanRoots failed: %v", err)
+	}
+	if result.FilesScanned != 3 || len(result.Active) != 2 || len(result.Errored) != 1 {
+		t.Fatalf("Expected both directories merged, got %d files, %+v / %+v", result.FilesScanned, result.Active, result.Errored)
+	}
+	expected := map[string]string{"gym": "Personal", "standup": "Work", "broken": "Work"}
+	for _, task := range append(result.Active, result.Errored...) {
+		if task.Vault == nil || task.Vault.Name != expected[task.Name] {
+			t.Errorf("%s: expected vault %s, got %+v", task.Name, expected[task.Name], task.Vault)
+			continue
+		}
+		if label := taskLabel(task); !strings.Contains(label, "vault="+expected[task.Name]+"&") {
+			t.Errorf("%s: expected a link into %s, got %q", task.Name, expected[task.Name], label)
+		}
+	}
+}
+
+func TestWalkRootsVaultPerRoot(t *testing.T) {
+	personal, work := filepath.Join(t.TempDir(), "Personal"), filepath.Join(t.TempDir(), "Work")
+	if err := os.MkdirAll(filepath.Join(work, ".obsidian"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeNote(t, personal, "gym.md", "---\nrrule: FREQ=DAILY\n---\n")
+	writeNote(t, work, "standup.md", "---\nrrule: FREQ=DAILY\n---\n")
+	writeNote(t, work, "broken.md", "---\nrrule: [\n---\n")
+
+	got := map[string]agenda.Task{}
+	err := walkRoots(context.Background(), []string{personal, work}, Options{OnlyStatus: agenda.StatusError}, func(task agenda.Task, status string) {
+		got[task.Name] = task
+	})
+	if err != nil {
+		t.Fatalf("walkRoots failed: %v", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("Expected only the errored note, got %+v", got)
+	}
+	broken := got["broken"]
+	if broken.Root != work || broken.Vault == nil || broken.Vault.Name != "Work" {
+		t.Errorf("Expected broken from the Work vault, got root %q vault %+v", broken.Root, broken.Vault)
+	}
+
+	got = map[string]agenda.Task{}
+	if err := walkRoots(context.Background(), []string{personal, work}, Options{}, func(task agenda.Task, status string) {
+		got[task.Name] = task
+	}); err != nil {
+		t.Fatalf("walkRoots failed: %v", err)
+	}
+	if gym := got["gym"]; gym.Root != personal || gym.Vault != nil {
+		t.Errorf("Expected gym from Personal without a vault, got root %q vault %+v", gym.Root, gym.Vault)
+	}
+}
+
+func TestScanFilteredOnlyStatus(t *testing.T) {
+	dir := t.TempDir()
+	writeNote(t, dir, "daily.md", "---\nrrule: FREQ=DAILY\n---\n")
+	writeNote(t, dir, "later.md", "---\ndtstart: 2999-01-01\n---\n")
+	writeNote(t, dir, "broken.md", "---\nrrule: [\n---\n")
+
+	tests := []struct {
+		flag                      string
+		active, inactive, errored int
+	}{
+		{"--active-only", 1, 0, 0},
+		{"--inactive-only", 0, 1, 0},
+		{"--errors-only", 0, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.flag, func(t *testing.T) {
+			opts, err := parseFlags([]string{tt.flag})
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := scanFiltered(context.Background(), dir, opts)
+			if err != nil {
+				t.Fatalf("scanFiltered failed: %v", err)
+			}
+			if len(result.Active) != tt.active || len(result.Inactive) != tt.inactive || len(result.Errored) != tt.errored {
+				t.Errorf("Expected %d/%d/%d tasks, got %+v / %+v / %+v", tt.active, tt.inactive, tt.errored, result.Active, result.Inactive, result.Errored)
+			}
+		})
+	}
+
+	opts, err := parseFlags([]string{"--active-only", "--json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := scanFiltered(context.Background(), dir, opts)
+	if err != nil {
+		t.Fatalf("scanFiltered failed: %v", err)
+	}
+	var out strings.Builder
+	if err := writeJSON(&out, result, 0); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), `"inactive": []`) || !strings.Contains(out.String(), `"errors": []`) || !strings.Contains(out.String(), `"name": "daily"`) {
+		t.Errorf("Expected only the active array to be populated, got %s", out.String())
+	}
+}
+
+func TestParseFlagsOnlySectionExclusive(t *testing.T) {
+	if _, err := parseFlags([]string{"--active-only", "--errors-only"}); err == nil {
+		t.Error("Expected --active-only and --errors-only to be mutually exclusive")
+	}
+	if opts, err := parseFlags(nil); err != nil || opts.OnlyStatus != "" {
+		t.Errorf("Expected every section by default, got %q (err %v)", opts.OnlyStatus, err)
+	}
+}
+
+func TestScanFilteredCompletedOneTime(t *testing.T) {
+	now := time.Date(2025, 9, 20, 12, 0, 0, 0, time.UTC)
+	original := agenda.Clock
+	agenda.Clock = func() time.Time { return now }
+	t.Cleanup(func() { agenda.Clock = original })
+
+	dir := t.TempDir()
+	writeNote(t, dir, "passport.md", "---\ndtstart: 2025-09-18\nduration: P1W\ndone: true\n---\n")
+	writeNote(t, dir, "taxes.md", "---\ndtstart: 2025-10-01\ncompleted: 2025-09-20\n---\n")
+	writeNote(t, dir, "dentist.md", "---\ndtstart: 2025-09-19\nduration: P1W\n---\n")
+
+	result, err := scanFiltered(context.Background(), dir, Options{})
+	if err != nil {
+		t.Fatalf("scanFiltered failed: %v", err)
+	}
+	if len(result.Active) != 1 || result.Active[0].Name != "dentist" || len(result.Inactive) != 0 || len(result.Completed) != 0 {
+		t.Errorf("Expected completed tasks to be hidden, got %+v / %+v / %+v", result.Active, result.Inactive, result.Completed)
+	}
+
+	result, err = scanFiltered(context.Background(), dir, Options{ShowCompleted: true})
+	if err != nil {
+		t.Fatalf("scanFiltered failed: %v", err)
+	}
+	if len(result.Completed) != 2 || result.Completed[0].Name != "passport" || result.Completed[1].Name != "taxes" {
+		t.Errorf("--show-completed: expected both completed tasks, got %+v", result.Completed)
+	}
+}
+
+func TestParseFlagsShowCompleted(t *testing.T) {
+	opts, err := parseFlags([]string{"--show-completed"})
+	if err != nil || !opts.ShowCompleted {
+		t.Errorf("Expected --show-completed to be set, got %+v (err %v)", opts, err)
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/harnyk/obsidian-tasks/agenda"
+)
+
+// fixChange is one proposed rewrite of a front matter value
+type fixChange struct {
+	Field string
+	Old   string
+	New   string
+}
+
+// noteFix is the set of rewrites proposed for one note
+type noteFix struct {
+	Path    string
+	Fixed   string // full note content with the rewrites applied
+	Changes []fixChange
+}
+
+// fixLinePattern matches a front matter line for one of the fixable fields,
+// capturing the prefix, optional quotes, the value and any trailing comment
+var fixLinePattern = regexp.MustCompile(`^(\s*(rrule|exrule|dtstart|duration)\s*:\s*)(['"]?)([^'"#\r\n]*?)(['"]?)(\s*(?:#.*)?\r?\n?)$`)
+
+// slashDatePattern matches dtstart values written as 2025/3/4
+var slashDatePattern = regexp.MustCompile(`^(\d{4})/(\d{1,2})/(\d{1,2})$`)
+
+// unprefixedDurationPattern matches ISO 8601 durations missing their P, like 3D or T2H
+var unprefixedDurationPattern = regexp.MustCompile(`(?i)^(\d+[DWMY])*(T(\d+[HMS])+)?$`)
+
+// fixers is the whitelist of safe normalizations, keyed by field. Each
+// returns the rewritten value and whether it changed anything.
+var fixers = map[string]func(value string) (string, bool){
+	"rrule":    fixRuleCase,
+	"exrule":   fixRuleCase,
+	"dtstart":  fixSlashDate,
+	"duration": fixDurationPrefix,
+}
+
+// fixRuleCase uppercases rules written as freq=daily. Rules with a pasted
+// DTSTART are left alone, since their TZID is case sensitive.
+func fixRuleCase(value string) (string, bool) {
+	if _, _, _, ok := agenda.SplitEmbeddedDTStart(value); ok {
+		return value, false
+	}
+	upper := strings.ToUpper(value)
+	return upper, upper != value
+}
+
+// fixSlashDate rewrites 2025/03/04 as 2025-03-04
+func fixSlashDate(value string) (string, bool) {
+	match := slashDatePattern.FindStringSubmatch(value)
+	if match == nil {
+		return value, false
+	}
+	date, err := time.Parse("2006-1-2", match[1]+"-"+match[2]+"-"+match[3])
+	if err != nil {
+		return value, false
+	}
+	return date.Format("2006-01-02"), true
+}
+
+// fixDurationPrefix adds the missing P to durations written as 3D or T2H
+func fixDurationPrefix(value string) (string, bool) {
+	if value == "" || !unprefixedDurationPattern.MatchString(value) {
+		return value, false
+	}
+	if _, err := agenda.ParseDuration("P" + value); err != nil {
+		return value, false
+	}
+	return "P" + value, true
+}
+
+// proposeFixes applies the whitelisted fixes to the front matter of a note,
+// leaving everything else, including the body, byte for byte intact
+func proposeFixes(content string) (string, []fixChange) {
+	if !agenda.HasFrontMatter(content) {
+		return content, nil
+	}
+	end := agenda.FrontMatterEnd(content)
+	if end < 0 {
+		return content, nil
+	}
+	header, rest := content[:end], content[end:]
+
+	var changes []fixChange
+	lines := strings.SplitAfter(header, "\n")
+	for i, line := range lines {
+		match := fixLinePattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		field, value := match[2], strings.TrimSpace(match[4])
+		fixed, changed := fixers[field](value)
+		if !changed {
+			continue
+		}
+		changes = append(changes, fixChange{Field: field, Old: value, New: fixed})
+		lines[i] = match[1] + match[3] + fixed + match[5] + match[6]
+	}
+
+	if len(changes) == 0 {
+		return content, nil
+	}
+	return strings.Join(lines, "") + rest, changes
+}
+
+// findFixes proposes fixes for every markdown note under root without
+// writing anything
+func findFixes(root string) ([]noteFix, error) {
+	var fixes []noteFix
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && path != root && agenda.SkipDir(d.Name()) {
+			return fs.SkipDir
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), ".md") {
+			return nil
+		}
+		data, err := agenda.ReadFileWithRetry(path)
+		if err != nil {
+			return err
+		}
+		if fixed, changes := proposeFixes(string(data)); len(changes) > 0 {
+			fixes = append(fixes, noteFix{Path: path, Fixed: fixed, Changes: changes})
+		}
+		return nil
+	})
+	return fixes, err
+}
+
+// printFixes lists the proposed rewrites, one line per change
+func printFixes(w io.Writer, fixes []noteFix) {
+	for _, fix := range fixes {
+		fmt.Fprintln(w, fix.Path)
+		for _, change := range fix.Changes {
+			fmt.Fprintf(w, "  %s: %q -> %q\n", change.Field, change.Old, change.New)
+		}
+	}
+}
+
+// applyFixes writes the fixed content back, keeping each file's permissions
+func applyFixes(fixes []noteFix) error {
+	for _, fix := range fixes {
+		if err := rewriteNote(fix.Path, fix.Fixed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rewriteNote replaces a note's content, keeping its permissions
+func rewriteNote(path, content string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(content), info.Mode().Perm())
+}
+
+// confirmRewrite finishes --fix and --normalize once the proposed changes
+// to count notes are printed: unless dryRun is set, it asks on in whether to
+// rewrite them, runs apply and reports the result as "<done> N notes"
+func confirmRewrite(in io.Reader, out io.Writer, count int, dryRun bool, done string, apply func() error) int {
+	if dryRun {
+		return 0
+	}
+	fmt.Fprintf(out, "Rewrite %d notes? [y/N] ", count)
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+		fmt.Fprintln(out, "Aborted")
+		return 1
+	}
+	if err := apply(); err != nil {
+		fmt.Fprintln(out, "Error:", err)
+		return 1
+	}
+	fmt.Fprintf(out, "%s %d notes\n", done, count)
+	return 0
+}
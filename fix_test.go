@@ -0,0 +1,168 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/harnyk/obsidian-tasks/agenda"
+)
+
+func TestProposeFixes(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+		changes  int
+	}{
+		{
+			"lowercase_rrule",
+			"---\nrrule: freq=weekly;byday=mo\n---\nbody\n",
+			"---\nrrule: FREQ=WEEKLY;BYDAY=MO\n---\nbody\n",
+			1,
+		},
+		{
+			"lowercase_exrule_quoted",
+			"---\nexrule: \"freq=weekly;byday=sa\"\n---\n",
+			"---\nexrule: \"FREQ=WEEKLY;BYDAY=SA\"\n---\n",
+			1,
+		},
+		{
+			"embedded_tzid_left_alone",
+			"---\nrrule: \"DTSTART;TZID=Europe/Berlin:20250101T090000 RRULE:freq=daily\"\n---\n",
+			"---\nrrule: \"DTSTART;TZID=Europe/Berlin:20250101T090000 RRULE:freq=daily\"\n---\n",
+			0,
+		},
+		{
+			"slash_dtstart",
+			"---\ndtstart: 2025/3/4   # moved\n---\n",
+			"---\ndtstart: 2025-03-04   # moved\n---\n",
+			1,
+		},
+		{
+			"duration_missing_p",
+			"---\nduration: 3D\n---\n",
+			"---\nduration: P3D\n---\n",
+			1,
+		},
+		{
+			"time_duration_missing_p",
+			"---\nduration: T2H\n---\n",
+			"---\nduration: PT2H\n---\n",
+			1,
+		},
+		{
+			"all_together",
+			"---\nrrule: freq=daily\ndtstart: 2025/01/02\nduration: 1W\ntags: [rrule]\n---\n\n# Title\nduration: 1D stays in the body\n",
+			"---\nrrule: FREQ=DAILY\ndtstart: 2025-01-02\nduration: P1W\ntags: [rrule]\n---\n\n# Title\nduration: 1D stays in the body\n",
+			3,
+		},
+		{
+			"already_valid",
+			"---\nrrule: FREQ=DAILY\ndtstart: 2025-01-02\nduration: P1D\n---\n",
+			"---\nrrule: FREQ=DAILY\ndtstart: 2025-01-02\nduration: P1D\n---\n",
+			0,
+		},
+		{
+			"unfixable_left_alone",
+			"---\ndtstart: 2025/13/45\nduration: soon\n---\n",
+			"---\ndtstart: 2025/13/45\nduration: soon\n---\n",
+			0,
+		},
+		{
+			"no_front_matter",
+			"rrule: freq=daily\n",
+			"rrule: freq=daily\n",
+			0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fixed, changes := proposeFixes(tt.content)
+			if fixed != tt.expected {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tt.expected, fixed)
+			}
+			if len(changes) != tt.changes {
+				t.Errorf("Expected %d changes, got %+v", tt.changes, changes)
+			}
+		})
+	}
+}
+
+func TestFindAndApplyFixes(t *testing.T) {
+	dir := t.TempDir()
+	broken := writeNote(t, dir, "sub/broken.md", "---\nrrule: freq=daily\nduration: 2D\n---\n# Notes\nkeep me\n")
+	good := writeNote(t, dir, "good.md", "---\nrrule: FREQ=DAILY\n---\n")
+	// Plugin files and archived notes are left alone, as scans leave them out
+	writeNote(t, dir, ".obsidian/plugins/templater/template.md", "---\nrrule: freq=daily\n---\n")
+	writeNote(t, dir, "archive/old.md", "---\nrrule: freq=weekly\n---\n")
+
+	fixes, err := findFixes(dir)
+	if err != nil {
+		t.Fatalf("findFixes failed: %v", err)
+	}
+	if len(fixes) != 1 || fixes[0].Path != broken || len(fixes[0].Changes) != 2 {
+		t.Fatalf("Expected 2 fixes for %s, got %+v", broken, fixes)
+	}
+
+	// A dry run only proposes: nothing is written until applyFixes
+	if data, _ := os.ReadFile(broken); string(data) != "---\nrrule: freq=daily\nduration: 2D\n---\n# Notes\nkeep me\n" {
+		t.Errorf("findFixes modified the note: %q", data)
+	}
+
+	if err := applyFixes(fixes); err != nil {
+		t.Fatalf("applyFixes failed: %v", err)
+	}
+	data, err := os.ReadFile(broken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "---\nrrule: FREQ=DAILY\nduration: P2D\n---\n# Notes\nkeep me\n" {
+		t.Errorf("Unexpected fixed note: %q", data)
+	}
+	if _, err := agenda.ParseFrontMatter(string(data)); err != nil {
+		t.Errorf("Fixed note doesn't parse: %v", err)
+	}
+
+	if data, _ := os.ReadFile(filepath.Join(dir, "good.md")); string(data) != "---\nrrule: FREQ=DAILY\n---\n" {
+		t.Errorf("Valid note %s was modified: %q", good, data)
+	}
+}
+
+func TestParseFlagsDryRunRequiresFix(t *testing.T) {
+	if _, err := parseFlags([]string{"--dry-run"}); err == nil {
+		t.Errorf("Expected error for --dry-run without --fix")
+	}
+	opts, err := parseFlags([]string{"--fix", "--dry-run"})
+	if err != nil || !opts.Fix || !opts.DryRun {
+		t.Errorf("Expected --fix --dry-run to parse, got %+v (err %v)", opts, err)
+	}
+}
+
+func TestConfirmRewrite(t *testing.T) {
+	tests := []struct {
+		name    string
+		answer  string
+		dryRun  bool
+		applied bool
+		code    int
+		output  string
+	}{
+		{"yes", "y\n", false, true, 0, "Rewrite 2 notes? [y/N] Fixed 2 notes\n"},
+		{"no", "\n", false, false, 1, "Rewrite 2 notes? [y/N] Aborted\n"},
+		{"dry_run", "y\n", true, false, 0, ""},
+	}
+	for _, tt := range tests {
+		applied := false
+		var out strings.Builder
+		code := confirmRewrite(strings.NewReader(tt.answer), &out, 2, tt.dryRun, "Fixed", func() error {
+			applied = true
+			return nil
+		})
+		if code != tt.code || applied != tt.applied || out.String() != tt.output {
+			t.Errorf("%s: got code %d, applied %v, output %q", tt.name, code, applied, out.String())
+		}
+	}
+}
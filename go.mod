@@ -1,10 +1,13 @@
-module obsidian-tasks
+module github.com/harnyk/obsidian-tasks
 
 go 1.24.0
 
 require (
 	github.com/fatih/color v1.18.0
+	github.com/fsnotify/fsnotify v1.9.0
 	github.com/teambition/rrule-go v1.8.2
+	golang.org/x/term v0.24.0
+	golang.org/x/text v0.3.4
 	gopkg.in/yaml.v3 v3.0.1
 )
 
@@ -15,5 +18,4 @@ require (
 	github.com/nicksnyder/go-i18n/v2 v2.1.1 // indirect
 	github.com/skillcoder/hrrule-go v0.1.0 // indirect
 	golang.org/x/sys v0.25.0 // indirect
-	golang.org/x/text v0.3.4 // indirect
 )
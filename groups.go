@@ -0,0 +1,93 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/harnyk/obsidian-tasks/agenda"
+)
+
+// taskGroup is a named bucket of tasks within a section
+type taskGroup struct {
+	Name  string
+	Tasks []agenda.Task
+}
+
+// groupKeyFuncs maps --group-by values to the function naming a task's
+// groups. A task is listed under each group named.
+var groupKeyFuncs = map[string]func(task agenda.Task) []string{
+	"folder": folderGroupKey,
+	"freq":   freqGroupKey,
+	"tag":    tagGroupKeys,
+}
+
+// folderGroupKey groups by the note's folder relative to the notes directory
+// it was found under
+func folderGroupKey(task agenda.Task) []string {
+	dir, err := filepath.Rel(task.Root, filepath.Dir(task.FilePath))
+	if err != nil || dir == "." {
+		return []string{"(root)"}
+	}
+	return []string{filepath.ToSlash(dir)}
+}
+
+// freqGroupKey groups by the RRULE FREQ value, or ONCE for one-time events
+func freqGroupKey(task agenda.Task) []string {
+	for _, part := range strings.Split(agenda.NormalizeRRule(task.RRule), ";") {
+		if freq, ok := strings.CutPrefix(part, "FREQ="); ok {
+			return []string{freq}
+		}
+	}
+	return []string{task.RRule}
+}
+
+// tagGroupKeys groups by each of the task's tags, normalized as for --tag,
+// or (untagged)
+func tagGroupKeys(task agenda.Task) []string {
+	var tags []string
+	for _, tag := range task.Tags {
+		if tag = normalizeTag(tag); tag != "" && !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) == 0 {
+		return []string{"(untagged)"}
+	}
+	return tags
+}
+
+// groupTasks buckets tasks by the given key, keeping task order within each
+// group, and orders the groups by name or by descending size. Tag groups
+// are ordered by due date instead, keeping task order among equal dates.
+func groupTasks(tasks []agenda.Task, by, order string) []taskGroup {
+	keyFunc := groupKeyFuncs[by]
+	index := make(map[string]int)
+	var groups []taskGroup
+
+	for _, task := range tasks {
+		for _, key := range keyFunc(task) {
+			i, ok := index[key]
+			if !ok {
+				i = len(groups)
+				index[key] = i
+				groups = append(groups, taskGroup{Name: key})
+			}
+			groups[i].Tasks = append(groups[i].Tasks, task)
+		}
+	}
+	if by == "tag" {
+		for _, group := range groups {
+			slices.SortStableFunc(group.Tasks, func(a, b agenda.Task) int { return compareDates(a.DueDate, b.DueDate) })
+		}
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		if order == "count" && len(groups[i].Tasks) != len(groups[j].Tasks) {
+			return len(groups[i].Tasks) > len(groups[j].Tasks)
+		}
+		return groups[i].Name < groups[j].Name
+	})
+	return groups
+}
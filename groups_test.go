@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/harnyk/obsidian-tasks/agenda"
+)
+
+func TestGroupTasks(t *testing.T) {
+	tasks := []agenda.Task{
+		{Name: "rent", RRule: "FREQ=MONTHLY;BYMONTHDAY=1", FilePath: "/notes/home/rent.md", Root: "/notes"},
+		{Name: "standup", RRule: "FREQ=DAILY", FilePath: "/notes/work/standup.md", Root: "/notes"},
+		{Name: "review", RRule: "freq=weekly;byday=fr", FilePath: "/notes/work/review.md", Root: "/notes"},
+		{Name: "timesheet", RRule: "FREQ=WEEKLY;BYDAY=FR", FilePath: "/notes/work/timesheet.md", Root: "/notes"},
+		{Name: "inbox", RRule: "FREQ=DAILY", FilePath: "/notes/inbox.md", Root: "/notes"},
+		{Name: "trip", RRule: "ONCE", FilePath: "/notes/home/trip.md", Root: "/notes"},
+	}
+
+	groupSummary := func(groups []taskGroup) map[string]int {
+		summary := make(map[string]int)
+		for _, group := range groups {
+			summary[group.Name] = len(group.Tasks)
+		}
+		return summary
+	}
+	groupNames := func(groups []taskGroup) []string {
+		var names []string
+		for _, group := range groups {
+			names = append(names, group.Name)
+		}
+		return names
+	}
+
+	t.Run("folder_by_name", func(t *testing.T) {
+		groups := groupTasks(tasks, "folder", "name")
+		if names := groupNames(groups); !reflect.DeepEqual(names, []string{"(root)", "home", "work"}) {
+			t.Errorf("Unexpected group order: %v", names)
+		}
+		if summary := groupSummary(groups); summary["work"] != 3 || summary["home"] != 2 || summary["(root)"] != 1 {
+			t.Errorf("Unexpected group sizes: %v", summary)
+		}
+	})
+
+	t.Run("folder_by_count", func(t *testing.T) {
+		groups := groupTasks(tasks, "folder", "count")
+		if names := groupNames(groups); !reflect.DeepEqual(names, []string{"work", "home", "(root)"}) {
+			t.Errorf("Unexpected group order: %v", names)
+		}
+	})
+
+	t.Run("freq_by_count_tie_broken_by_name", func(t *testing.T) {
+		groups := groupTasks(tasks, "freq", "count")
+		if names := groupNames(groups); !reflect.DeepEqual(names, []string{"DAILY", "WEEKLY", "MONTHLY", "ONCE"}) {
+			t.Errorf("Unexpected group order: %v", names)
+		}
+		if groups[0].Tasks[0].Name != "standup" || groups[0].Tasks[1].Name != "inbox" {
+			t.Errorf("Expected task order to be kept within a group, got %+v", groups[0].Tasks)
+		}
+	})
+}
+
+func TestGroupTasksByFolderAcrossRoots(t *testing.T) {
+	note := "---\nrrule: FREQ=DAILY\n---\n"
+	personal, work := t.TempDir(), t.TempDir()
+	writeNote(t, personal, "home/rent.md", note)
+	writeNote(t, personal, "inbox.md", note)
+	writeNote(t, work, "projects/standup.md", note)
+
+	result, err := scanRoots(context.Background(), []string{personal, work}, Options{})
+	if err != nil {
+		t.Fatalf("scanRoots failed: %v", err)
+	}
+	got := map[string][]string{}
+	for _, group := range groupTasks(result.Active, "folder", "name") {
+		for _, task := range group.Tasks {
+			got[group.Name] = append(got[group.Name], task.Name)
+		}
+	}
+	expected := map[string][]string{"(root)": {"inbox"}, "home": {"rent"}, "projects": {"standup"}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected folders relative to each root %v, got %v", expected, got)
+	}
+}
+
+func TestGroupTasksByTag(t *testing.T) {
+	day := func(d int) *time.Time {
+		date := time.Date(2025, 3, d, 0, 0, 0, 0, time.UTC)
+		return &date
+	}
+	tasks := []agenda.Task{
+		{Name: "rent", Tags: []string{"home", "#Money"}, DueDate: day(9)},
+		{Name: "standup", Tags: []string{"work"}, DueDate: day(3)},
+		{Name: "inbox"},
+		{Name: "taxes", Tags: []string{"money", "Money"}, DueDate: day(2)},
+		{Name: "review", Tags: []string{"work"}},
+	}
+
+	groups := groupTasks(tasks, "tag", "name")
+	got := make(map[string][]string)
+	var names []string
+	for _, group := range groups {
+		names = append(names, group.Name)
+		for _, task := range group.Tasks {
+			got[group.Name] = append(got[group.Name], task.Name)
+		}
+	}
+	if !reflect.DeepEqual(names, []string{"(untagged)", "home", "money", "work"}) {
+		t.Errorf("Unexpected group order: %v", names)
+	}
+	expected := map[string][]string{
+		"(untagged)": {"inbox"},
+		"home":       {"rent"},
+		"money":      {"taxes", "rent"},
+		"work":       {"standup", "review"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+
+	if _, err := parseFlags([]string{"--group-by", "tag"}); err != nil {
+		t.Errorf("Expected --group-by tag to be accepted, got %v", err)
+	}
+}
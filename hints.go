@@ -0,0 +1,9 @@
+package main
+
+// estimateBadge renders an estimate for display after the task's schedule
+func estimateBadge(estimate string, ascii bool) string {
+	if ascii {
+		return " [est " + estimate + "]"
+	}
+	return " ⏱ est " + estimate
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/harnyk/obsidian-tasks/agenda"
+)
+
+func TestPrintTaskLinesBodyHints(t *testing.T) {
+	originalNoColor := color.NoColor
+	color.NoColor = true
+	t.Cleanup(func() { color.NoColor = originalNoColor })
+
+	tasks := []agenda.Task{{Name: "Tidy", RRule: "FREQ=DAILY", FilePath: "/vault/Tidy.md", Estimate: "2h"}}
+
+	var out bytes.Buffer
+	printTaskLines(&out, tasks, "  - ", 0, color.FgHiBlack, Options{})
+	if strings.Contains(out.String(), "est") {
+		t.Errorf("Expected no badge without --body-hints, got %q", out.String())
+	}
+
+	out.Reset()
+	printTaskLines(&out, tasks, "  - ", 0, color.FgHiBlack, Options{BodyHints: true, ASCII: true})
+	if !strings.Contains(out.String(), "[est 2h]") {
+		t.Errorf("Expected the estimate badge, got %q", out.String())
+	}
+}
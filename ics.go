@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/harnyk/obsidian-tasks/agenda"
+)
+
+// icsRefresh is the refresh interval advertised to calendar clients
+var icsRefresh = time.Hour
+
+// How far around now the feed lists occurrences
+const (
+	icsPastDays   = 30
+	icsFutureDays = 180
+)
+
+// calendarEvent is one occurrence of a task in the calendar, or with RRule
+// set the first of a repeating series
+type calendarEvent struct {
+	Name     string
+	FilePath string
+	Start    time.Time
+	End      time.Time
+	AllDay   bool
+	RRule    string
+	ExRule   string
+	ExDates  []time.Time
+	URL      string
+
+	// Duration is the note's own duration, which each repetition of a
+	// series lasts; a month or business days needn't span the same time
+	// in every occurrence
+	Duration agenda.CalendarDuration
+}
+
+// taskEvents lists the occurrences of the tasks starting between from and
+// to, from the schedules the scan parsed. Tasks without one are skipped.
+func taskEvents(tasks []agenda.Task, from, to time.Time) []calendarEvent {
+	var events []calendarEvent
+	for _, task := range tasks {
+		fmWithDefaults := task.Schedule
+		if fmWithDefaults == nil {
+			continue
+		}
+		occurrences, err := agenda.Occurrences(fmWithDefaults, from, to, task.Now)
+		if err != nil {
+			verbosef("%s: %v", task.FilePath, err)
+			continue
+		}
+		for _, occurrence := range occurrences {
+			events = append(events, calendarEvent{
+				Name:     task.Name,
+				FilePath: task.FilePath,
+				Start:    occurrence.Start,
+				End:      occurrence.End,
+				AllDay:   !fmWithDefaults.Duration.Intraday(),
+			})
+		}
+	}
+	return events
+}
+
+// seriesEvents converts each task into one event from the schedule the scan
+// parsed: recurring tasks repeat by their rrule from the first occurrence,
+// one-time tasks cover their window. URLs open the note in its own vault,
+// else in the task's notes directory treated as a vault. Tasks without a
+// schedule are skipped.
+func seriesEvents(tasks []agenda.Task) []calendarEvent {
+	var events []calendarEvent
+	for _, task := range tasks {
+		fmWithDefaults := task.Schedule
+		if fmWithDefaults == nil {
+			continue
+		}
+		taskVault := task.Vault
+		if taskVault == nil {
+			taskVault = &agenda.VaultInfo{Name: filepath.Base(task.Root), Path: task.Root}
+		}
+		event := calendarEvent{
+			Name:     task.Name,
+			FilePath: task.FilePath,
+			AllDay:   !fmWithDefaults.Duration.Intraday(),
+			URL:      createObsidianURI(taskVault.Name, task.FilePath, taskVault.Path),
+		}
+		if fmWithDefaults.RRule == "" {
+			event.Start, event.End = agenda.OneTimeWindow(fmWithDefaults.DTStart, fmWithDefaults.Duration, fmWithDefaults.Countdown, fmWithDefaults.BusinessDays)
+		} else {
+			r, err := agenda.NewRecurrence(fmWithDefaults.RRule, fmWithDefaults.ExRule, fmWithDefaults.ExDates, fmWithDefaults.DTStart)
+			if err != nil {
+				verbosef("%s: %v", task.FilePath, err)
+				continue
+			}
+			// DTSTART must be the first instance, which dtstart need not be
+			first, err := r.After(fmWithDefaults.DTStart, true)
+			if err != nil {
+				verbosef("%s: %v", task.FilePath, err)
+				continue
+			}
+			if first.IsZero() {
+				continue
+			}
+			event.Start, event.End = first, agenda.WindowEnd(first, fmWithDefaults.Duration, fmWithDefaults.BusinessDays)
+			event.Duration = fmWithDefaults.Duration
+			event.Duration.BusinessDays = fmWithDefaults.BusinessDays
+			event.RRule = agenda.NormalizeRRule(fmWithDefaults.RRule)
+			event.ExRule = agenda.NormalizeRRule(fmWithDefaults.ExRule)
+			event.ExDates = fmWithDefaults.ExDates
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// writeICS writes events as an RFC 5545 calendar, advertising refresh as the
+// interval clients should re-fetch it at
+func writeICS(w io.Writer, events []calendarEvent, refresh time.Duration, now time.Time) error {
+	var b strings.Builder
+	line := func(content string) {
+		b.WriteString(foldICSLine(content))
+		b.WriteString("\r\n")
+	}
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//harnyk//obsidian-tasks//EN")
+	line("CALSCALE:GREGORIAN")
+	line("X-WR-CALNAME:Obsidian Tasks")
+	line("X-PUBLISHED-TTL:" + formatICSDuration(refresh))
+	line("REFRESH-INTERVAL;VALUE=DURATION:" + formatICSDuration(refresh))
+	for _, event := range events {
+		line("BEGIN:VEVENT")
+		line("UID:" + eventUID(event))
+		line("DTSTAMP:" + now.UTC().Format("20060102T150405Z"))
+		switch {
+		case event.RRule != "" && event.AllDay:
+			line("DTSTART;VALUE=DATE:" + event.Start.Format("20060102"))
+			line("DURATION:" + event.Duration.String())
+		case event.RRule != "":
+			line(icsDateTime("DTSTART", event.Start))
+			line("DURATION:" + event.Duration.String())
+		case event.AllDay:
+			line("DTSTART;VALUE=DATE:" + event.Start.Format("20060102"))
+			line("DTEND;VALUE=DATE:" + event.End.Format("20060102"))
+		default:
+			line(icsDateTime("DTSTART", event.Start))
+			line(icsDateTime("DTEND", event.End))
+		}
+		if event.RRule != "" {
+			line("RRULE:" + event.RRule)
+		}
+		if event.ExRule != "" {
+			line("EXRULE:" + event.ExRule)
+		}
+		for _, exDate := range event.ExDates {
+			if event.AllDay {
+				line("EXDATE;VALUE=DATE:" + exDate.Format("20060102"))
+			} else {
+				line(icsDateTime("EXDATE", exDate))
+			}
+		}
+		line("SUMMARY:" + escapeICSText(event.Name))
+		if event.URL != "" {
+			line("URL:" + event.URL)
+		}
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// icsDateTime renders a date-time property. Times pinned to a zone by
+// dtstart_tzid carry its TZID; the rest are the floating wall-clock times
+// dates take throughout, and are written without a zone so clients show
+// them at that local time rather than shifted by an offset.
+func icsDateTime(name string, t time.Time) string {
+	if t.Location() == time.UTC {
+		return name + ":" + t.Format("20060102T150405")
+	}
+	return name + ";TZID=" + t.Location().String() + ":" + t.Format("20060102T150405")
+}
+
+// eventUID identifies an occurrence stably across fetches, so clients update
+// events in place instead of duplicating them
+func eventUID(event calendarEvent) string {
+	sum := sha1.Sum([]byte(event.FilePath))
+	return fmt.Sprintf("%x-%s@obsidian-tasks", sum[:8], event.Start.UTC().Format("20060102T150405Z"))
+}
+
+// icsTextEscaper escapes the characters RFC 5545 reserves in TEXT values
+var icsTextEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+
+func escapeICSText(text string) string {
+	return icsTextEscaper.Replace(text)
+}
+
+// foldICSLine splits a content line into 75-octet lines, continuing each with
+// a leading space, without breaking UTF-8 sequences
+func foldICSLine(content string) string {
+	const limit = 75
+	var b strings.Builder
+	width := 0
+	for _, r := range content {
+		size := len(string(r))
+		if width+size > limit {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+		b.WriteRune(r)
+		width += size
+	}
+	return b.String()
+}
+
+// formatICSDuration renders d as an RFC 5545 duration, e.g. PT1H or P1D
+func formatICSDuration(d time.Duration) string {
+	if d > 0 && d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("P%dD", d/(24*time.Hour))
+	}
+	d = d.Round(time.Second)
+	hours, minutes, seconds := int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60
+	s := "PT"
+	if hours > 0 {
+		s += fmt.Sprintf("%dH", hours)
+	}
+	if minutes > 0 {
+		s += fmt.Sprintf("%dM", minutes)
+	}
+	if seconds > 0 || s == "PT" {
+		s += fmt.Sprintf("%dS", seconds)
+	}
+	return s
+}
+
+// icsFeedHandler serves the calendar at /calendar.ics, rescanning the notes
+// on every request so subscribed clients see changes
+func icsFeedHandler(roots []string, opts Options) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /calendar.ics", func(w http.ResponseWriter, r *http.Request) {
+		result, err := scanRoots(r.Context(), roots, opts)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		now := agenda.Clock()
+		today := now.Truncate(24 * time.Hour)
+		events := taskEvents(slices.Concat(result.Active, result.Inactive), today.AddDate(0, 0, -icsPastDays), today.AddDate(0, 0, icsFutureDays))
+
+		w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+		if err := writeICS(w, events, icsRefresh, agenda.AtZone(now, agenda.Timezone)); err != nil {
+			verbosef("ics feed: %v", err)
+		}
+	})
+	return mux
+}
+
+// serveICSFeed serves the calendar feed on addr until interrupted or the
+// server fails
+func serveICSFeed(addr string, roots []string, opts Options) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	server := &http.Server{Addr: addr, Handler: icsFeedHandler(roots, opts)}
+	failed := make(chan error, 1)
+	go func() { failed <- server.ListenAndServe() }()
+	fmt.Printf("Serving calendar at http://%s/calendar.ics\n", displayAddr(addr))
+
+	select {
+	case err := <-failed:
+		return err
+	case <-ctx.Done():
+		fmt.Println()
+		return server.Shutdown(context.Background())
+	}
+}
+
+// displayAddr fills in localhost for addresses like ":8080"
+func displayAddr(addr string) string {
+	if strings.HasPrefix(addr, ":") {
+		return "localhost" + addr
+	}
+	return addr
+}
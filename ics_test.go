@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/harnyk/obsidian-tasks/agenda"
+)
+
+func TestWriteICS(t *testing.T) {
+	now := time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC)
+	kyiv, err := time.LoadLocation("Europe/Kyiv")
+	if err != nil {
+		t.Skipf("Time zone data unavailable: %v", err)
+	}
+	events := []calendarEvent{
+		{Name: "Pay rent, again", FilePath: "/vault/Pay rent.md", Start: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), End: time.Date(2025, 3, 4, 0, 0, 0, 0, time.UTC), AllDay: true},
+		{Name: "Standup", FilePath: "/vault/Standup.md", Start: time.Date(2025, 3, 3, 9, 0, 0, 0, time.UTC), End: time.Date(2025, 3, 3, 9, 15, 0, 0, time.UTC)},
+		{Name: "Call", FilePath: "/vault/Call.md", Start: time.Date(2025, 3, 4, 18, 0, 0, 0, kyiv), End: time.Date(2025, 3, 4, 19, 0, 0, 0, kyiv)},
+	}
+
+	var b strings.Builder
+	if err := writeICS(&b, events, 2*time.Hour, now); err != nil {
+		t.Fatalf("writeICS failed: %v", err)
+	}
+	out := b.String()
+
+	for _, expected := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"X-PUBLISHED-TTL:PT2H\r\n",
+		"REFRESH-INTERVAL;VALUE=DURATION:PT2H\r\n",
+		"DTSTART;VALUE=DATE:20250301\r\nDTEND;VALUE=DATE:20250304\r\n",
+		"SUMMARY:Pay rent\\, again\r\n",
+		"DTSTART:20250303T090000\r\nDTEND:20250303T091500\r\n", // floating, not shifted to UTC
+		"DTSTART;TZID=Europe/Kyiv:20250304T180000\r\nDTEND;TZID=Europe/Kyiv:20250304T190000\r\n",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("Expected %q in:\n%s", expected, out)
+		}
+	}
+	if strings.Count(out, "BEGIN:VEVENT") != 3 {
+		t.Errorf("Expected 3 events in:\n%s", out)
+	}
+}
+
+func TestSeriesEventsICS(t *testing.T) {
+	now := time.Date(2025, 3, 10, 8, 0, 0, 0, time.UTC)
+	dir := t.TempDir()
+	weekly := writeNote(t, dir, "Water plants.md", "---\nrrule: freq=weekly;byday=fr\ndtstart: 2025-01-01\nduration: P2D\nexdate: [2025-01-17]\n---\n")
+	trip := writeNote(t, dir, "Trip; Rome.md", "---\ndtstart: 2025-04-01\nduration: P3D\n---\n")
+	broken := writeNote(t, dir, "Broken.md", "---\nrrule: FREQ=WEEKY\n---\n")
+	rent := writeNote(t, dir, "Rent.md", "---\nrrule: FREQ=MONTHLY;BYMONTHDAY=-1\ndtstart: 2025-01-31\nduration: P1M\n---\n")
+	report := writeNote(t, dir, "Report.md", "---\nrrule: FREQ=WEEKLY;BYDAY=WE\ndtstart: 2025-01-01\nduration: P3D\nskip_weekends: true\n---\n")
+	standup := writeNote(t, dir, "Standup.md", "---\nrrule: FREQ=DAILY\ndtstart: 2025-01-06T09:30:00\nduration: PT15M\nexdate: [2025-01-07T09:30:00]\n---\n")
+	var tasks []agenda.Task
+	for _, path := range []string{weekly, trip, broken, rent, report, standup} {
+		task, _ := agenda.ClassifyFile(path)
+		task.Vault = &agenda.VaultInfo{Name: "My Vault", Path: dir}
+		tasks = append(tasks, task)
+	}
+
+	// Errored tasks have no schedule and are left out
+	events := seriesEvents(tasks)
+	if len(events) != 5 {
+		t.Fatalf("Expected 2 events, got %+v", events)
+	}
+	var b strings.Builder
+	if err := writeICS(&b, events, time.Hour, now); err != nil {
+		t.Fatalf("writeICS failed: %v", err)
+	}
+	out := b.String()
+
+	weeklyEvent := strings.Join([]string{
+		"DTSTART;VALUE=DATE:20250103", // the first Friday, not dtstart
+		"DURATION:P2D",
+		"RRULE:FREQ=WEEKLY;BYDAY=FR",
+		"EXDATE;VALUE=DATE:20250117",
+		"SUMMARY:Water plants",
+		"URL:obsidian://open?vault=My%20Vault&file=Water%20plants",
+		"END:VEVENT",
+	}, "\r\n")
+	for _, expected := range []string{
+		weeklyEvent,
+		"DTSTART;VALUE=DATE:20250401\r\nDTEND;VALUE=DATE:20250404\r\nSUMMARY:Trip\\; Rome\r\n",
+		// The note's own duration, not the length of the first window
+		"DTSTART;VALUE=DATE:20250131\r\nDURATION:P1M\r\n",
+		"DTSTART;VALUE=DATE:20250101\r\nDURATION:P3BD\r\n",
+		"DTSTART:20250106T093000\r\nDURATION:PT15M\r\n",
+		"EXDATE:20250107T093000\r\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("Expected %q in:\n%s", expected, out)
+		}
+	}
+	if strings.Count(out, "RRULE:") != 4 {
+		t.Errorf("Expected only the recurring tasks to have an RRULE in:\n%s", out)
+	}
+}
+
+func TestSeriesEventsFallBackToEachRoot(t *testing.T) {
+	note := "---\nrrule: FREQ=DAILY\ndtstart: 2025-01-01\n---\n"
+	first, second := t.TempDir(), t.TempDir()
+	writeNote(t, first, "A.md", note)
+	writeNote(t, second, "B.md", note)
+
+	result, err := scanRoots(context.Background(), []string{first, second}, Options{})
+	if err != nil {
+		t.Fatalf("scanRoots failed: %v", err)
+	}
+	urls := map[string]string{}
+	for _, event := range seriesEvents(result.Active) {
+		urls[event.Name] = event.URL
+	}
+	for name, root := range map[string]string{"A": first, "B": second} {
+		expected := "obsidian://open?vault=" + encodeURIComponent(filepath.Base(root)) + "&file=" + name
+		if urls[name] != expected {
+			t.Errorf("%s: expected %q, got %q", name, expected, urls[name])
+		}
+	}
+}
+
+func TestParseFlagsICS(t *testing.T) {
+	if opts, err := parseFlags([]string{"--ics"}); err != nil || !opts.ICS {
+		t.Errorf("Expected --ics to parse, got %+v (err %v)", opts, err)
+	}
+	if _, err := parseFlags([]string{"--ics", "--json"}); err == nil {
+		t.Errorf("Expected error for --ics with --json")
+	}
+}
+
+func TestEventUIDStable(t *testing.T) {
+	start := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	a := eventUID(calendarEvent{FilePath: "/vault/A.md", Start: start})
+	if a != eventUID(calendarEvent{FilePath: "/vault/A.md", Start: start, Name: "Renamed"}) {
+		t.Error("Expected the UID to depend only on the note and start")
+	}
+	if a == eventUID(calendarEvent{FilePath: "/vault/A.md", Start: start.AddDate(0, 0, 1)}) {
+		t.Error("Expected different occurrences to have different UIDs")
+	}
+}
+
+func TestFoldICSLine(t *testing.T) {
+	long := "SUMMARY:" + strings.Repeat("ж", 60)
+	for i, line := range strings.Split(foldICSLine(long), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("Line %d is %d octets", i, len(line))
+		}
+		if i > 0 && !strings.HasPrefix(line, " ") {
+			t.Errorf("Continuation line %d should start with a space", i)
+		}
+	}
+	if got := foldICSLine("SUMMARY:short"); got != "SUMMARY:short" {
+		t.Errorf("Short lines should be unchanged, got %q", got)
+	}
+}
+
+func TestFormatICSDuration(t *testing.T) {
+	tests := map[time.Duration]string{
+		time.Hour:                    "PT1H",
+		90 * time.Minute:             "PT1H30M",
+		24 * time.Hour:               "P1D",
+		45 * time.Second:             "PT45S",
+		0:                            "PT0S",
+		2*time.Hour + 30*time.Second: "PT2H30S",
+	}
+	for d, expected := range tests {
+		if got := formatICSDuration(d); got != expected {
+			t.Errorf("%v: expected %s, got %s", d, expected, got)
+		}
+	}
+}
+
+func TestICSFeedHandler(t *testing.T) {
+	dir := t.TempDir()
+	writeNote(t, dir, "Daily.md", "---\nrrule: FREQ=DAILY\nduration: P1D\n---\n")
+	writeNote(t, dir, "Broken.md", "---\nrrule: FREQ=SOMETIMES\n---\n")
+
+	server := httptest.NewServer(icsFeedHandler([]string{dir}, Options{}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/calendar.ics")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/calendar") {
+		t.Errorf("Expected a text/calendar content type, got %q", ct)
+	}
+	var body strings.Builder
+	if _, err := io.Copy(&body, resp.Body); err != nil {
+		t.Fatalf("Reading body failed: %v", err)
+	}
+	if !strings.Contains(body.String(), "SUMMARY:Daily") {
+		t.Errorf("Expected the daily task in the feed:\n%s", body.String())
+	}
+	if strings.Contains(body.String(), "Broken") {
+		t.Errorf("Expected errored notes to be left out:\n%s", body.String())
+	}
+
+	resp, err = http.Get(server.URL + "/other")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for other paths, got %d", resp.StatusCode)
+	}
+}
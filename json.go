@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/harnyk/obsidian-tasks/agenda"
+)
+
+// diagnostic is one entry of the --errors-as-json output
+type diagnostic struct {
+	File    string `json:"file"`
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
+}
+
+// yamlLinePattern extracts the line number reported by yaml.v3 errors
+var yamlLinePattern = regexp.MustCompile(`\bline (\d+)\b`)
+
+// errorLine returns the 1-based line in the note that an error refers to,
+// or 0 if unknown. The YAML block starts on the opening --- line, so YAML
+// line numbers are also line numbers within the note; a sidecar file is all
+// YAML, so they are its line numbers too.
+func errorLine(err error) int {
+	match := yamlLinePattern.FindStringSubmatch(err.Error())
+	if match == nil {
+		return 0
+	}
+	line, _ := strconv.Atoi(match[1])
+	return line
+}
+
+// writeDiagnostics writes the errored tasks as a JSON array of diagnostics.
+// Errors in a sidecar file are reported against the sidecar.
+func writeDiagnostics(w io.Writer, tasks []agenda.Task) error {
+	diagnostics := make([]diagnostic, 0, len(tasks))
+	for _, task := range tasks {
+		file := task.FilePath
+		var sidecarErr *agenda.SidecarError
+		if errors.As(task.Error, &sidecarErr) {
+			file = sidecarErr.Path
+		}
+		diagnostics = append(diagnostics, diagnostic{
+			File:    file,
+			Line:    errorLine(task.Error),
+			Message: task.Error.Error(),
+		})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(diagnostics)
+}
+
+// occurrenceFields are the computed windows added by --with-occurrences
+type occurrenceFields struct {
+	ActiveWindow *timeWindow `json:"active_window"`
+	Upcoming     []string    `json:"upcoming"`
+}
+
+// timeWindow is an active window in RFC 3339, with an exclusive end
+type timeWindow struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// defaultUpcomingCount is how many occurrences a bare --with-occurrences lists
+const defaultUpcomingCount = 5
+
+// occurrenceCount is the --with-occurrences[=N] flag: bare it means
+// defaultUpcomingCount, 0 means off
+type occurrenceCount int
+
+func (c *occurrenceCount) String() string { return strconv.Itoa(int(*c)) }
+
+func (c *occurrenceCount) IsBoolFlag() bool { return true }
+
+func (c *occurrenceCount) Set(value string) error {
+	switch value {
+	case "true":
+		*c = defaultUpcomingCount
+		return nil
+	case "false":
+		*c = 0
+		return nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return fmt.Errorf("must be a positive number of occurrences")
+	}
+	*c = occurrenceCount(n)
+	return nil
+}
+
+// taskOccurrenceFields reports a task's window active when it was scanned
+// and the starts of its next n occurrences, from the schedule the scan
+// parsed and the note's own now. Errored tasks get neither.
+func taskOccurrenceFields(task agenda.Task, n int) *occurrenceFields {
+	fields := &occurrenceFields{Upcoming: []string{}}
+	if task.Error != nil || task.Schedule == nil {
+		return fields
+	}
+
+	if task.Window != nil {
+		fields.ActiveWindow = &timeWindow{Start: task.Window.Start.Format(time.RFC3339), End: task.Window.End.Format(time.RFC3339)}
+	}
+	upcoming, err := agenda.UpcomingOccurrences(task.Schedule, task.Now, n)
+	if err != nil {
+		verbosef("%s: %v", task.FilePath, err)
+		return fields
+	}
+	for _, occurrence := range upcoming {
+		fields.Upcoming = append(fields.Upcoming, occurrence.Start.Format(time.RFC3339))
+	}
+	return fields
+}
+
+// jsonTask is one task of the --json document and one line of the --jsonl
+// stream. Unset dates and errors are null rather than omitted, so every task
+// has the same keys.
+type jsonTask struct {
+	Name      string  `json:"name"`
+	RRule     string  `json:"rrule"`
+	Duration  string  `json:"duration"`
+	NextStart *string `json:"next_start"`
+	DueDate   *string `json:"due_date"`
+	FilePath  string  `json:"file_path"`
+	Status    string  `json:"status"`
+	Error     *string `json:"error"`
+
+	// Set only with --with-occurrences; a nil pointer omits both fields
+	*occurrenceFields
+}
+
+// jsonDocument is the --json output: every task of a scan by section
+type jsonDocument struct {
+	Active   []jsonTask `json:"active"`
+	Inactive []jsonTask `json:"inactive"`
+	Errors   []jsonTask `json:"errors"`
+
+	// Only with --show-completed
+	Completed []jsonTask `json:"completed,omitempty"`
+}
+
+// formatTimestamp renders an optional time in RFC 3339, or nil when unset
+func formatTimestamp(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	formatted := t.Format(time.RFC3339)
+	return &formatted
+}
+
+func newJSONTask(task agenda.Task, status string) jsonTask {
+	record := jsonTask{
+		Name:      task.Name,
+		RRule:     task.RRule,
+		Duration:  task.Duration,
+		NextStart: formatTimestamp(task.NextStart),
+		DueDate:   formatTimestamp(task.DueDate),
+		FilePath:  task.FilePath,
+		Status:    status,
+	}
+	if task.Error != nil {
+		message := task.Error.Error()
+		record.Error = &message
+	}
+	return record
+}
+
+// writeJSON writes the scanned sections as a single indented JSON document.
+// When withOccurrences is positive each task also gets its active window and
+// that many upcoming occurrences.
+func writeJSON(w io.Writer, result agenda.ScanResult, withOccurrences int) error {
+	section := func(tasks []agenda.Task, status string) []jsonTask {
+		records := make([]jsonTask, 0, len(tasks))
+		for _, task := range tasks {
+			record := newJSONTask(task, status)
+			if withOccurrences > 0 {
+				record.occurrenceFields = taskOccurrenceFields(task, withOccurrences)
+			}
+			records = append(records, record)
+		}
+		return records
+	}
+	document := jsonDocument{
+		Active:   section(result.Active, agenda.StatusActive),
+		Inactive: section(result.Inactive, agenda.StatusInactive),
+		Errors:   section(result.Errored, agenda.StatusError),
+	}
+	if len(result.Completed) > 0 {
+		document.Completed = section(result.Completed, agenda.StatusCompleted)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(document)
+}
+
+// jsonLinesWriter writes one compact JSON object per task. Writes are
+// serialized so lines never interleave when tasks arrive concurrently.
+type jsonLinesWriter struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+
+	// withOccurrences adds the active window and this many upcoming
+	// occurrences to each task, when positive
+	withOccurrences int
+}
+
+func newJSONLinesWriter(w io.Writer) *jsonLinesWriter {
+	return &jsonLinesWriter{encoder: json.NewEncoder(w)}
+}
+
+// Write emits task as a single line
+func (w *jsonLinesWriter) Write(task agenda.Task, status string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	record := newJSONTask(task, status)
+	if w.withOccurrences > 0 {
+		record.occurrenceFields = taskOccurrenceFields(task, w.withOccurrences)
+	}
+	return w.encoder.Encode(record)
+}
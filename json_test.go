@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/harnyk/obsidian-tasks/agenda"
+)
+
+func TestWriteDiagnostics(t *testing.T) {
+	dir := t.TempDir()
+	writeNote(t, dir, "bad_yaml.md", "---\nrrule: FREQ=DAILY\nduration: P1D: x\n---\n")
+	writeNote(t, dir, "bad_rrule.md", "---\nrrule: FREQ=WEEKY\n---\n")
+	writeNote(t, dir, "good.md", "---\nrrule: FREQ=DAILY\n---\n")
+
+	result, err := agenda.ScanNotes(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("scanNotes failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := writeDiagnostics(&buf, result.Errored); err != nil {
+		t.Fatalf("writeDiagnostics failed: %v", err)
+	}
+
+	var diagnostics []diagnostic
+	if err := json.Unmarshal(buf.Bytes(), &diagnostics); err != nil {
+		t.Fatalf("Output is not valid JSON: %v\n%s", err, buf.String())
+	}
+	if len(diagnostics) != 2 {
+		t.Fatalf("Expected 2 diagnostics, got %d: %s", len(diagnostics), buf.String())
+	}
+
+	byFile := make(map[string]diagnostic)
+	for _, d := range diagnostics {
+		byFile[d.File] = d
+		if d.Message == "" {
+			t.Errorf("%s: expected a message", d.File)
+		}
+	}
+
+	yamlDiag := byFile[filepath.Join(dir, "bad_yaml.md")]
+	if yamlDiag.Line != 3 {
+		t.Errorf("bad_yaml.md: expected the error on line 3 of the note, got %d (%s)", yamlDiag.Line, yamlDiag.Message)
+	}
+	if rruleDiag := byFile[filepath.Join(dir, "bad_rrule.md")]; rruleDiag.Line != 0 {
+		t.Errorf("bad_rrule.md: expected no line, got %d", rruleDiag.Line)
+	}
+}
+
+func TestWriteDiagnosticsSidecar(t *testing.T) {
+	dir := t.TempDir()
+	writeNote(t, dir, "plants.md", "# Water the plants\n\nSome notes\n")
+	sidecar := writeNote(t, dir, "plants.task.yaml", "rrule: FREQ=DAILY\nduration: P1D: x\n")
+
+	result, err := agenda.ScanNotes(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("scanNotes failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := writeDiagnostics(&buf, result.Errored); err != nil {
+		t.Fatalf("writeDiagnostics failed: %v", err)
+	}
+	var diagnostics []diagnostic
+	if err := json.Unmarshal(buf.Bytes(), &diagnostics); err != nil {
+		t.Fatalf("Output is not valid JSON: %v\n%s", err, buf.String())
+	}
+	if len(diagnostics) != 1 {
+		t.Fatalf("Expected 1 diagnostic, got %s", buf.String())
+	}
+	if d := diagnostics[0]; d.File != sidecar || d.Line != 2 {
+		t.Errorf("Expected the error on line 2 of %s, got %+v", sidecar, d)
+	}
+}
+
+func TestWriteDiagnostics_Empty(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeDiagnostics(&buf, nil); err != nil {
+		t.Fatalf("writeDiagnostics failed: %v", err)
+	}
+	if got := buf.String(); got != "[]\n" {
+		t.Errorf("Expected empty JSON array, got %q", got)
+	}
+}
+
+func TestJSONLinesWriter(t *testing.T) {
+	dir := t.TempDir()
+	writeNote(t, dir, "daily.md", "---\nrrule: FREQ=DAILY\nduration: P1D\n---\n")
+	writeNote(t, dir, "later.md", "---\ndtstart: 2999-01-01\nduration: P1D\n---\n")
+	writeNote(t, dir, "broken.md", "---\nrrule: FREQ=WEEKY\n---\n")
+	writeNote(t, dir, "plain.md", "no front matter\n")
+
+	var buf bytes.Buffer
+	out := newJSONLinesWriter(&buf)
+	if err := walkRoots(context.Background(), []string{dir}, Options{}, func(task agenda.Task, status string) {
+		if err := out.Write(task, status); err != nil {
+			t.Errorf("Write failed: %v", err)
+		}
+	}); err != nil {
+		t.Fatalf("walkRoots failed: %v", err)
+	}
+
+	byName := make(map[string]jsonTask)
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var record jsonTask
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("Line is not valid JSON: %v\n%s", err, scanner.Text())
+		}
+		byName[record.Name] = record
+	}
+	if len(byName) != 3 {
+		t.Fatalf("Expected 3 lines, got %d: %v", len(byName), byName)
+	}
+
+	if got := byName["daily"]; got.Status != agenda.StatusActive || got.DueDate == nil || got.RRule != "FREQ=DAILY" {
+		t.Errorf("daily: unexpected record %+v", got)
+	}
+	if got := byName["later"]; got.Status != agenda.StatusInactive || got.NextStart == nil || *got.NextStart != "2999-01-01T00:00:00Z" {
+		t.Errorf("later: unexpected record %+v", got)
+	}
+	if got := byName["broken"]; got.Status != agenda.StatusError || got.Error == nil {
+		t.Errorf("broken: unexpected record %+v", got)
+	}
+}
+
+func TestJSONLinesWriter_Concurrent(t *testing.T) {
+	var buf bytes.Buffer
+	out := newJSONLinesWriter(&buf)
+	task := agenda.Task{Name: strings.Repeat("x", 4096), FilePath: "/notes/x.md"}
+
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			out.Write(task, agenda.StatusActive)
+		}()
+	}
+	wg.Wait()
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 50 {
+		t.Fatalf("Expected 50 lines, got %d", len(lines))
+	}
+	for _, line := range lines {
+		var record jsonTask
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Interleaved line: %v", err)
+		}
+	}
+}
+
+func TestJSONLinesWriter_WithOccurrences(t *testing.T) {
+	now := time.Date(2025, 3, 5, 10, 0, 0, 0, time.UTC)
+	saved := agenda.Clock
+	agenda.Clock = func() time.Time { return now }
+	t.Cleanup(func() { agenda.Clock = saved })
+
+	dir := t.TempDir()
+	daily := writeNote(t, dir, "daily.md", "---\nrrule: FREQ=DAILY\ndtstart: 2025-03-01\nduration: P1D\n---\n")
+	later := writeNote(t, dir, "later.md", "---\ndtstart: 2025-04-01\nduration: P1D\n---\n")
+
+	var buf bytes.Buffer
+	out := newJSONLinesWriter(&buf)
+	out.withOccurrences = 3
+	for _, path := range []string{daily, later} {
+		task, status := agenda.ClassifyFile(path)
+		if err := out.Write(task, status); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+
+	type record struct {
+		Name         string      `json:"name"`
+		ActiveWindow *timeWindow `json:"active_window"`
+		Upcoming     []string    `json:"upcoming"`
+	}
+	var records []record
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var r record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatalf("Line is not valid JSON: %v\n%s", err, scanner.Text())
+		}
+		if !strings.Contains(scanner.Text(), `"active_window"`) || !strings.Contains(scanner.Text(), `"upcoming"`) {
+			t.Errorf("Expected both occurrence fields, got %s", scanner.Text())
+		}
+		records = append(records, r)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 lines, got %d", len(records))
+	}
+
+	if got := records[0].ActiveWindow; got == nil || got.Start != "2025-03-05T00:00:00Z" || got.End != "2025-03-06T00:00:00Z" {
+		t.Errorf("daily: unexpected active window %+v", got)
+	}
+	if want := []string{"2025-03-06T00:00:00Z", "2025-03-07T00:00:00Z", "2025-03-08T00:00:00Z"}; !slices.Equal(records[0].Upcoming, want) {
+		t.Errorf("daily: expected upcoming %v, got %v", want, records[0].Upcoming)
+	}
+	if records[1].ActiveWindow != nil || !slices.Equal(records[1].Upcoming, []string{"2025-04-01T00:00:00Z"}) {
+		t.Errorf("later: unexpected record %+v", records[1])
+	}
+}
+
+func TestJSONLinesWriter_WithOccurrencesNoteTZ(t *testing.T) {
+	// Still the 9th in New York
+	now := time.Date(2025, 3, 10, 2, 0, 0, 0, time.UTC)
+	savedClock, savedZone := agenda.Clock, agenda.Timezone
+	agenda.Clock, agenda.Timezone = func() time.Time { return now }, time.UTC
+	t.Cleanup(func() { agenda.Clock, agenda.Timezone = savedClock, savedZone })
+
+	dir := t.TempDir()
+	path := writeNote(t, dir, "daily.md", "---\nrrule: FREQ=DAILY\ndtstart: 2025-03-01\nduration: P1D\ntz: America/New_York\n---\n")
+
+	var buf bytes.Buffer
+	out := newJSONLinesWriter(&buf)
+	out.withOccurrences = 1
+	task, status := agenda.ClassifyFile(path)
+	if err := out.Write(task, status); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	var r struct {
+		ActiveWindow *timeWindow `json:"active_window"`
+		Upcoming     []string    `json:"upcoming"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &r); err != nil {
+		t.Fatalf("Line is not valid JSON: %v\n%s", err, buf.String())
+	}
+	if r.ActiveWindow == nil || r.ActiveWindow.Start != "2025-03-09T00:00:00Z" {
+		t.Errorf("Expected the window of the 9th, the note's today, got %+v", r.ActiveWindow)
+	}
+	if !slices.Equal(r.Upcoming, []string{"2025-03-10T00:00:00Z"}) {
+		t.Errorf("Expected the 10th next, got %v", r.Upcoming)
+	}
+}
+
+func TestJSONLinesWriter_WithoutOccurrences(t *testing.T) {
+	dir := t.TempDir()
+	path := writeNote(t, dir, "daily.md", "---\nrrule: FREQ=DAILY\nduration: P1D\n---\n")
+
+	var buf bytes.Buffer
+	task, status := agenda.ClassifyFile(path)
+	if err := newJSONLinesWriter(&buf).Write(task, status); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if strings.Contains(buf.String(), "active_window") || strings.Contains(buf.String(), "upcoming") {
+		t.Errorf("Expected no occurrence fields, got %s", buf.String())
+	}
+}
+
+func TestParseFlagsWithOccurrences(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected occurrenceCount
+		wantErr  bool
+	}{
+		{[]string{"--jsonl"}, 0, false},
+		{[]string{"--jsonl", "--with-occurrences"}, defaultUpcomingCount, false},
+		{[]string{"--jsonl", "--with-occurrences=12"}, 12, false},
+		{[]string{"--jsonl", "--with-occurrences=0"}, 0, true},
+		{[]string{"--json", "--with-occurrences=2"}, 2, false},
+		{[]string{"--with-occurrences"}, 0, true},
+		{[]string{"--json", "--jsonl"}, 0, true},
+	}
+	for _, tt := range tests {
+		opts, err := parseFlags(tt.args)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%v: expected error %v, got %v", tt.args, tt.wantErr, err)
+			continue
+		}
+		if err == nil && opts.WithOccurrences != tt.expected {
+			t.Errorf("%v: expected %d, got %d", tt.args, tt.expected, opts.WithOccurrences)
+		}
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	dir := t.TempDir()
+	writeNote(t, dir, "daily.md", "---\nrrule: FREQ=DAILY\nduration: P1D\n---\n")
+	writeNote(t, dir, "later.md", "---\ndtstart: 2999-01-01\nduration: P1D\n---\n")
+	writeNote(t, dir, "broken.md", "---\nrrule: FREQ=WEEKY\n---\n")
+
+	result, err := agenda.ScanNotes(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("scanNotes failed: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := writeJSON(&buf, result, 0); err != nil {
+		t.Fatalf("writeJSON failed: %v", err)
+	}
+
+	var document map[string][]map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &document); err != nil {
+		t.Fatalf("Output is not valid JSON: %v\n%s", err, buf.String())
+	}
+	if len(document["active"]) != 1 || len(document["inactive"]) != 1 || len(document["errors"]) != 1 {
+		t.Fatalf("Expected one task per section, got %s", buf.String())
+	}
+
+	keys := []string{"name", "rrule", "duration", "next_start", "due_date", "file_path", "status", "error"}
+	for section, tasks := range document {
+		for _, task := range tasks {
+			for _, key := range keys {
+				if _, ok := task[key]; !ok {
+					t.Errorf("%s: task is missing %q: %v", section, key, task)
+				}
+			}
+			if _, ok := task["upcoming"]; ok {
+				t.Errorf("%s: occurrence fields present without --with-occurrences: %v", section, task)
+			}
+		}
+	}
+
+	active := document["active"][0]
+	if due, ok := active["due_date"].(string); !ok {
+		t.Errorf("active: expected a due date, got %v", active["due_date"])
+	} else if _, err := time.Parse(time.RFC3339, due); err != nil {
+		t.Errorf("active: due date %q is not RFC 3339", due)
+	}
+	if active["error"] != nil || active["status"] != agenda.StatusActive {
+		t.Errorf("active: unexpected task %v", active)
+	}
+	if inactive := document["inactive"][0]; inactive["next_start"] != "2999-01-01T00:00:00Z" || inactive["error"] != nil {
+		t.Errorf("inactive: unexpected task %v", inactive)
+	}
+	if broken := document["errors"][0]; broken["error"] == nil || broken["status"] != agenda.StatusError {
+		t.Errorf("errors: unexpected task %v", broken)
+	}
+}
+
+func TestWriteJSON_Empty(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeJSON(&buf, agenda.ScanResult{}, 0); err != nil {
+		t.Fatalf("writeJSON failed: %v", err)
+	}
+	if want := "{\n  \"active\": [],\n  \"inactive\": [],\n  \"errors\": []\n}\n"; buf.String() != want {
+		t.Errorf("Expected empty arrays, got %q", buf.String())
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/harnyk/obsidian-tasks/agenda"
+)
+
+// ruleWarning is one --lint finding about a note's rrule
+type ruleWarning struct {
+	Path    string
+	Message string
+}
+
+// lintTasks checks the rule of every recurring task, ordered by file path
+func lintTasks(tasks []agenda.Task) []ruleWarning {
+	var warnings []ruleWarning
+	for _, task := range tasks {
+		if task.RRule == "" || task.RRule == "ONCE" {
+			continue
+		}
+		for _, message := range agenda.LintRRule(task.RRule) {
+			warnings = append(warnings, ruleWarning{Path: task.FilePath, Message: message})
+		}
+	}
+	slices.SortStableFunc(warnings, func(a, b ruleWarning) int { return strings.Compare(a.Path, b.Path) })
+	return warnings
+}
+
+// printRuleWarnings writes the --lint section: each warning with the path
+// of its note
+func printRuleWarnings(w io.Writer, title string, warnings []ruleWarning) {
+	if len(warnings) == 0 {
+		return
+	}
+	color.New(color.FgYellow, color.Bold).Fprintln(w, sectionHeader(title, len(warnings)))
+	for _, warning := range warnings {
+		fmt.Fprint(w, "  - ")
+		color.New(color.FgYellow).Fprint(w, warning.Path)
+		fmt.Fprintln(w, ": "+warning.Message)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/harnyk/obsidian-tasks/agenda"
+)
+
+func TestLintTasks(t *testing.T) {
+	originalNoColor := color.NoColor
+	color.NoColor = true
+	t.Cleanup(func() { color.NoColor = originalNoColor })
+
+	dir := t.TempDir()
+	fridays := writeNote(t, dir, "fridays.md", "---\nrrule: FREQ=MONTHLY;BYDAY=FR\n---\n")
+	writeNote(t, dir, "first friday.md", "---\nrrule: FREQ=MONTHLY;BYDAY=1FR\n---\n")
+	writeNote(t, dir, "once.md", "---\ndtstart: 2025-01-01\n---\n")
+
+	result, err := agenda.ScanNotes(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("ScanNotes failed: %v", err)
+	}
+	tasks := append(result.Active, result.Inactive...)
+	if len(tasks) != 3 {
+		t.Fatalf("Expected 3 tasks, got %+v", tasks)
+	}
+	warnings := lintTasks(tasks)
+	if len(warnings) != 1 || warnings[0].Path != fridays {
+		t.Fatalf("Expected one warning for fridays.md, got %+v", warnings)
+	}
+
+	var out strings.Builder
+	printRuleWarnings(&out, "Rule warnings", warnings)
+	if !strings.HasPrefix(out.String(), "\nRule warnings (1):\n  - "+fridays+": FREQ=MONTHLY;BYDAY=FR matches every FR") {
+		t.Errorf("Unexpected section:\n%s", out.String())
+	}
+
+	out.Reset()
+	printRuleWarnings(&out, "Rule warnings", nil)
+	if out.String() != "" {
+		t.Errorf("Expected no section without warnings, got %q", out.String())
+	}
+}
+
+func TestParseFlagsLint(t *testing.T) {
+	opts, err := parseFlags([]string{"--lint"})
+	if err != nil || !opts.Lint {
+		t.Errorf("Expected --lint to be set, got %v (err %v)", opts.Lint, err)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// instanceLock is a PID file held by a long-running mode (--refresh, --watch,
+// --ics-feed) so a second instance against the same vault refuses to start
+type instanceLock struct {
+	path string
+}
+
+// lockFilePath returns the lock file for a set of notes directories, under
+// the user cache directory
+func lockFilePath(roots ...string) string {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		cacheDir = os.TempDir()
+	}
+	absolute := make([]string, len(roots))
+	for i, root := range roots {
+		absolute[i] = root
+		if path, err := filepath.Abs(root); err == nil {
+			absolute[i] = path
+		}
+	}
+	sum := sha1.Sum([]byte(strings.Join(absolute, "\n")))
+	return filepath.Join(cacheDir, "obsidian-tasks", fmt.Sprintf("%x.lock", sum[:8]))
+}
+
+// acquireLock creates the lock file with this process's PID. The PID is
+// written to a temporary file first and linked into place, so the lock never
+// exists without it. A lock is only taken over once its PID has been read
+// and that process is no longer running; one that can't be read is left
+// alone.
+func acquireLock(path string) (*instanceLock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	for attempt := 0; attempt < 2; attempt++ {
+		err := createLockFile(path)
+		if err == nil {
+			return &instanceLock{path: path}, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, err
+		}
+
+		pid, err := readLockPID(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue // released meanwhile
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot read the PID in %s (%v); remove it if no other instance is running", path, err)
+		}
+		if processAlive(pid) {
+			return nil, fmt.Errorf("another instance (PID %d) is already running for this vault; stop it or remove %s", pid, path)
+		}
+		verbosef("removing stale lock %s", path)
+		if err := removeStaleLock(path, pid); err != nil {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("cannot acquire %s", path)
+}
+
+// createLockFile atomically creates path holding this process's PID. It
+// fails with fs.ErrExist when the lock is already there.
+func createLockFile(path string) error {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	_, err = fmt.Fprintln(file, os.Getpid())
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Link(file.Name(), path)
+}
+
+// removeStaleLock removes a lock held by the dead process pid. The lock is
+// moved aside first and checked again, so a fresh lock another instance
+// created in the meantime is put back rather than deleted.
+func removeStaleLock(path string, pid int) error {
+	stale := fmt.Sprintf("%s.%d.stale", path, os.Getpid())
+	if err := os.Rename(path, stale); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer os.Remove(stale)
+	if moved, err := readLockPID(stale); err != nil || moved != pid {
+		if err := os.Link(stale, path); err != nil && !errors.Is(err, fs.ErrExist) {
+			return err
+		}
+		return fmt.Errorf("another instance took over %s while it was being replaced", path)
+	}
+	return nil
+}
+
+// readLockPID returns the PID recorded in a lock file
+func readLockPID(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+// Release removes the lock file
+func (l *instanceLock) Release() error {
+	return os.Remove(l.path)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestAcquireLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache", "vault.lock")
+
+	lock, err := acquireLock(path)
+	if err != nil {
+		t.Fatalf("acquireLock failed: %v", err)
+	}
+	if pid, err := readLockPID(path); err != nil || pid != os.Getpid() {
+		t.Errorf("Expected our PID in the lock, got %d (err %v)", pid, err)
+	}
+
+	if _, err := acquireLock(path); err == nil || !strings.Contains(err.Error(), "already running") {
+		t.Errorf("Expected a live lock to refuse a second instance, got %v", err)
+	}
+
+	if err := lock.Release(); err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected the lock file to be removed, got %v", err)
+	}
+	lock, err = acquireLock(path)
+	if err != nil {
+		t.Fatalf("Expected to acquire a released lock: %v", err)
+	}
+	lock.Release()
+}
+
+func TestAcquireLockStale(t *testing.T) {
+	// A process that has exited leaves a lock nobody holds
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("running helper process failed: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "vault.lock")
+	if err := os.WriteFile(path, []byte(strconv.Itoa(cmd.Process.Pid)+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	lock, err := acquireLock(path)
+	if err != nil {
+		t.Fatalf("Expected a stale lock to be taken over: %v", err)
+	}
+	defer lock.Release()
+	if pid, _ := readLockPID(path); pid != os.Getpid() {
+		t.Errorf("Expected our PID to replace the stale one, got %d", pid)
+	}
+}
+
+func TestAcquireLockUnreadable(t *testing.T) {
+	// An empty lock may belong to a starter that hasn't written its PID
+	for name, content := range map[string]string{"empty": "", "corrupt": "not a pid"} {
+		path := filepath.Join(t.TempDir(), "vault.lock")
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := acquireLock(path); err == nil || !strings.Contains(err.Error(), "cannot read the PID") {
+			t.Errorf("%s: expected an unreadable lock to refuse, got %v", name, err)
+		}
+		if data, err := os.ReadFile(path); err != nil || string(data) != content {
+			t.Errorf("%s: expected the lock to be left alone, got %q (err %v)", name, data, err)
+		}
+	}
+}
+
+func TestAcquireLockLeavesNoTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	lock, err := acquireLock(filepath.Join(dir, "vault.lock"))
+	if err != nil {
+		t.Fatalf("acquireLock failed: %v", err)
+	}
+	defer lock.Release()
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("Expected only the lock file, found %v", entries)
+	}
+}
+
+func TestLockFilePathPerVault(t *testing.T) {
+	if lockFilePath("/vaults/a") == lockFilePath("/vaults/b") {
+		t.Error("Expected different vaults to use different locks")
+	}
+	if lockFilePath("/vaults/a") != lockFilePath("/vaults/a/") {
+		t.Error("Expected the same vault to always use the same lock")
+	}
+}
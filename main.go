@@ -1,112 +1,260 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"io/fs"
 	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
+	_ "time/tzdata" // zones for dtstart_tzid where the system has none (Windows)
+	"unicode"
 
 	"github.com/fatih/color"
-	"github.com/teambition/rrule-go"
+	"github.com/harnyk/obsidian-tasks/agenda"
+	"golang.org/x/text/width"
 	"gopkg.in/yaml.v3"
 )
 
-type FrontMatter struct {
-	RRule    string   `yaml:"rrule"`
-	Duration string   `yaml:"duration"`
-	DTStart  string   `yaml:"dtstart"`
-	Tags     []string `yaml:"tags"`
+type Config struct {
+	NotesDir    string   `yaml:"notes_dir"`
+	NotesDirs   []string `yaml:"notes_dirs"`
+	ReadRetries int      `yaml:"read_retries"`
+	WeekStart   string   `yaml:"week_start"`
+	ASCII       bool     `yaml:"ascii"`
+	Hyperlinks  *bool    `yaml:"hyperlinks"`
+
+	Timezone        string   `yaml:"timezone"`
+	DefaultDuration string   `yaml:"default_duration"`
+	OpenCommand     string   `yaml:"open_command"`
+	SnippetWidth    int      `yaml:"snippet_width"`
+	LeadDays        int      `yaml:"lead_days"`
+	DueTiers        []int    `yaml:"due_tiers"`
+	ICSRefresh      string   `yaml:"ics_refresh"`
+	MaxFiles        int      `yaml:"max_files"`
+	MaxOccurrences  int      `yaml:"max_occurrences"`
+	ArchiveDirs     []string `yaml:"archive_dirs"`
+
+	FilenamePrefixRegex string `yaml:"filename_prefix_regex"`
+
+	Schedules map[string]agenda.Schedule `yaml:"schedules"`
 }
 
-type FrontMatterWithDefaults struct {
-	RRule    string
-	Duration time.Duration
-	DTStart  time.Time
-	Tags     []string
+// compileFilenamePrefix compiles a filename_prefix_regex value
+func compileFilenamePrefix(pattern string) (*regexp.Regexp, error) {
+	prefix, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filename_prefix_regex %q: %w", pattern, err)
+	}
+	return prefix, nil
 }
 
-type Task struct {
-	Name      string
-	RRule     string
-	Duration  string
-	NextStart *time.Time
-	DueDate   *time.Time
-	Error     error
-	FilePath  string
-}
+// snippetWidth is the display width --snippet truncates to. It can be
+// overridden with snippet_width in the config file.
+var snippetWidth = 60
 
-type Config struct {
-	NotesDir string `yaml:"notes_dir"`
-}
+// leadDays highlights inactive tasks starting within that many days.
+// It is set from lead_days in the config file; 0 disables the highlight.
+var leadDays = 0
 
-type VaultInfo struct {
-	Name string
-	Path string
-}
+// dueTiers are the days-until-due limits of the red, orange and yellow due
+// date colors; later dates are green. Set from due_tiers in the config file.
+var dueTiers = []int{0, 2, 7}
 
-func getNotesDir() string {
-	// Try environment variable first
-	if root := os.Getenv("OBSIDIAN_NOTES_DIR"); root != "" {
-		return root
+// verbose enables diagnostic notes on stderr (--verbose)
+var verbose = false
+
+// verbosef prints a diagnostic note to stderr when --verbose is set
+func verbosef(format string, args ...any) {
+	if verbose {
+		fmt.Fprintf(os.Stderr, format+"\n", args...)
 	}
+}
 
-	// Try config files in order of preference
+// configPaths lists the config files to try, in order of preference
+func configPaths() []string {
 	homeDir, _ := os.UserHomeDir()
-	configPaths := []string{
+	return []string{
 		"config.yaml",
 		"config.yml",
 		filepath.Join(homeDir, ".config", "obsidian-tasks", "config.yaml"),
 		filepath.Join(homeDir, ".config", "obsidian-tasks", "config.yml"),
 	}
+}
+
+// loadConfigFiles reads every file in paths into one Config, in order.
+// Fields set in a later file override earlier ones, fields it leaves out
+// keep their earlier values, and lists are replaced rather than appended.
+func loadConfigFiles(paths []string) (Config, error) {
+	var config Config
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			return Config{}, fmt.Errorf("config file %s not found", path)
+		}
+		if err != nil {
+			return Config{}, err
+		}
+		if err := yaml.Unmarshal(data, &config); err != nil {
+			return Config{}, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return config, nil
+}
 
-	for _, configPath := range configPaths {
+// loadExplicitConfig loads the files named with --config. Unless the notes
+// directory comes from --notes-dir, together they must set notes_dir or
+// notes_dirs, since the default locations are not searched.
+func loadExplicitConfig(paths []string, needNotesDir bool) (Config, error) {
+	config, err := loadConfigFiles(paths)
+	if err != nil {
+		return Config{}, err
+	}
+	if needNotesDir && len(config.notesDirs()) == 0 {
+		return Config{}, fmt.Errorf("config file %s does not set notes_dir", strings.Join(paths, " + "))
+	}
+	return config, nil
+}
+
+func loadConfig() Config {
+	for _, configPath := range configPaths() {
 		if data, err := os.ReadFile(configPath); err == nil {
 			var config Config
-			if err := yaml.Unmarshal(data, &config); err == nil && config.NotesDir != "" {
-				return config.NotesDir
+			if err := yaml.Unmarshal(data, &config); err == nil && len(config.notesDirs()) > 0 {
+				return config
 			}
 		}
 	}
 
+	return Config{}
+}
+
+// getNotesDirs resolves the notes directories: the --notes-dir flag wins
+// over OBSIDIAN_NOTES_DIR, a path list such as ~/personal:~/work (; on
+// Windows), which wins over the config file. With explicit, the config was
+// named with --config and wins over the environment variable too.
+func getNotesDirs(config Config, flagDir string, explicit bool) []string {
+	if flagDir != "" {
+		return []string{expandPath(flagDir)}
+	}
+
+	if roots := config.notesDirs(); explicit && len(roots) > 0 {
+		return roots
+	}
+
+	// Try environment variable next
+	if roots := splitNotesDirs(os.Getenv("OBSIDIAN_NOTES_DIR")); len(roots) > 0 {
+		return roots
+	}
+
+	if roots := config.notesDirs(); len(roots) > 0 {
+		return roots
+	}
+
 	fmt.Println("Error: Notes directory not configured. Set OBSIDIAN_NOTES_DIR environment variable or create config.yaml with notes_dir field")
 	os.Exit(1)
-	return ""
+	return nil
 }
 
-func detectVault(notesDir string) *VaultInfo {
-	currentPath := notesDir
+// splitNotesDirs splits an OBSIDIAN_NOTES_DIR path list, dropping empty
+// entries
+func splitNotesDirs(list string) []string {
+	var roots []string
+	for _, root := range filepath.SplitList(list) {
+		if root != "" {
+			roots = append(roots, root)
+		}
+	}
+	return roots
+}
 
-	for {
-		// Check if .obsidian folder exists in current directory
-		obsidianPath := filepath.Join(currentPath, ".obsidian")
-		if _, err := os.Stat(obsidianPath); err == nil {
-			// Found .obsidian folder, extract vault name from directory name
-			vaultName := filepath.Base(currentPath)
-			return &VaultInfo{
-				Name: vaultName,
-				Path: currentPath,
-			}
+// notesDirs returns notes_dir followed by notes_dirs, without duplicates
+func (c Config) notesDirs() []string {
+	var roots []string
+	for _, root := range append([]string{c.NotesDir}, c.NotesDirs...) {
+		if root != "" && !slices.Contains(roots, root) {
+			roots = append(roots, root)
 		}
+	}
+	return roots
+}
 
-		// Move up one directory
-		parentPath := filepath.Dir(currentPath)
+// expandPath expands environment variables and a leading ~ in path
+func expandPath(path string) string {
+	path = os.ExpandEnv(path)
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if homeDir, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(homeDir, path[1:])
+		}
+	}
+	return path
+}
 
-		// If we've reached the root or can't go further up, stop
-		if parentPath == currentPath || parentPath == "/" || parentPath == "." {
-			break
+// vaultNames returns the names of the vaults holding roots, each once
+func vaultNames(roots []string) []string {
+	var names []string
+	for _, root := range roots {
+		if vault := agenda.DetectVault(root); vault != nil && !slices.Contains(names, vault.Name) {
+			names = append(names, vault.Name)
 		}
+	}
+	return names
+}
 
-		currentPath = parentPath
+// obsidianConfigPath returns the location of the Obsidian app's vault registry
+func obsidianConfigPath() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
 	}
+	return filepath.Join(configDir, "obsidian", "obsidian.json")
+}
 
-	return nil
+// findObsidianVault looks up a vault by name (its folder name) in obsidian.json
+func findObsidianVault(configPath, name string) (string, error) {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return "", fmt.Errorf("cannot read Obsidian config: %w", err)
+	}
+
+	var registry struct {
+		Vaults map[string]struct {
+			Path string `json:"path"`
+		} `json:"vaults"`
+	}
+	if err := json.Unmarshal(data, &registry); err != nil {
+		return "", fmt.Errorf("cannot parse Obsidian config %s: %w", configPath, err)
+	}
+
+	// Prefer an exact match, then fall back to a case-insensitive one
+	match := ""
+	for _, vault := range registry.Vaults {
+		base := filepath.Base(vault.Path)
+		if base == name {
+			return vault.Path, nil
+		}
+		if match == "" && strings.EqualFold(base, name) {
+			match = vault.Path
+		}
+	}
+	if match != "" {
+		return match, nil
+	}
+
+	return "", fmt.Errorf("vault %q not found in %s", name, configPath)
 }
 
-func createObsidianURI(vaultName, filePath, vaultPath, notesDir string) string {
+func createObsidianURI(vaultName, filePath, vaultPath string) string {
 	// Calculate relative path from vault root to the file
 	relativeFilePath, _ := filepath.Rel(vaultPath, filePath)
 
@@ -115,533 +263,1220 @@ func createObsidianURI(vaultName, filePath, vaultPath, notesDir string) string {
 	relativeFilePath = strings.ReplaceAll(relativeFilePath, "\\", "/")
 
 	// URL encode the components (using %20 for spaces, not +)
-	encodedVault := url.PathEscape(vaultName)
-	encodedFile := url.PathEscape(relativeFilePath)
+	encodedVault := encodeURIComponent(vaultName)
+	encodedFile := encodeURIComponent(relativeFilePath)
 
 	return fmt.Sprintf("obsidian://open?vault=%s&file=%s", encodedVault, encodedFile)
 }
 
-func createTerminalHyperlink(uri, text string) string {
-	// OSC 8 escape sequence format: \x1b]8;;URI\x1b\\TEXT\x1b]8;;\x1b\\
-	return fmt.Sprintf("\x1b]8;;%s\x1b\\%s\x1b]8;;\x1b\\", uri, text)
+// encodeURIComponent percent-encodes s as UTF-8 for use as a query value.
+// Unlike url.PathEscape it also escapes '&', '+' and '=', which would
+// otherwise split or alter the query; spaces become %20 rather than '+'.
+func encodeURIComponent(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
 }
 
-func main() {
-	// Check for help flag
-	if len(os.Args) > 1 && (os.Args[1] == "--help" || os.Args[1] == "-h") {
-		printHelp()
-		return
-	}
-
-	root := getNotesDir()
+// hyperlinks controls whether task names are printed as OSC 8 terminal
+// links into the vault
+var hyperlinks = true
 
-	// Detect Obsidian vault
-	vault := detectVault(root)
-	if vault != nil {
-		color.New(color.FgCyan, color.Bold).Printf("📓 Vault: %s\n", vault.Name)
+// hyperlinksEnabled decides whether task names are linked: never with
+// --no-links, as the hyperlinks config key says when it is set, and
+// otherwise only when stdout is a terminal, like colors
+func hyperlinksEnabled(noLinks bool, configured *bool, terminal bool) bool {
+	switch {
+	case noLinks:
+		return false
+	case configured != nil:
+		return *configured
 	}
+	return terminal
+}
 
-	var activeTasks []Task
-	var inactiveTasks []Task
-	var errorTasks []Task
+func createTerminalHyperlink(uri, text string) string {
+	// OSC 8 escape sequence format: \x1b]8;;URI\x1b\\TEXT\x1b]8;;\x1b\\
+	return fmt.Sprintf("\x1b]8;;%s\x1b\\%s\x1b]8;;\x1b\\", stripControlChars(uri), stripControlChars(text))
+}
 
-	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		if d.IsDir() {
-			return nil
-		}
-		if strings.HasSuffix(d.Name(), ".md") {
-			if task := processFile(path); task.Name != "" {
-				active, taskErr := isTaskActive(path)
-				if taskErr != nil {
-					task.Error = taskErr
-					errorTasks = append(errorTasks, task)
-				} else if active {
-					activeTasks = append(activeTasks, task)
-				} else {
-					inactiveTasks = append(inactiveTasks, task)
-				}
+// stripControlChars removes C0 and C1 control characters, including ESC, BEL
+// and the 8-bit ST, so a note name can't end an escape sequence early or
+// start one of its own
+func stripControlChars(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// escapeSequencePattern matches OSC sequences (such as OSC 8 hyperlinks,
+// terminated by ST or BEL) and CSI sequences (such as SGR colors)
+var escapeSequencePattern = regexp.MustCompile(`\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|\x1b\[[0-9;?]*[@-~]`)
+
+// displayWidth returns the number of terminal columns s occupies, ignoring
+// escape sequences and counting wide characters (CJK, emoji) as two columns
+func displayWidth(s string) int {
+	columns := 0
+	for _, r := range escapeSequencePattern.ReplaceAllString(s, "") {
+		switch width.LookupRune(r).Kind() {
+		case width.EastAsianWide, width.EastAsianFullwidth:
+			columns += 2
+		default:
+			if unicode.Is(unicode.Mn, r) || r == '\uFE0F' {
+				continue // combining marks and emoji variation selectors take no space
 			}
+			columns++
 		}
-		return nil
-	})
-	if err != nil {
-		fmt.Println("Walk error:", err)
-		return
 	}
+	return columns
+}
+
+// stringList is a flag that can be repeated, collecting every value
+type stringList []string
 
-	printTasks("Active tasks", activeTasks, color.FgGreen, vault, root)
-	printTasks("Inactive tasks", inactiveTasks, color.FgHiBlack, vault, root)
-	printTasksWithErrors("Tasks with syntax errors", errorTasks, color.FgRed, vault, root)
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
 }
 
-func printHelp() {
-	fmt.Println("obsidian-tasks - CLI tool for managing recurring tasks in Obsidian notes")
-	fmt.Println()
-	fmt.Println("USAGE:")
-	fmt.Println("  obsidian-tasks [--help]")
-	fmt.Println()
-	fmt.Println("DESCRIPTION:")
-	fmt.Println("  Scans Obsidian markdown files for recurring tasks defined with iCal RRULE + DURATION")
-	fmt.Println("  semantics in YAML front matter. Displays active and inactive tasks with smart")
-	fmt.Println("  date indicators including due dates and next start dates.")
-	fmt.Println()
-	fmt.Println("CONFIGURATION:")
-	fmt.Println("  Set notes directory via:")
-	fmt.Println("  - OBSIDIAN_NOTES_DIR environment variable, or")
-	fmt.Println("  - Config file (config.yaml/config.yml) with 'notes_dir' field in:")
-	fmt.Println("    - Current directory")
-	fmt.Println("    - ~/.config/obsidian-tasks/")
-	fmt.Println()
-	fmt.Println("FRONT MATTER FORMAT:")
-	fmt.Println("  Recurring tasks:")
-	fmt.Println("    ---")
-	fmt.Println("    rrule: FREQ=DAILY;COUNT=5")
-	fmt.Println("    duration: P1D")
-	fmt.Println("    dtstart: 2025-01-01")
-	fmt.Println("    ---")
-	fmt.Println()
-	fmt.Println("  One-time events:")
-	fmt.Println("    ---")
-	fmt.Println("    dtstart: 2025-10-18")
-	fmt.Println("    duration: P6D")
-	fmt.Println("    ---")
-	fmt.Println()
-	fmt.Println("DURATION FORMAT:")
-	fmt.Println("  ISO 8601 duration: P1D (1 day), P1W (1 week), PT2H (2 hours), etc.")
-	fmt.Println()
-	fmt.Println("OPTIONS:")
-	fmt.Println("  -h, --help    Show this help message")
+// Options holds the command line flags
+type Options struct {
+	Sort          string
+	SortDir       string
+	Refresh       time.Duration
+	ShowCompleted bool
+	Watch         bool
+	Dashboard     bool
+	ASCII         bool
+	NoLinks       bool
+	NoColor       bool
+	Vault         string
+	Align         bool
+	GroupBy       string
+	GroupSort     string
+
+	SinceLastRun       bool
+	ResetState         bool
+	ErrorsAsJSON       bool
+	ValidateConfig     bool
+	Open               string
+	JSONLines          bool
+	JSON               bool
+	ICS                bool
+	Verbose            bool
+	Snippet            bool
+	Fix                bool
+	Normalize          bool
+	DryRun             bool
+	Configs            stringList
+	Compact            bool
+	OnlyRecurring      bool
+	OnlyOneTime        bool
+	ActiveOnly         bool
+	InactiveOnly       bool
+	ErrorsOnly         bool
+	Series             bool
+	First              string
+	Last               string
+	HideDates          bool
+	NotesDir           string
+	ICSFeed            string
+	BodyHints          bool
+	FollowSymlinks     bool
+	DescribeRRule      bool
+	Lint               bool
+	IncludeArchived    bool
+	Timeout            time.Duration
+	Wrap               bool
+	InitSample         string
+	Force              bool
+	DeterministicCheck bool
+	Progress           bool
+	WithOccurrences    occurrenceCount
+	Date               string
+	Workers            int
+	Tags               stringList
+	TagMatch           string
+	DueIn              string
+	AsOf               time.Time // parsed --date, zero for now
+	DueDays            int       // parsed --due-in
+	OnlyStatus         string    // the one section kept by --active-only etc., empty for all
 }
 
-func printTasks(title string, tasks []Task, nameColor color.Attribute, vault *VaultInfo, notesDir string) {
-	if len(tasks) == 0 {
-		return
+func parseFlags(args []string) (Options, error) {
+	var opts Options
+
+	flags := flag.NewFlagSet("obsidian-tasks", flag.ContinueOnError)
+	flags.Usage = func() {}
+	flags.StringVar(&opts.Sort, "sort", "file", "")
+	flags.StringVar(&opts.SortDir, "sort-dir", "asc", "")
+	flags.DurationVar(&opts.Refresh, "refresh", 0, "")
+	flags.BoolVar(&opts.Watch, "watch", false, "")
+	flags.BoolVar(&opts.ShowCompleted, "show-completed", false, "")
+	flags.BoolVar(&opts.Dashboard, "dashboard", false, "")
+	flags.BoolVar(&opts.ASCII, "ascii", false, "")
+	flags.BoolVar(&opts.NoLinks, "no-links", false, "")
+	flags.BoolVar(&opts.NoColor, "no-color", false, "")
+	flags.StringVar(&opts.Vault, "vault", "", "")
+	flags.BoolVar(&opts.Align, "align", false, "")
+	flags.StringVar(&opts.GroupBy, "group-by", "", "")
+	flags.StringVar(&opts.GroupSort, "group-sort", "name", "")
+	flags.BoolVar(&opts.SinceLastRun, "since-last-run", false, "")
+	flags.BoolVar(&opts.ResetState, "reset-state", false, "")
+	flags.BoolVar(&opts.ErrorsAsJSON, "errors-as-json", false, "")
+	flags.BoolVar(&opts.ValidateConfig, "validate-config", false, "")
+	flags.StringVar(&opts.Open, "open", "", "")
+	flags.BoolVar(&opts.JSONLines, "jsonl", false, "")
+	flags.BoolVar(&opts.JSON, "json", false, "")
+	flags.BoolVar(&opts.ICS, "ics", false, "")
+	flags.BoolVar(&opts.Verbose, "verbose", false, "")
+	flags.BoolVar(&opts.Snippet, "snippet", false, "")
+	flags.BoolVar(&opts.Fix, "fix", false, "")
+	flags.BoolVar(&opts.Normalize, "normalize", false, "")
+	flags.BoolVar(&opts.DryRun, "dry-run", false, "")
+	flags.Var(&opts.Configs, "config", "")
+	flags.BoolVar(&opts.Compact, "compact", false, "")
+	flags.BoolVar(&opts.OnlyRecurring, "only-recurring", false, "")
+	flags.BoolVar(&opts.OnlyOneTime, "only-onetime", false, "")
+	flags.BoolVar(&opts.ActiveOnly, "active-only", false, "")
+	flags.BoolVar(&opts.InactiveOnly, "inactive-only", false, "")
+	flags.BoolVar(&opts.ErrorsOnly, "errors-only", false, "")
+	flags.BoolVar(&opts.Series, "series", false, "")
+	flags.StringVar(&opts.First, "first", "", "")
+	flags.StringVar(&opts.Last, "last", "", "")
+	flags.BoolVar(&opts.HideDates, "hide-dates", false, "")
+	flags.StringVar(&opts.NotesDir, "notes-dir", "", "")
+	flags.StringVar(&opts.ICSFeed, "ics-feed", "", "")
+	flags.BoolVar(&opts.BodyHints, "body-hints", false, "")
+	flags.BoolVar(&opts.FollowSymlinks, "follow-symlinks", false, "")
+	flags.BoolVar(&opts.DescribeRRule, "describe-rrule", false, "")
+	flags.BoolVar(&opts.IncludeArchived, "include-archived", false, "")
+	flags.DurationVar(&opts.Timeout, "timeout", 0, "")
+	flags.BoolVar(&opts.Wrap, "wrap", false, "")
+	flags.StringVar(&opts.InitSample, "init-sample", "", "")
+	flags.BoolVar(&opts.Force, "force", false, "")
+	flags.BoolVar(&opts.DeterministicCheck, "deterministic-check", false, "")
+	flags.BoolVar(&opts.Progress, "progress", false, "")
+	flags.Var(&opts.WithOccurrences, "with-occurrences", "")
+	flags.StringVar(&opts.Date, "date", "", "")
+	flags.IntVar(&opts.Workers, "workers", 0, "")
+	flags.Var(&opts.Tags, "tag", "")
+	flags.StringVar(&opts.TagMatch, "tag-match", tagMatchAll, "")
+	flags.StringVar(&opts.DueIn, "due-in", "", "")
+	flags.BoolVar(&opts.Lint, "lint", false, "")
+
+	if err := flags.Parse(args); err != nil {
+		return opts, err
 	}
-	color.New(color.FgYellow, color.Bold).Println("\n" + title + ":")
-	for _, task := range tasks {
-		fmt.Print("  - ")
 
-		// Create hyperlink if vault is available
-		if vault != nil && task.FilePath != "" {
-			uri := createObsidianURI(vault.Name, task.FilePath, vault.Path, notesDir)
-			hyperlinkText := createTerminalHyperlink(uri, task.Name)
-			color.New(nameColor, color.Bold).Print(hyperlinkText)
-		} else {
-			color.New(nameColor, color.Bold).Print(task.Name)
+	if taskOrders[opts.Sort] == nil {
+		return opts, fmt.Errorf("invalid --sort %q: must be due, name, next or file", opts.Sort)
+	}
+	if opts.SortDir != "asc" && opts.SortDir != "desc" {
+		return opts, fmt.Errorf("invalid --sort-dir %q: must be asc or desc", opts.SortDir)
+	}
+	if opts.GroupBy != "" && groupKeyFuncs[opts.GroupBy] == nil {
+		return opts, fmt.Errorf("invalid --group-by %q: must be folder, freq or tag", opts.GroupBy)
+	}
+	if opts.GroupSort != "name" && opts.GroupSort != "count" {
+		return opts, fmt.Errorf("invalid --group-sort %q: must be name or count", opts.GroupSort)
+	}
+	if opts.First != "" && opts.Last != "" {
+		return opts, fmt.Errorf("--first and --last are mutually exclusive")
+	}
+	if opts.OnlyRecurring && opts.OnlyOneTime {
+		return opts, fmt.Errorf("--only-recurring and --only-onetime are mutually exclusive")
+	}
+	for status, set := range map[string]bool{agenda.StatusActive: opts.ActiveOnly, agenda.StatusInactive: opts.InactiveOnly, agenda.StatusError: opts.ErrorsOnly} {
+		if !set {
+			continue
 		}
-		color.New(color.Reset).Print(" (" + task.RRule)
-		if task.Duration != "" {
-			color.New(color.Reset).Print(", " + task.Duration)
+		if opts.OnlyStatus != "" {
+			return opts, fmt.Errorf("--active-only, --inactive-only and --errors-only are mutually exclusive")
 		}
+		opts.OnlyStatus = status
+	}
+	if opts.Force && opts.InitSample == "" {
+		return opts, fmt.Errorf("--force requires --init-sample")
+	}
+	if opts.Timeout < 0 {
+		return opts, fmt.Errorf("invalid --timeout %v: must be positive", opts.Timeout)
+	}
+	if opts.NotesDir != "" && opts.Vault != "" {
+		return opts, fmt.Errorf("--notes-dir and --vault are mutually exclusive")
+	}
+	if opts.Fix && opts.Normalize {
+		return opts, fmt.Errorf("--fix and --normalize are mutually exclusive")
+	}
+	if opts.DryRun && !opts.Fix && !opts.Normalize {
+		return opts, fmt.Errorf("--dry-run requires --fix or --normalize")
+	}
+	if opts.JSON && opts.JSONLines {
+		return opts, fmt.Errorf("--json and --jsonl are mutually exclusive")
+	}
+	if opts.ICS && (opts.JSON || opts.JSONLines) {
+		return opts, fmt.Errorf("--ics can't be combined with --json or --jsonl")
+	}
+	if opts.WithOccurrences > 0 && !opts.JSON && !opts.JSONLines {
+		return opts, fmt.Errorf("--with-occurrences requires --json or --jsonl")
+	}
+	if opts.Refresh < 0 {
+		return opts, fmt.Errorf("invalid --refresh %v: must be positive", opts.Refresh)
+	}
+	if opts.Watch && opts.Refresh > 0 {
+		return opts, fmt.Errorf("--watch and --refresh are mutually exclusive")
+	}
+	if opts.TagMatch != tagMatchAll && opts.TagMatch != tagMatchAny {
+		return opts, fmt.Errorf("invalid --tag-match %q: must be all or any", opts.TagMatch)
+	}
+	if opts.DueIn != "" {
+		days, err := strconv.Atoi(opts.DueIn)
+		if err != nil || days < 0 {
+			return opts, fmt.Errorf("invalid --due-in %q: must be a number of days", opts.DueIn)
+		}
+		opts.DueDays = days
+	}
+	if opts.Workers < 0 {
+		return opts, fmt.Errorf("invalid --workers %d: must be positive", opts.Workers)
+	}
+	if opts.Date != "" {
+		if opts.AsOf = agenda.ParseStartDate(opts.Date, time.Time{}); opts.AsOf.IsZero() {
+			return opts, fmt.Errorf("invalid --date %q: expected a date such as 2025-12-01", opts.Date)
+		}
+		if opts.SinceLastRun {
+			// The saved state would record the wrong day
+			return opts, fmt.Errorf("--date and --since-last-run are mutually exclusive")
+		}
+	}
 
-		// Show due date for active tasks
-		if nameColor == color.FgGreen && task.DueDate != nil {
-			today := time.Now().Truncate(24 * time.Hour)
-			dateStr := task.DueDate.Format("2006-01-02")
+	return opts, nil
+}
 
-			if task.DueDate.Equal(today) {
-				// Red highlight if due today
-				color.New(color.FgRed, color.Bold).Print(" ⚠️ " + dateStr)
-			} else {
-				// Normal color for future due dates
-				color.New(color.FgYellow).Print(" → " + dateStr)
-			}
-		}
+func main() {
+	opts, err := parseFlags(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		printHelp()
+		return
+	}
+	if err != nil {
+		fmt.Println("Error:", err)
+		fmt.Println("Run 'obsidian-tasks --help' for usage.")
+		os.Exit(2)
+	}
 
-		// Show next start date for inactive tasks
-		if nameColor == color.FgHiBlack && task.NextStart != nil {
-			color.New(color.FgCyan).Print(" → " + task.NextStart.Format("2006-01-02"))
-		}
+	verbose = opts.Verbose
+	agenda.Debugf = verbosef
+	if opts.NoColor || !stdoutIsTerminal() {
+		// Symbols such as ⚠️ and ❌ stay; only the escape codes go
+		color.NoColor = true
+	}
+	if !opts.AsOf.IsZero() {
+		agenda.Clock = func() time.Time { return opts.AsOf }
+	}
 
-		color.New(color.Reset).Println(")")
+	if opts.ResetState {
+		if err := os.Remove(stateFilePath()); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		fmt.Println("State cleared")
+		return
 	}
-}
 
-func printTasksWithErrors(title string, tasks []Task, nameColor color.Attribute, vault *VaultInfo, notesDir string) {
-	if len(tasks) == 0 {
+	if opts.InitSample != "" {
+		if err := writeSamples(os.Stdout, expandPath(opts.InitSample), opts.Force, agenda.Clock()); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
 		return
 	}
-	color.New(color.FgYellow, color.Bold).Println("\n" + title + ":")
-	for _, task := range tasks {
-		fmt.Print("  - ")
 
-		// Create hyperlink if vault is available
-		if vault != nil && task.FilePath != "" {
-			uri := createObsidianURI(vault.Name, task.FilePath, vault.Path, notesDir)
-			hyperlinkText := createTerminalHyperlink(uri, task.Name)
-			color.New(nameColor, color.Bold).Print(hyperlinkText)
-		} else {
-			color.New(nameColor, color.Bold).Print(task.Name)
+	if opts.ValidateConfig {
+		if len(opts.Configs) > 0 {
+			os.Exit(validateConfig(os.Stdout, opts.Configs, true))
 		}
-		color.New(color.Reset).Print(" (" + task.RRule)
-		if task.Duration != "" {
-			color.New(color.Reset).Print(", " + task.Duration)
+		os.Exit(validateConfig(os.Stdout, configPaths(), false))
+	}
+
+	var config Config
+	if len(opts.Configs) > 0 {
+		config, err = loadExplicitConfig(opts.Configs, opts.NotesDir == "")
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	} else {
+		config = loadConfig()
+	}
+	if config.ReadRetries > 0 {
+		agenda.ReadAttempts = config.ReadRetries
+	}
+	if config.WeekStart != "" {
+		ws, err := agenda.ParseWeekStart(config.WeekStart)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
 		}
-		color.New(color.Reset).Print(")")
+		agenda.WeekStart = ws
+	}
+	if config.Timezone != "" {
+		loc, err := time.LoadLocation(config.Timezone)
+		if err != nil {
+			fmt.Printf("Error: invalid timezone %q\n", config.Timezone)
+			os.Exit(1)
+		}
+		agenda.Timezone = loc
+	}
+	if config.FilenamePrefixRegex != "" {
+		prefix, err := compileFilenamePrefix(config.FilenamePrefixRegex)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		agenda.FilenamePrefix = prefix
+	}
+	if config.DefaultDuration != "" {
+		duration, err := agenda.ParseCalendarDuration(config.DefaultDuration)
+		if approximate, _ := duration.Approximate(); err != nil || approximate <= 0 {
+			fmt.Printf("Error: invalid default_duration %q\n", config.DefaultDuration)
+			os.Exit(1)
+		}
+		agenda.DefaultDuration = duration
+	}
+	openCommand = config.OpenCommand
+	if config.SnippetWidth > 0 {
+		snippetWidth = config.SnippetWidth
+	}
+	leadDays = config.LeadDays
+	if config.Schedules != nil {
+		agenda.Schedules = config.Schedules
+	}
+	if config.DueTiers != nil {
+		if err := validateDueTiers(config.DueTiers); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		dueTiers = config.DueTiers
+	}
+	if config.MaxFiles > 0 {
+		agenda.MaxFiles = config.MaxFiles
+	}
+	if config.MaxOccurrences > 0 {
+		agenda.MaxOccurrences = config.MaxOccurrences
+	}
+	agenda.FollowSymlinks = opts.FollowSymlinks
+	if opts.Workers > 0 {
+		agenda.Workers = opts.Workers
+	}
+	if config.ArchiveDirs != nil {
+		agenda.ArchiveDirs = config.ArchiveDirs
+	}
+	agenda.IncludeArchived = opts.IncludeArchived
+	if opts.Wrap {
+		wrapWidth = terminalWidth()
+	}
+	if config.ICSRefresh != "" {
+		refresh, err := agenda.ParseDuration(config.ICSRefresh)
+		if err != nil || refresh <= 0 {
+			fmt.Printf("Error: invalid ics_refresh %q\n", config.ICSRefresh)
+			os.Exit(1)
+		}
+		icsRefresh = refresh
+	}
+	opts.ASCII = opts.ASCII || config.ASCII
+	hyperlinks = hyperlinksEnabled(opts.NoLinks, config.Hyperlinks, stdoutIsTerminal())
 
-		// Show error message
-		if task.Error != nil {
-			color.New(color.FgRed).Print(" ❌ " + task.Error.Error())
+	var roots []string
+	if opts.Vault != "" {
+		path, err := findObsidianVault(obsidianConfigPath(), opts.Vault)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Warning:", err, "- falling back to configured notes directory")
+		}
+		if path != "" {
+			roots = []string{path}
 		}
+	}
+	if roots == nil {
+		roots = getNotesDirs(config, opts.NotesDir, len(opts.Configs) > 0)
+	}
 
-		fmt.Println()
+	if opts.ICSFeed != "" || opts.Refresh > 0 || opts.Watch {
+		os.Exit(runLongLived(roots, opts))
 	}
+
+	os.Exit(run(roots, opts))
 }
 
-// ParseFrontMatter parses YAML frontmatter from content string
-func ParseFrontMatter(content string) (*FrontMatter, error) {
-	if !strings.HasPrefix(content, "---") {
-		return nil, fmt.Errorf("no frontmatter")
+// runLongLived runs the modes that keep going until interrupted, holding the
+// vault's instance lock meanwhile so a second copy refuses to start
+func runLongLived(roots []string, opts Options) int {
+	lock, err := acquireLock(lockFilePath(roots...))
+	if err != nil {
+		fmt.Println("Error:", err)
+		return 1
 	}
+	defer lock.Release()
 
-	parts := strings.SplitN(content, "---", 3)
-	if len(parts) < 3 {
-		return nil, fmt.Errorf("invalid frontmatter format")
+	if opts.ICSFeed != "" {
+		if err := serveICSFeed(opts.ICSFeed, roots, opts); err != nil {
+			fmt.Println("Error:", err)
+			return 1
+		}
+		return 0
 	}
-
-	var fm FrontMatter
-	if err := yaml.Unmarshal([]byte(parts[1]), &fm); err != nil {
-		return nil, fmt.Errorf("YAML parsing error: %w", err)
+	if opts.Watch {
+		if err := watchLoop(roots, func() { run(roots, opts) }); err != nil {
+			fmt.Println("Error:", err)
+			return 1
+		}
+		return 0
 	}
+	refreshLoop(opts.Refresh, func() { run(roots, opts) })
+	return 0
+}
 
-	return &fm, nil
+// refreshLoop clears the screen and re-runs fn every interval until interrupted
+func refreshLoop(interval time.Duration, fn func()) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	refreshOnTicks(ctx, ticker.C, func() {
+		// Move cursor home and clear the screen
+		fmt.Print("\x1b[H\x1b[2J")
+		fn()
+	})
+	fmt.Println()
 }
 
-// parseFrontMatter reads file and parses frontmatter (wrapper for file I/O)
-func parseFrontMatter(path string) (*FrontMatter, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, fmt.Errorf("read error: %w", err)
+// refreshOnTicks calls fn right away and again on every tick, until ctx is
+// done
+func refreshOnTicks(ctx context.Context, ticks <-chan time.Time, fn func()) {
+	for {
+		fn()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticks:
+		}
 	}
-	return ParseFrontMatter(string(data))
 }
 
-// ParseDuration parses ISO 8601 duration string
-func ParseDuration(durationStr string) (time.Duration, error) {
-	if durationStr == "" {
-		return 24 * time.Hour, nil // Default to 1 day
+// run scans the notes directories and prints the task sections, returning
+// the process exit code
+func run(roots []string, opts Options) int {
+	ctx := context.Background()
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
 	}
 
-	// Parse ISO 8601 duration format (P1D, P1W, P1M, PT1H, etc.)
-	if !strings.HasPrefix(durationStr, "P") {
-		return 0, fmt.Errorf("duration must start with 'P'")
+	if opts.ErrorsAsJSON {
+		result, err := scanRoots(ctx, roots, opts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Walk error:", err)
+			return 1
+		}
+		sortTasks(result.Errored, opts.Sort, opts.SortDir == "desc")
+		if err := writeDiagnostics(os.Stdout, result.Errored); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return 1
+		}
+		if len(result.Errored) > 0 {
+			return 1
+		}
+		return 0
 	}
 
-	duration := time.Duration(0)
-	remaining := durationStr[1:] // Remove 'P'
+	if opts.Fix {
+		return runFix(roots, opts.DryRun)
+	}
+	if opts.Normalize {
+		return runNormalize(roots, opts.DryRun)
+	}
+
+	if opts.DeterministicCheck {
+		return runDeterministicCheck(ctx, os.Stdout, roots, opts)
+	}
 
-	// Check for time component (after 'T')
-	timePart := ""
-	if tIndex := strings.Index(remaining, "T"); tIndex >= 0 {
-		timePart = remaining[tIndex+1:]
-		remaining = remaining[:tIndex]
+	if opts.First != "" {
+		return printOccurrenceQuery(os.Stdout, resolveNotePath(roots, opts.First), false, agenda.Clock())
+	}
+	if opts.Last != "" {
+		return printOccurrenceQuery(os.Stdout, resolveNotePath(roots, opts.Last), true, agenda.Clock())
 	}
 
-	// Parse date components (before 'T')
-	for remaining != "" {
-		i := 0
-		for i < len(remaining) && (remaining[i] >= '0' && remaining[i] <= '9') {
-			i++
+	if opts.JSONLines {
+		out := newJSONLinesWriter(os.Stdout)
+		out.withOccurrences = int(opts.WithOccurrences)
+		var writeErr error
+		err := walkRoots(ctx, roots, opts, func(task agenda.Task, status string) {
+			if writeErr == nil {
+				writeErr = out.Write(task, status)
+			}
+		})
+		if err == nil {
+			err = writeErr
 		}
-		if i == 0 {
-			break
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return 1
 		}
+		return 0
+	}
 
-		value := remaining[:i]
-		unit := remaining[i : i+1]
-		remaining = remaining[i+1:]
-
-		num, err := time.ParseDuration(value + "h")
+	if opts.JSON {
+		result, err := scanRoots(ctx, roots, opts)
 		if err != nil {
-			return 0, err
-		}
-		hours := int(num.Hours())
-
-		switch unit {
-		case "D":
-			duration += time.Duration(hours) * 24 * time.Hour
-		case "W":
-			duration += time.Duration(hours) * 7 * 24 * time.Hour
-		case "M":
-			duration += time.Duration(hours) * 30 * 24 * time.Hour // Approximate
-		case "Y":
-			duration += time.Duration(hours) * 365 * 24 * time.Hour // Approximate
-		default:
-			return 0, fmt.Errorf("unknown date unit: %s", unit)
+			fmt.Fprintln(os.Stderr, "Walk error:", err)
+			return 1
+		}
+		sortResult(result, opts)
+		if err := writeJSON(os.Stdout, result, int(opts.WithOccurrences)); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return 1
 		}
+		return 0
 	}
 
-	// Parse time components (after 'T')
-	for timePart != "" {
-		i := 0
-		for i < len(timePart) && (timePart[i] >= '0' && timePart[i] <= '9') {
-			i++
+	if opts.ICS {
+		result, err := scanRoots(ctx, roots, opts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Walk error:", err)
+			return 1
 		}
-		if i == 0 {
-			break
+		sortResult(result, opts)
+		now := agenda.Clock()
+		events := seriesEvents(slices.Concat(result.Active, result.Inactive))
+		if err := writeICS(os.Stdout, events, icsRefresh, agenda.AtZone(now, agenda.Timezone)); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return 1
 		}
+		return 0
+	}
 
-		value := timePart[:i]
-		unit := timePart[i : i+1]
-		timePart = timePart[i+1:]
-
-		switch unit {
-		case "H":
-			if hours, err := time.ParseDuration(value + "h"); err == nil {
-				duration += hours
-			}
-		case "M":
-			if minutes, err := time.ParseDuration(value + "m"); err == nil {
-				duration += minutes
-			}
-		case "S":
-			if seconds, err := time.ParseDuration(value + "s"); err == nil {
-				duration += seconds
-			}
-		default:
-			return 0, fmt.Errorf("unknown time unit: %s", unit)
+	if opts.Open != "" {
+		result, err := scanRoots(ctx, roots, opts)
+		if err != nil {
+			fmt.Println("Walk error:", err)
+			return 1
+		}
+		task, ok := findTask(result, opts.Open)
+		if !ok {
+			fmt.Printf("Error: no task named %q\n", opts.Open)
+			return 1
 		}
+		if err := openTask(task); err != nil {
+			fmt.Println("Error:", err)
+			return 1
+		}
+		return 0
 	}
 
-	return duration, nil
-}
-
-func getNextOccurrence(fm *FrontMatter) *time.Time {
-	if fm.RRule == "" {
-		return nil
+	if opts.Dashboard {
+		result, err := scanRoots(ctx, roots, opts)
+		if err != nil {
+			fmt.Println("Walk error:", err)
+			return 1
+		}
+		fmt.Println(dashboardLine(result, opts.ASCII))
+		reportScanTiming(result)
+		return 0
 	}
 
-	today := time.Now().Truncate(24 * time.Hour)
-	startDate := parseStartDate(fm.DTStart)
+	// Detect Obsidian vaults
+	if names := vaultNames(roots); len(names) > 0 {
+		color.New(color.FgCyan, color.Bold).Printf("📓 Vault: %s\n", strings.Join(names, ", "))
+	}
 
-	r, err := rrule.StrToRRule("DTSTART:" + startDate.Format("20060102T000000Z") + "\nRRULE:" + fm.RRule)
+	result, err := scanRoots(ctx, roots, opts)
 	if err != nil {
-		return nil
+		fmt.Println("Walk error:", err)
+		return 1
 	}
 
-	// Get next occurrence after today
-	nextOccurrences := r.Between(today.Add(24*time.Hour), today.AddDate(1, 0, 0), true)
-	if len(nextOccurrences) > 0 {
-		next := nextOccurrences[0].Truncate(24 * time.Hour)
-		return &next
+	if opts.SinceLastRun {
+		path := stateFilePath()
+		prev, err := loadRunState(path)
+		if err != nil {
+			fmt.Println("Warning: ignoring unreadable state file:", err)
+		}
+		next := markNewTasks(result.Active, prev, agenda.Clock())
+		if err := saveRunState(path, next); err != nil {
+			fmt.Println("Warning: cannot save state:", err)
+		}
 	}
 
-	return nil
-}
+	sortResult(result, opts)
 
-func getCurrentDueDate(fm *FrontMatter) *time.Time {
-	if fm.RRule == "" {
-		return nil
+	if message := emptyScanMessage(result, strings.Join(roots, ", ")); message != "" {
+		fmt.Println(message)
 	}
 
-	today := time.Now().Truncate(24 * time.Hour)
-	startDate := parseStartDate(fm.DTStart)
-	duration, err := ParseDuration(fm.Duration)
-	if err != nil {
-		return nil
+	if opts.Compact {
+		printCompact(result, agenda.Clock())
+		reportScanTiming(result)
+		return 0
 	}
 
-	r, err := rrule.StrToRRule("DTSTART:" + startDate.Format("20060102T000000Z") + "\nRRULE:" + fm.RRule)
-	if err != nil {
-		return nil
+	printTasks("Active tasks", result.Active, color.FgGreen, opts)
+	if opts.OnlyStatus == "" {
+		printReminders(color.Output, "Reminders", upcomingReminders(result, agenda.Clock()), opts)
 	}
+	printTasks("Inactive tasks", result.Inactive, color.FgHiBlack, opts)
+	printTasks("Completed tasks", result.Completed, color.Faint, opts)
+	printTasksWithErrors(color.Output, "Tasks with syntax errors", result.Errored, color.FgRed, opts)
+	if opts.Lint {
+		printRuleWarnings(color.Output, "Rule warnings", lintTasks(slices.Concat(result.Active, result.Inactive, result.Completed, result.Errored)))
+	}
+	if result.TasksFound > 0 {
+		fmt.Println("\n" + summaryLine(result))
+	}
+	reportScanTiming(result)
+	return 0
+}
 
-	// Find current active occurrence and its due date
-	endDate := today.Add(duration)
-	occurrences := r.Between(startDate, endDate, true)
-
-	for _, occurrence := range occurrences {
-		occurrenceStart := occurrence.Truncate(24 * time.Hour)
-		occurrenceEnd := occurrenceStart.Add(duration)
-
-		// If today falls within this occurrence's window, return its due date
-		if (today.Equal(occurrenceStart) || today.After(occurrenceStart)) && today.Before(occurrenceEnd) {
-			dueDate := occurrenceEnd.Add(-24 * time.Hour) // Last day of active period
-			return &dueDate
+// resolveNotePath finds a note given as a path, or relative to the first
+// notes directory that has it
+func resolveNotePath(roots []string, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	if _, err := os.Stat(path); err == nil {
+		return path
+	}
+	for _, root := range roots {
+		if _, err := os.Stat(filepath.Join(root, path)); err == nil {
+			return filepath.Join(root, path)
 		}
 	}
-
-	return nil
+	return filepath.Join(roots[0], path)
 }
 
-func getOneTimeDueDate(fm *FrontMatter) *time.Time {
-	if fm.DTStart == "" {
-		return nil
+// runFix lists the fixable front matter mistakes under roots and, unless
+// dryRun is set, rewrites the notes after confirmation
+func runFix(roots []string, dryRun bool) int {
+	var fixes []noteFix
+	for _, root := range roots {
+		found, err := findFixes(root)
+		if err != nil {
+			fmt.Println("Walk error:", err)
+			return 1
+		}
+		fixes = append(fixes, found...)
 	}
+	if len(fixes) == 0 {
+		fmt.Println("Nothing to fix")
+		return 0
+	}
+	printFixes(os.Stdout, fixes)
+	return confirmRewrite(os.Stdin, os.Stdout, len(fixes), dryRun, "Fixed", func() error {
+		return applyFixes(fixes)
+	})
+}
 
-	startDate := parseStartDate(fm.DTStart)
-	duration, err := ParseDuration(fm.Duration)
-	if err != nil {
-		return nil
+// emptyScanMessage explains a scan that found nothing to show, telling an
+// empty or wrong directory apart from notes without tasks
+func emptyScanMessage(result agenda.ScanResult, root string) string {
+	switch {
+	case result.FilesScanned == 0:
+		return fmt.Sprintf("No markdown files found under %s", root)
+	case result.TasksFound == 0:
+		return fmt.Sprintf("No tasks found in %d markdown files under %s", result.FilesScanned, root)
 	}
+	return ""
+}
 
-	dueDate := startDate.Add(duration).Add(-24 * time.Hour) // Last day of active period
-	return &dueDate
+// sectionHeader is the title line of an output section with its task count
+func sectionHeader(title string, count int) string {
+	return fmt.Sprintf("\n%s (%d):", title, count)
 }
 
-// IsOneTimeTaskActive checks if one-time task is active at given time
-func IsOneTimeTaskActive(fm *FrontMatterWithDefaults, currentTime time.Time) bool {
-	if fm.DTStart.IsZero() {
-		return false
+// summaryLine tallies the shown tasks by section, e.g. "3 active, 20
+// inactive, 1 error". Completed tasks are counted only when listed.
+func summaryLine(result agenda.ScanResult) string {
+	errorsWord := "errors"
+	if len(result.Errored) == 1 {
+		errorsWord = "error"
+	}
+	summary := fmt.Sprintf("%d active, %d inactive, %d %s", len(result.Active), len(result.Inactive), len(result.Errored), errorsWord)
+	if len(result.Completed) > 0 {
+		summary += fmt.Sprintf(", %d completed", len(result.Completed))
 	}
+	return summary
+}
 
-	today := currentTime.Truncate(24 * time.Hour)
-	endDate := fm.DTStart.Add(fm.Duration)
+// reportScanTiming prints the total scan time and the slowest files under --verbose
+func reportScanTiming(result agenda.ScanResult) {
+	verbosef("Scanned %d files (%d tasks) in %v", result.FilesScanned, result.TasksFound, result.Elapsed.Round(time.Millisecond))
+	if len(result.Slowest) > 0 {
+		verbosef("Slowest files:")
+	}
+	for _, timing := range result.Slowest {
+		verbosef("  %8v  %s", timing.Elapsed.Round(time.Microsecond), timing.Path)
+	}
+}
 
-	// Check if today falls within the event's active window
-	return (today.Equal(fm.DTStart) || today.After(fm.DTStart)) && today.Before(endDate)
+func printHelp() {
+	fmt.Println("obsidian-tasks - CLI tool for managing recurring tasks in Obsidian notes")
+	fmt.Println()
+	fmt.Println("USAGE:")
+	fmt.Println("  obsidian-tasks [options]")
+	fmt.Println()
+	fmt.Println("DESCRIPTION:")
+	fmt.Println("  Scans Obsidian markdown files for recurring tasks defined with iCal RRULE + DURATION")
+	fmt.Println("  semantics in YAML front matter. Displays active and inactive tasks with smart")
+	fmt.Println("  date indicators including due dates and next start dates.")
+	fmt.Println()
+	fmt.Println("CONFIGURATION:")
+	fmt.Println("  Set notes directory via:")
+	fmt.Println("  - --notes-dir <path> to scan that directory, or")
+	fmt.Println("  - --vault <name> to look up a vault known to the Obsidian app, or")
+	fmt.Println("  - OBSIDIAN_NOTES_DIR environment variable, or")
+	fmt.Println("  - Config file (config.yaml/config.yml) with 'notes_dir' field in:")
+	fmt.Println("    - Current directory")
+	fmt.Println("    - ~/.config/obsidian-tasks/")
+	fmt.Println()
+	fmt.Println("FRONT MATTER FORMAT:")
+	fmt.Println("  Recurring tasks:")
+	fmt.Println("    ---")
+	fmt.Println("    rrule: FREQ=DAILY;COUNT=5")
+	fmt.Println("    duration: P1D")
+	fmt.Println("    dtstart: 2025-01-01")
+	fmt.Println("    exrule: FREQ=WEEKLY;BYDAY=SA,SU   # optional, occurrences to skip")
+	fmt.Println("    single_day: true                  # optional, active only on the start day")
+	fmt.Println("    remind_before: P2D                # optional, list under Reminders 2 days before due")
+	fmt.Println("    completed: 2025-01-03             # optional, current occurrence done until the next one")
+	fmt.Println("    ---")
+	fmt.Println()
+	fmt.Println("  One-time events:")
+	fmt.Println("    ---")
+	fmt.Println("    dtstart: 2025-10-18")
+	fmt.Println("    duration: P6D")
+	fmt.Println("    countdown: true   # optional, active for the 6 days before dtstart")
+	fmt.Println("    done: true        # optional, hide the finished task (or completed: 2025-10-20)")
+	fmt.Println("    ---")
+	fmt.Println()
+	fmt.Println("DURATION FORMAT:")
+	fmt.Println("  ISO 8601 duration: P1D (1 day), P1W (1 week), PT2H (2 hours), etc.")
+	fmt.Println("  Designators are case-insensitive (p1d, PT2h).")
+	fmt.Println("  Clock-style HH:MM:SS or HH:MM (02:30:00) is also accepted.")
+	fmt.Println("  P5BD counts 5 business days, skipping weekends (or set skip_weekends: true).")
+	fmt.Println()
+	fmt.Println("OPTIONS:")
+	fmt.Println("  --config <file>      Use this config file (must set notes_dir; wins over OBSIDIAN_NOTES_DIR) instead of the search order; repeat to layer overrides")
+	fmt.Println("  --sort due|name|next|file  Order tasks within each section by due date, name, next start or file path (default file)")
+	fmt.Println("  --sort-dir asc|desc  Order of tasks within each section (default asc)")
+	fmt.Println("  --refresh <interval> Re-scan and redraw every interval, e.g. 60s (Ctrl+C to exit)")
+	fmt.Println("  --watch              Re-scan and redraw whenever a note changes (Ctrl+C to exit)")
+	fmt.Println("  --since-last-run     Mark tasks that became active or due since the previous run with ✨")
+	fmt.Println("  --reset-state        Forget the state remembered by --since-last-run")
+	fmt.Println("  --errors-as-json     Print only errored notes as JSON {file, line, message}; exit 1 if any")
+	fmt.Println("  --init-sample <dir>  Write example task notes into dir to try the tool on (--force overwrites)")
+	fmt.Println("  --validate-config    Check the config file and notes directory, print resolved settings, and exit (a --config file must set notes_dir, even with OBSIDIAN_NOTES_DIR set)")
+	fmt.Println("  --open <task>        Open the named task's note in Obsidian, or with open_command from the config")
+	fmt.Println("  --jsonl              Stream one JSON object per task as it is scanned, with a status field")
+	fmt.Println("  --json               Print all tasks as one JSON document with active, inactive and errors arrays")
+	fmt.Println("  --with-occurrences[=N]  With --json or --jsonl, add each task's active window and next N starts (default 5)")
+	fmt.Println("  --only-recurring     Show only tasks with an RRULE")
+	fmt.Println("  --only-onetime       Show only one-time events")
+	fmt.Println("  --active-only        Show only the active section (also --inactive-only, --errors-only)")
+	fmt.Println("  --show-completed     Also list tasks marked done: true or completed: <date>")
+	fmt.Println("  --hide-dates         Omit the due and next start dates, showing only names and schedules")
+	fmt.Println("  --compact            Print one line per section listing task names only")
+	fmt.Println("  --dashboard          Print a single status line of task counts (for tmux, polybar)")
+	fmt.Println("  --ascii              Use plain text instead of emoji symbols")
+	fmt.Println("  --no-links           Print task names without terminal hyperlinks (default when output isn't a terminal)")
+	fmt.Println("  --no-color           Print without ANSI colors (default when output isn't a terminal; NO_COLOR is honored too)")
+	fmt.Println("  --vault <name>       Use the path of a vault registered in Obsidian's obsidian.json")
+	fmt.Println("  --timeout <duration> Give up on a scan that takes longer, e.g. 30s, exiting non-zero")
+	fmt.Println("  --workers <n>        Notes classified in parallel (default: number of CPUs)")
+	fmt.Println("  --tag <tag>          Only show notes tagged with this tag (repeatable, case-insensitive, # optional)")
+	fmt.Println("  --tag-match <mode>   With several --tag flags, require all (default) or any of them")
+	fmt.Println("  --due-in <days>      Only show active tasks due, and inactive tasks starting, within this many days")
+	fmt.Println("  --include-archived   Also scan Archive/archive/_archive folders (see archive_dirs)")
+	fmt.Println("  --follow-symlinks    Also scan symlinked folders; folders reached twice are scanned once")
+	fmt.Println("  --notes-dir <path>   Scan this directory, ignoring OBSIDIAN_NOTES_DIR and config (~ and $VARS expanded)")
+	fmt.Println("  --ics                Print every task as an iCalendar event, repeating by its rrule")
+	fmt.Println("  --ics-feed <addr>    Serve occurrences as a calendar at http://<addr>/calendar.ics, e.g. :8080")
+	fmt.Println("  --align              Pad task names so the schedule columns line up")
+	fmt.Println("  --group-by folder|freq|tag  Group tasks in each section by folder, RRULE frequency or tag")
+	fmt.Println("  --group-sort name|count Order groups alphabetically (default) or busiest first")
+	fmt.Println("  --fix                Normalize lowercase rules, slashed dates and durations missing P (asks first)")
+	fmt.Println("  --normalize          Rewrite task front matter in a canonical form: ISO durations, dashed dates, uppercase rules, sorted tags (asks first)")
+	fmt.Println("  --dry-run            With --fix or --normalize, only print the proposed rewrites")
+	fmt.Println("  --first <file>       Print the first occurrence of a note's task")
+	fmt.Println("  --last <file>        Print the last occurrence of a COUNT/UNTIL series, or \"unbounded\"")
+	fmt.Println("  --progress           Show how much of each active task's window has elapsed, e.g. 60% elapsed [7/10 days]")
+	fmt.Println("  --date <date>        Evaluate tasks as of another day instead of today, e.g. 2025-12-01")
+	fmt.Println("  --series             Show the position in COUNT/UNTIL-limited series (occurrence 3 of 5)")
+	fmt.Println("  --wrap               Shorten task names with … so lines fit the terminal width")
+	fmt.Println("  --snippet            Show the first line of each note's body, dimmed, after the task")
+	fmt.Println("  --describe-rrule     Follow each rule with a plain-English description, e.g. [monthly on the 1st]")
+	fmt.Println("  --lint               List rules that are valid but likely wrong, e.g. FREQ=MONTHLY;BYDAY=FR (every Friday)")
+	fmt.Println("  --body-hints         Show 'est: 3h' estimates from the body of notes without a duration")
+	fmt.Println("  --deterministic-check  Scan twice at one frozen time and list tasks classified differently")
+	fmt.Println("  --verbose            Show each task's dtstart, duration and window; print diagnostic notes (expanded dates, scan time, slowest files) to stderr")
+	fmt.Println("  -h, --help           Show this help message")
 }
 
-// isOneTimeTaskActive wrapper for backward compatibility
-func isOneTimeTaskActive(fm *FrontMatter) bool {
-	if fm.DTStart == "" {
-		return false
+// formatStart formats a next start date, with the time of day when it has
+// one (sub-day tasks)
+func formatStart(t time.Time) string {
+	if t.Hour() == 0 && t.Minute() == 0 {
+		return t.Format("2006-01-02")
 	}
+	return t.Format("2006-01-02 15:04")
+}
 
-	today := time.Now().Truncate(24 * time.Hour)
-	startDate := parseStartDate(fm.DTStart)
-	duration, err := ParseDuration(fm.Duration)
-	if err != nil {
-		return false
+// taskOrders maps --sort values to the comparison ordering tasks
+var taskOrders = map[string]func(a, b agenda.Task) int{
+	"file": func(a, b agenda.Task) int { return strings.Compare(a.FilePath, b.FilePath) },
+	"name": func(a, b agenda.Task) int { return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)) },
+	"due":  func(a, b agenda.Task) int { return compareDates(a.DueDate, b.DueDate) },
+	"next": func(a, b agenda.Task) int { return compareDates(a.NextStart, b.NextStart) },
+}
+
+// taskDates maps the date --sort values to the date they order by
+var taskDates = map[string]func(task agenda.Task) *time.Time{
+	"due":  func(task agenda.Task) *time.Time { return task.DueDate },
+	"next": func(task agenda.Task) *time.Time { return task.NextStart },
+}
+
+// compareDates orders earlier dates first and missing dates last
+func compareDates(a, b *time.Time) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
 	}
+	return a.Compare(*b)
+}
 
-	endDate := startDate.Add(duration)
+// sortTasks orders tasks by one of taskOrders, breaking ties by file path,
+// reversing the comparison when desc is set. Tasks without the date sorted
+// by stay last either way.
+func sortTasks(tasks []agenda.Task, by string, desc bool) {
+	compare, date := taskOrders[by], taskDates[by]
+	slices.SortStableFunc(tasks, func(a, b agenda.Task) int {
+		c := compare(a, b)
+		if c == 0 {
+			c = strings.Compare(a.FilePath, b.FilePath)
+		}
+		if date != nil && (date(a) == nil) != (date(b) == nil) {
+			return c
+		}
+		if desc {
+			return -c
+		}
+		return c
+	})
+}
 
-	// Check if today falls within the event's active window
-	return (today.Equal(startDate) || today.After(startDate)) && today.Before(endDate)
+// sortResult orders every section of a scan as selected in opts
+func sortResult(result agenda.ScanResult, opts Options) {
+	desc := opts.SortDir == "desc"
+	sortTasks(result.Active, opts.Sort, desc)
+	sortTasks(result.Inactive, opts.Sort, desc)
+	sortTasks(result.Errored, opts.Sort, desc)
+	sortTasks(result.Completed, opts.Sort, desc)
 }
 
-// ParseStartDate parses dtstart string with fallback
-func ParseStartDate(dtStartStr string, fallbackDate time.Time) time.Time {
-	if dtStartStr == "" {
-		return fallbackDate
+// taskLabel returns the task name, hyperlinked to the note if it is in a vault
+func taskLabel(task agenda.Task) string {
+	if hyperlinks && task.Vault != nil && task.FilePath != "" {
+		uri := createObsidianURI(task.Vault.Name, task.FilePath, task.Vault.Path)
+		return createTerminalHyperlink(uri, task.Name)
 	}
+	return task.Name
+}
 
-	// Try parsing common date formats
-	formats := []string{
-		"2006-01-02",
-		"2006-01-02T15:04:05Z",
-		"2006-01-02T15:04:05",
-		"20060102T000000Z",
+// labelWidth returns the widest visible task label, used to align columns
+func labelWidth(tasks []agenda.Task) int {
+	width := 0
+	for _, task := range tasks {
+		width = max(width, displayWidth(taskLabel(task)))
 	}
+	return width
+}
 
-	for _, format := range formats {
-		if t, err := time.Parse(format, dtStartStr); err == nil {
-			return t.Truncate(24 * time.Hour)
-		}
+// dashboardLine summarizes active/inactive/error counts on one line
+func dashboardLine(result agenda.ScanResult, ascii bool) string {
+	if ascii {
+		return fmt.Sprintf("A:%d I:%d E:%d", len(result.Active), len(result.Inactive), len(result.Errored))
 	}
-
-	// If parsing fails, use fallback
-	return fallbackDate
+	return fmt.Sprintf("🟢%d ⚪%d 🔴%d", len(result.Active), len(result.Inactive), len(result.Errored))
 }
 
-// parseStartDate wrapper for backward compatibility
-func parseStartDate(dtStartStr string) time.Time {
-	fallback := time.Now().AddDate(-1, 0, 0).Truncate(24 * time.Hour)
-	return ParseStartDate(dtStartStr, fallback)
+// dueOn returns the tasks whose due date falls on day
+func dueOn(tasks []agenda.Task, day time.Time) []agenda.Task {
+	var due []agenda.Task
+	for _, task := range tasks {
+		if task.DueDate != nil && task.DueDate.Equal(day) {
+			due = append(due, task)
+		}
+	}
+	return due
 }
 
-// ApplyDefaults applies default values to frontmatter
-func ApplyDefaults(fm *FrontMatter, currentTime time.Time) (*FrontMatterWithDefaults, error) {
-	duration, err := ParseDuration(fm.Duration)
-	if err != nil {
-		return nil, fmt.Errorf("duration parsing error: %w", err)
+// compactLine renders a section as "Title (n): A, B, C", or "" when empty
+func compactLine(title string, tasks []agenda.Task) string {
+	if len(tasks) == 0 {
+		return ""
 	}
-
-	fallbackStartDate := currentTime.AddDate(-1, 0, 0).Truncate(24 * time.Hour)
-	startDate := ParseStartDate(fm.DTStart, fallbackStartDate)
-
-	return &FrontMatterWithDefaults{
-		RRule:    fm.RRule,
-		Duration: duration,
-		DTStart:  startDate,
-		Tags:     fm.Tags,
-	}, nil
+	names := make([]string, len(tasks))
+	for i, task := range tasks {
+		names[i] = taskLabel(task)
+	}
+	return fmt.Sprintf("%s (%d): %s", title, len(tasks), strings.Join(names, ", "))
 }
 
-func processFile(path string) Task {
-	fm, err := parseFrontMatter(path)
-	if err != nil {
-		if !strings.Contains(err.Error(), "no frontmatter") {
-			fmt.Println("Error processing", path+":", err)
+// printCompact prints one line per non-empty section (--compact)
+func printCompact(result agenda.ScanResult, now time.Time) {
+	sections := []struct {
+		title string
+		tasks []agenda.Task
+		color color.Attribute
+	}{
+		{"Active", result.Active, color.FgGreen},
+		{"Due today", dueOn(result.Active, now.Truncate(24*time.Hour)), color.FgRed},
+		{"Reminders", upcomingReminders(result, now), color.FgMagenta},
+		{"Inactive", result.Inactive, color.FgHiBlack},
+		{"Errors", result.Errored, color.FgYellow},
+		{"Completed", result.Completed, color.Faint},
+	}
+	for _, section := range sections {
+		if line := compactLine(section.title, section.tasks); line != "" {
+			color.New(section.color).Println(line)
 		}
-		return Task{}
 	}
+}
 
-	filename := cleanFilename(filepath.Base(path))
+func printTasks(title string, tasks []agenda.Task, nameColor color.Attribute, opts Options) {
+	if len(tasks) == 0 {
+		return
+	}
+	width := 0
+	if opts.Align {
+		width = labelWidth(tasks)
+	}
+	color.New(color.FgYellow, color.Bold).Println(sectionHeader(title, len(tasks)))
 
-	if fm.RRule != "" {
-		nextStart := getNextOccurrence(fm)
-		dueDate := getCurrentDueDate(fm)
-		return Task{Name: filename, RRule: fm.RRule, Duration: fm.Duration, NextStart: nextStart, DueDate: dueDate, FilePath: path}
-	} else if fm.DTStart != "" {
-		// Handle one-time events
-		dueDate := getOneTimeDueDate(fm)
-		startDate := parseStartDate(fm.DTStart)
-		return Task{Name: filename, RRule: "ONCE", Duration: fm.Duration, NextStart: &startDate, DueDate: dueDate, FilePath: path}
+	if opts.GroupBy == "" {
+		printTaskLines(color.Output, tasks, "  - ", width, nameColor, opts)
+		return
+	}
+	for _, group := range groupTasks(tasks, opts.GroupBy, opts.GroupSort) {
+		color.New(color.FgYellow).Printf("  %s (%d):\n", group.Name, len(group.Tasks))
+		printTaskLines(color.Output, group.Tasks, "    - ", width, nameColor, opts)
 	}
-	return Task{}
 }
 
-// IsTaskActive checks if task is active at given time
-func IsTaskActive(fm *FrontMatterWithDefaults, currentTime time.Time) (bool, error) {
-	today := currentTime.Truncate(24 * time.Hour)
+// printTaskLines writes one line per task: name, schedule and, unless
+// --hide-dates is set, the due or next start date
+func printTaskLines(w io.Writer, tasks []agenda.Task, bullet string, width int, nameColor color.Attribute, opts Options) {
+	for _, task := range tasks {
+		// Everything after the name is rendered first so --wrap knows how
+		// much room the name has
+		var suffix strings.Builder
+		if task.New {
+			if opts.ASCII {
+				color.New(color.FgMagenta).Fprint(&suffix, " *new*")
+			} else {
+				fmt.Fprint(&suffix, " ✨")
+			}
+		}
+		color.New(color.Reset).Fprint(&suffix, " ("+task.RRule)
+		if opts.DescribeRRule {
+			if description := DescribeRRule(task.RRule); description != "" {
+				color.New(color.Reset).Fprint(&suffix, " ["+description+"]")
+			}
+		}
+		if task.Duration != "" {
+			color.New(color.Reset).Fprint(&suffix, ", "+task.Duration)
+		}
+		if opts.Series && task.Series != nil {
+			color.New(color.Reset).Fprint(&suffix, ", "+task.Series.String())
+		}
 
-	if fm.RRule != "" {
-		// Create RRULE with proper DTSTART
-		rruleStr := "DTSTART:" + fm.DTStart.Format("20060102T000000Z") + "\nRRULE:" + fm.RRule
-		r, err := rrule.StrToRRule(rruleStr)
-		if err != nil {
-			return false, fmt.Errorf("RRULE parsing error: %w", err)
+		// Show due date for active tasks
+		if nameColor == color.FgGreen && task.DueDate != nil && !opts.HideDates {
+			today := agenda.Clock().Truncate(24 * time.Hour)
+			dateStr := task.DueDate.Format("2006-01-02")
+			days := int(task.DueDate.Sub(today) / (24 * time.Hour))
+			dueColor := color.New(dueDateColor(days, dueTiers))
+
+			if task.DueDate.Equal(today) {
+				// Bold warning if due today
+				dueColor.Add(color.Bold).Fprint(&suffix, " ⚠️ "+dateStr)
+			} else {
+				dueColor.Fprint(&suffix, " → "+dateStr)
+			}
+		}
+		if nameColor == color.FgGreen && opts.Progress && task.Progress != nil {
+			color.New(color.Reset).Fprintf(&suffix, ", %d%% elapsed", *task.Progress)
+			if task.Stage != nil {
+				color.New(color.Reset).Fprint(&suffix, " "+formatStage(*task.Stage))
+			}
 		}
 
-		// Get all occurrences from start date to today + duration
-		// (we need to check a bit into the future in case an occurrence + duration overlaps with today)
-		endDate := today.Add(fm.Duration)
-		occurrences := r.Between(fm.DTStart, endDate, true)
+		// Show next start date for inactive tasks
+		if nameColor == color.FgHiBlack && task.NextStart != nil && !opts.HideDates {
+			today := agenda.Clock().Truncate(24 * time.Hour)
+			color.New(nextStartColor(*task.NextStart, today, leadDays)).Fprint(&suffix, " → "+formatStart(*task.NextStart))
+		}
+
+		color.New(color.Reset).Fprint(&suffix, ")")
+		if opts.BodyHints && task.Estimate != "" {
+			color.New(color.FgMagenta).Fprint(&suffix, estimateBadge(task.Estimate, opts.ASCII))
+		}
+		if opts.Snippet && task.Snippet != "" {
+			color.New(color.Faint).Fprint(&suffix, "  "+truncateSnippet(task.Snippet, snippetWidth))
+		}
 
-		// Check if today falls within any occurrence's active window
-		for _, occurrence := range occurrences {
-			occurrenceStart := occurrence.Truncate(24 * time.Hour)
-			occurrenceEnd := occurrenceStart.Add(fm.Duration)
+		label := taskLabel(task)
+		labelColumns := width
+		if wrapWidth > 0 {
+			room := max(wrapWidth-displayWidth(bullet)-displayWidth(suffix.String()), minWrappedLabel)
+			label = truncateDisplay(label, room)
+			labelColumns = min(width, room)
+		}
 
-			if (today.Equal(occurrenceStart) || today.After(occurrenceStart)) && today.Before(occurrenceEnd) {
-				return true, nil
+		fmt.Fprint(w, bullet)
+		color.New(nameColor, color.Bold).Fprint(w, label)
+		if labelColumns > 0 {
+			fmt.Fprint(w, strings.Repeat(" ", max(labelColumns-displayWidth(label), 0)))
+		}
+		fmt.Fprintln(w, suffix.String())
+		if opts.Verbose {
+			if details := scheduleDetails(task); details != "" {
+				color.New(color.Faint).Fprintln(w, strings.Repeat(" ", displayWidth(bullet)+2)+details)
 			}
 		}
+	}
+}
+
+// formatStage renders how far into its window a task is, e.g. [7/10 days]
+// or [2/4 hours]
+func formatStage(stage agenda.Stage) string {
+	unit := "day"
+	if stage.Hours {
+		unit = "hour"
+	}
+	if stage.Total != 1 {
+		unit += "s"
+	}
+	return fmt.Sprintf("[%d/%d %s]", stage.Current, stage.Total, unit)
+}
 
-		return false, nil
-	} else if !fm.DTStart.IsZero() {
-		// Handle one-time events
-		return IsOneTimeTaskActive(fm, currentTime), nil
+// scheduleDetails describes how a task's schedule was resolved, for
+// --verbose: its dtstart and duration, then the active window with its
+// exclusive end, or else the next start
+func scheduleDetails(task agenda.Task) string {
+	if task.Start.IsZero() {
+		return ""
+	}
+	details := fmt.Sprintf("dtstart %s, duration %s", formatStart(task.Start), task.Length)
+	switch {
+	case task.Window != nil:
+		details += fmt.Sprintf(", window [%s, %s)", formatStart(task.Window.Start), formatStart(task.Window.End))
+	case task.NextStart != nil:
+		details += ", next " + formatStart(*task.NextStart)
 	}
+	return details
+}
 
-	return false, nil
+// nextStartColor picks the color of an inactive task's next start: yellow
+// when it starts within leadDays of today, cyan otherwise
+func nextStartColor(nextStart, today time.Time, leadDays int) color.Attribute {
+	if leadDays > 0 && nextStart.Before(today.AddDate(0, 0, leadDays+1)) {
+		return color.FgYellow
+	}
+	return color.FgCyan
 }
 
-// isTaskActive wrapper for backward compatibility (uses file I/O)
-func isTaskActive(path string) (bool, error) {
-	fm, err := parseFrontMatter(path)
-	if err != nil {
-		return false, nil // No front matter is not an error
+// dueDateColor maps days until due to a color tier: red up to tiers[0]
+// (today or overdue), orange up to tiers[1], yellow up to tiers[2], then green
+func dueDateColor(days int, tiers []int) color.Attribute {
+	// The 16-color palette has no orange; bright red is the closest
+	colors := []color.Attribute{color.FgRed, color.FgHiRed, color.FgYellow}
+	for i, limit := range tiers {
+		if days <= limit {
+			return colors[i]
+		}
 	}
+	return color.FgGreen
+}
 
-	fmWithDefaults, err := ApplyDefaults(fm, time.Now())
-	if err != nil {
-		return false, err
+// validateDueTiers checks a due_tiers setting: three non-decreasing day limits
+func validateDueTiers(tiers []int) error {
+	if len(tiers) != 3 {
+		return fmt.Errorf("invalid due_tiers %v: expected three day limits for red, orange and yellow", tiers)
+	}
+	for i := 1; i < len(tiers); i++ {
+		if tiers[i] < tiers[i-1] {
+			return fmt.Errorf("invalid due_tiers %v: limits must not decrease", tiers)
+		}
 	}
+	return nil
+}
 
-	return IsTaskActive(fmWithDefaults, time.Now())
+// truncateSnippet shortens s to at most width display columns, marking the
+// cut with an ellipsis
+func truncateSnippet(s string, width int) string {
+	if displayWidth(s) <= width {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 && displayWidth(string(runes))+1 > width {
+		runes = runes[:len(runes)-1]
+	}
+	return strings.TrimRight(string(runes), " ") + "…"
 }
 
-func cleanFilename(filename string) string {
-	// Remove date prefixes like "2025-05-22 ", "2025-05-22_", "2025.05.22 ", etc.
-	datePattern := regexp.MustCompile(`^(\d{4}[-_.]\d{1,2}[-_.]\d{1,2}[\s_-]*)+`)
-	cleaned := datePattern.ReplaceAllString(filename, "")
-	cleaned = strings.TrimSuffix(cleaned, ".md")
+func printTasksWithErrors(w io.Writer, title string, tasks []agenda.Task, nameColor color.Attribute, opts Options) {
+	if len(tasks) == 0 {
+		return
+	}
+	width := 0
+	if opts.Align {
+		width = labelWidth(tasks)
+	}
+	color.New(color.FgYellow, color.Bold).Fprintln(w, sectionHeader(title, len(tasks)))
+	for _, group := range groupErrors(tasks) {
+		color.New(color.FgYellow).Fprintf(w, "  %s (%d):\n", group.Name, len(group.Tasks))
+		for _, task := range group.Tasks {
+			fmt.Fprint(w, "    - ")
+
+			label := taskLabel(task)
+			color.New(nameColor, color.Bold).Fprint(w, label)
+			if width > 0 {
+				fmt.Fprint(w, strings.Repeat(" ", width-displayWidth(label)))
+			}
+			if task.RRule != "" {
+				color.New(color.Reset).Fprint(w, " ("+task.RRule)
+				if task.Duration != "" {
+					color.New(color.Reset).Fprint(w, ", "+task.Duration)
+				}
+				color.New(color.Reset).Fprint(w, ")")
+			}
+
+			// Show error message
+			if task.Error != nil {
+				color.New(color.FgRed).Fprint(w, " ❌ "+task.Error.Error())
+			}
 
-	return cleaned
+			fmt.Fprintln(w)
+		}
+	}
 }
@@ -1,264 +1,857 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/fatih/color"
+	"github.com/harnyk/obsidian-tasks/agenda"
 )
 
-func TestIsTaskActive(t *testing.T) {
-	// Create temporary directory for test files
-	tempDir := t.TempDir()
+func writeNote(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	return path
+}
+
+func TestEmptyScanMessage(t *testing.T) {
+	dir := t.TempDir()
+	writeNote(t, dir, "readme.txt", "not markdown\n")
+
+	result, err := agenda.ScanNotes(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("scanNotes failed: %v", err)
+	}
+	if got, want := emptyScanMessage(result, dir), "No markdown files found under "+dir; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+
+	writeNote(t, dir, "plain.md", "# Just a note\n")
+	result, err = agenda.ScanNotes(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("scanNotes failed: %v", err)
+	}
+	if got, want := emptyScanMessage(result, dir), "No tasks found in 1 markdown files under "+dir; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+
+	writeNote(t, dir, "daily.md", "---\nrrule: FREQ=DAILY\n---\n")
+	result, err = agenda.ScanNotes(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("scanNotes failed: %v", err)
+	}
+	if got := emptyScanMessage(result, dir); got != "" {
+		t.Errorf("Expected no message once tasks are found, got %q", got)
+	}
+}
+
+func TestSummaryLine(t *testing.T) {
+	dir := t.TempDir()
+	writeNote(t, dir, "daily.md", "---\nrrule: FREQ=DAILY\ntags: [home]\n---\n")
+	writeNote(t, dir, "standup.md", "---\nrrule: FREQ=DAILY\n---\n")
+	writeNote(t, dir, "later.md", "---\ndtstart: 2999-01-01\ntags: [home]\n---\n")
+	writeNote(t, dir, "broken.md", "---\nrrule: [\n---\n")
+
+	result, err := scanFiltered(context.Background(), dir, Options{})
+	if err != nil {
+		t.Fatalf("scanFiltered failed: %v", err)
+	}
+	if got, want := summaryLine(result), "2 active, 1 inactive, 1 error"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+
+	result, err = scanFiltered(context.Background(), dir, Options{Tags: []string{"home"}})
+	if err != nil {
+		t.Fatalf("scanFiltered failed: %v", err)
+	}
+	if got, want := summaryLine(result), "1 active, 1 inactive, 1 error"; got != want {
+		t.Errorf("Expected counts after --tag filtering %q, got %q", want, got)
+	}
+
+	result.Errored = nil
+	result.Completed = []agenda.Task{{Name: "done"}}
+	if got, want := summaryLine(result), "1 active, 1 inactive, 0 errors, 1 completed"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestParseFlagsWorkers(t *testing.T) {
+	if opts, err := parseFlags([]string{"--workers", "3"}); err != nil || opts.Workers != 3 {
+		t.Errorf("Expected --workers 3, got %d (err %v)", opts.Workers, err)
+	}
+	if _, err := parseFlags([]string{"--workers", "-1"}); err == nil {
+		t.Error("Expected an error for negative --workers")
+	}
+}
+
+func TestSortTasks(t *testing.T) {
+	tasks := []agenda.Task{
+		{Name: "b", FilePath: "notes/b.md"},
+		{Name: "c", FilePath: "notes/c.md"},
+		{Name: "a", FilePath: "notes/a.md"},
+	}
 
-	// Test assumes current date is Friday, September 26, 2025 (as in current output)
+	sortTasks(tasks, "file", false)
+	if got := tasks[0].Name + tasks[1].Name + tasks[2].Name; got != "abc" {
+		t.Errorf("Ascending: expected order abc, got %s", got)
+	}
+
+	sortTasks(tasks, "file", true)
+	if got := tasks[0].Name + tasks[1].Name + tasks[2].Name; got != "cba" {
+		t.Errorf("Descending: expected order cba, got %s", got)
+	}
+}
+
+func TestSortTasksByKey(t *testing.T) {
+	day := func(d int) *time.Time {
+		date := time.Date(2025, 3, d, 0, 0, 0, 0, time.UTC)
+		return &date
+	}
+	tasks := []agenda.Task{
+		{Name: "Water plants", FilePath: "notes/a.md", DueDate: day(9), NextStart: day(2)},
+		{Name: "bills", FilePath: "notes/b.md"},
+		{Name: "Clean", FilePath: "notes/c.md", DueDate: day(3), NextStart: day(5)},
+		{Name: "archive", FilePath: "notes/d.md", DueDate: day(3)},
+	}
+	order := func() string {
+		var names []string
+		for _, task := range tasks {
+			names = append(names, task.Name)
+		}
+		return strings.Join(names, ",")
+	}
 
 	tests := []struct {
-		name        string
-		frontMatter string
-		expected    bool
-		description string
+		by       string
+		desc     bool
+		expected string
 	}{
-		{
-			name: "monthly_task_active_1",
-			frontMatter: `---
-rrule: FREQ=MONTHLY;BYMONTHDAY=20
-duration: P10D
-dtstart: 2024-01-20
----`,
-			expected:    true,
-			description: "Monthly task on 20th with 10-day duration should be active on Sep 26",
-		},
-		{
-			name: "monthly_task_active_2",
-			frontMatter: `---
-rrule: FREQ=MONTHLY;BYMONTHDAY=-5
-duration: P5D
-dtstart: 2024-01-26
----`,
-			expected:    true,
-			description: "Monthly task on last 5th day with 5-day duration should be active on Sep 26",
-		},
-		{
-			name: "monthly_task_inactive_1",
-			frontMatter: `---
-rrule: FREQ=MONTHLY;BYMONTHDAY=12
-duration: P6D
-dtstart: 2024-01-12
----`,
-			expected:    false,
-			description: "Monthly task on 12th with 6-day duration should be inactive on Sep 26",
-		},
-		{
-			name: "monthly_task_inactive_2",
-			frontMatter: `---
-rrule: FREQ=MONTHLY;BYMONTHDAY=1
-dtstart: 2024-01-01
----`,
-			expected:    false,
-			description: "Monthly task on 1st with default duration should be inactive on Sep 26",
-		},
-		{
-			name: "monthly_task_inactive_3",
-			frontMatter: `---
-rrule: FREQ=MONTHLY;BYMONTHDAY=1
-duration: P3D
-dtstart: 2024-01-01
----`,
-			expected:    false,
-			description: "Monthly task on 1st with 3-day duration should be inactive on Sep 26",
-		},
-		{
-			name: "weekly_task_should_be_active",
-			frontMatter: `---
-rrule: FREQ=WEEKLY;BYDAY=FR
-dtstart: 2024-01-05
----`,
-			expected:    true,
-			description: "Weekly Friday task should be active on Friday Sep 26",
-		},
-		{
-			name: "one_time_task_inactive",
-			frontMatter: `---
-dtstart: 2025-10-18
-duration: P6D
----`,
-			expected:    false,
-			description: "One-time task starting Oct 18 should be inactive on Sep 26",
-		},
-	}
-
-	// Note: These tests assume the current date is Friday, September 26, 2025
-	// as shown in the actual program output
-
+		{"due", false, "Clean,archive,Water plants,bills"},
+		{"next", false, "Water plants,Clean,bills,archive"},
+		{"name", false, "archive,bills,Clean,Water plants"},
+		{"file", false, "Water plants,bills,Clean,archive"},
+		{"due", true, "Water plants,archive,Clean,bills"},
+		{"next", true, "Clean,Water plants,archive,bills"},
+		{"name", true, "Water plants,Clean,bills,archive"},
+	}
 	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			// Create temporary test file
-			testFile := filepath.Join(tempDir, tt.name+".md")
-			err := os.WriteFile(testFile, []byte(tt.frontMatter), 0644)
-			if err != nil {
-				t.Fatalf("Failed to create test file: %v", err)
-			}
+		sortTasks(tasks, tt.by, tt.desc)
+		if got := order(); got != tt.expected {
+			t.Errorf("--sort %s (desc %v): expected %s, got %s", tt.by, tt.desc, tt.expected, got)
+		}
+	}
+}
 
-			// Test the function
-			result, err := isTaskActive(testFile)
-			if err != nil && tt.expected {
-				t.Errorf("%s: unexpected error: %v - %s", tt.name, err, tt.description)
-			}
-			if result != tt.expected {
-				t.Errorf("%s: expected %v, got %v - %s", tt.name, tt.expected, result, tt.description)
-			}
-		})
+func TestParseFlagsSort(t *testing.T) {
+	opts, err := parseFlags(nil)
+	if err != nil || opts.Sort != "file" {
+		t.Errorf("Default: expected file, got %q (err %v)", opts.Sort, err)
+	}
+	opts, err = parseFlags([]string{"--sort", "due"})
+	if err != nil || opts.Sort != "due" {
+		t.Errorf("Expected due, got %q (err %v)", opts.Sort, err)
+	}
+	if _, err := parseFlags([]string{"--sort=size"}); err == nil {
+		t.Errorf("Expected error for invalid --sort")
 	}
 }
 
-func TestParseDuration(t *testing.T) {
+func TestParseFlagsSortDir(t *testing.T) {
+	opts, err := parseFlags(nil)
+	if err != nil || opts.SortDir != "asc" {
+		t.Errorf("Default: expected asc, got %q (err %v)", opts.SortDir, err)
+	}
+
+	opts, err = parseFlags([]string{"--sort-dir", "desc"})
+	if err != nil || opts.SortDir != "desc" {
+		t.Errorf("Expected desc, got %q (err %v)", opts.SortDir, err)
+	}
+
+	if _, err := parseFlags([]string{"--sort-dir=sideways"}); err == nil {
+		t.Errorf("Expected error for invalid --sort-dir")
+	}
+}
+
+func TestDashboardLine(t *testing.T) {
+	result := agenda.ScanResult{
+		Active:   make([]agenda.Task, 3),
+		Inactive: make([]agenda.Task, 7),
+		Errored:  make([]agenda.Task, 1),
+	}
+
+	if got := dashboardLine(result, false); got != "🟢3 ⚪7 🔴1" {
+		t.Errorf("Emoji: expected %q, got %q", "🟢3 ⚪7 🔴1", got)
+	}
+	if got := dashboardLine(result, true); got != "A:3 I:7 E:1" {
+		t.Errorf("ASCII: expected %q, got %q", "A:3 I:7 E:1", got)
+	}
+}
+
+func TestFindObsidianVault(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "obsidian.json")
+	sample := `{
+  "vaults": {
+    "0f1e2d3c4b5a6978": {"path": "/home/user/Documents/Personal", "ts": 1727000000000, "open": true},
+    "8a7b6c5d4e3f2a1b": {"path": "/home/user/Work Notes", "ts": 1726000000000}
+  },
+  "frame": "hidden"
+}`
+	if err := os.WriteFile(configPath, []byte(sample), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
 	tests := []struct {
-		input    string
-		expected time.Duration
-		hasError bool
+		name      string
+		expected  string
+		expectErr bool
 	}{
-		{"", 24 * time.Hour, false},          // Default 1 day
-		{"P1D", 24 * time.Hour, false},       // 1 day
-		{"P10D", 10 * 24 * time.Hour, false}, // 10 days
-		{"P5D", 5 * 24 * time.Hour, false},   // 5 days
-		{"P6D", 6 * 24 * time.Hour, false},   // 6 days
-		{"P3D", 3 * 24 * time.Hour, false},   // 3 days
-		{"P1W", 7 * 24 * time.Hour, false},   // 1 week
-		{"PT2H", 2 * time.Hour, false},       // 2 hours
-		{"PT30M", 30 * time.Minute, false},   // 30 minutes
-		{"P1DT2H", 26 * time.Hour, false},    // 1 day + 2 hours
-		{"invalid", 0, true},                 // Invalid format
+		{"Personal", "/home/user/Documents/Personal", false},
+		{"Work Notes", "/home/user/Work Notes", false},
+		{"work notes", "/home/user/Work Notes", false},
+		{"Missing", "", true},
 	}
 
 	for _, tt := range tests {
-		t.Run(tt.input, func(t *testing.T) {
-			result, err := ParseDuration(tt.input)
-			if tt.hasError {
+		t.Run(tt.name, func(t *testing.T) {
+			path, err := findObsidianVault(configPath, tt.name)
+			if tt.expectErr {
 				if err == nil {
-					t.Errorf("Expected error for input %q, got none", tt.input)
-				}
-			} else {
-				if err != nil {
-					t.Errorf("Unexpected error for input %q: %v", tt.input, err)
-				}
-				if result != tt.expected {
-					t.Errorf("For input %q: expected %v, got %v", tt.input, tt.expected, result)
+					t.Errorf("Expected error for %q, got path %q", tt.name, path)
 				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if path != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, path)
 			}
 		})
 	}
+
+	if _, err := findObsidianVault(filepath.Join(dir, "missing.json"), "Personal"); err == nil {
+		t.Errorf("Expected error for missing obsidian.json")
+	}
 }
 
-func TestParseStartDate(t *testing.T) {
+func TestDisplayWidth(t *testing.T) {
+	uri := createObsidianURI("Vault", "/vault/Tasks/Pay rent.md", "/vault")
+
 	tests := []struct {
+		name     string
 		input    string
-		expected time.Time
+		expected int
 	}{
-		{"2024-01-20", time.Date(2024, 1, 20, 0, 0, 0, 0, time.UTC)},
-		{"2024-01-26", time.Date(2024, 1, 26, 0, 0, 0, 0, time.UTC)},
-		{"2024-01-12", time.Date(2024, 1, 12, 0, 0, 0, 0, time.UTC)},
-		{"2024-01-01", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
-		{"2024-01-05", time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)},
-		{"2025-10-18", time.Date(2025, 10, 18, 0, 0, 0, 0, time.UTC)},
+		{"plain", "Pay rent", 8},
+		{"hyperlinked", createTerminalHyperlink(uri, "Pay rent"), 8},
+		{"hyperlinked_cyrillic", createTerminalHyperlink(uri, "Оплата"), 6},
+		{"colored", "\x1b[1;32mPay rent\x1b[0m", 8},
+		{"wide_cjk", "家計簿", 6},
+		{"emoji", "📓 Vault", 8},
+		{"bel_terminated_osc", "\x1b]8;;https://example.com\x07link\x1b]8;;\x07", 4},
 	}
 
 	for _, tt := range tests {
-		t.Run(tt.input, func(t *testing.T) {
-			result := parseStartDate(tt.input)
-			if !result.Equal(tt.expected) {
-				t.Errorf("For input %q: expected %v, got %v", tt.input, tt.expected, result)
+		t.Run(tt.name, func(t *testing.T) {
+			if result := displayWidth(tt.input); result != tt.expected {
+				t.Errorf("Expected width %d, got %d for %q", tt.expected, result, tt.input)
 			}
 		})
 	}
 }
 
-func TestParseFrontMatter(t *testing.T) {
+func TestLabelWidth(t *testing.T) {
+	vault := &agenda.VaultInfo{Name: "Vault", Path: "/vault"}
+	tasks := []agenda.Task{
+		{Name: "Short", FilePath: "/vault/Short.md"},
+		{Name: "A longer name", FilePath: "/vault/A longer name.md"},
+	}
+
+	if width := labelWidth(tasks); width != 13 {
+		t.Errorf("Without vault: expected width 13, got %d", width)
+	}
+	for i := range tasks {
+		tasks[i].Vault = vault
+	}
+	if width := labelWidth(tasks); width != 13 {
+		t.Errorf("Expected width 13, got %d", width)
+	}
+}
+
+func TestCreateObsidianURI(t *testing.T) {
 	tests := []struct {
-		name        string
-		content     string
-		expected    *FrontMatter
-		expectError bool
+		name      string
+		vaultName string
+		vaultPath string
+		filePath  string
+		expected  string
 	}{
-		{
-			name: "valid_frontmatter",
-			content: `---
-rrule: FREQ=WEEKLY;BYDAY=FR
-duration: P1D
-dtstart: 2024-01-05
----
-
-# Task content`,
-			expected: &FrontMatter{
-				RRule:    "FREQ=WEEKLY;BYDAY=FR",
-				Duration: "P1D",
-				DTStart:  "2024-01-05",
-				Tags:     nil,
-			},
-			expectError: false,
-		},
-		{
-			name:        "no_frontmatter",
-			content:     "# Regular markdown file",
-			expectError: true,
-		},
+		{"ascii_with_spaces", "My Vault", "/home/u/My Vault", "/home/u/My Vault/Tasks/Pay rent.md", "Tasks/Pay rent"},
+		{"cyrillic", "Нотатки", "/home/u/Нотатки", "/home/u/Нотатки/Завдання/Оплата.md", "Завдання/Оплата"},
+		{"emoji", "Vault 🧠", "/home/u/Vault 🧠", "/home/u/Vault 🧠/🏠 Home/🧹 Clean.md", "🏠 Home/🧹 Clean"},
+		{"cjk", "ノート", "/home/u/ノート", "/home/u/ノート/家計簿.md", "家計簿"},
+		{"query_metacharacters", "R&D", "/home/u/R&D", "/home/u/R&D/C++ & Go = fun #1?.md", "C++ & Go = fun #1?"},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := ParseFrontMatter(tt.content)
+			uri := createObsidianURI(tt.vaultName, tt.filePath, tt.vaultPath)
 
-			if tt.expectError {
-				if err == nil {
-					t.Errorf("Expected error but got none")
-				}
-				return
+			if strings.Contains(uri, " ") || strings.Contains(uri, "+") {
+				t.Errorf("URI must encode spaces as %%20 and contain no raw spaces or '+': %s", uri)
 			}
 
+			parsed, err := url.Parse(uri)
 			if err != nil {
-				t.Errorf("Unexpected error: %v", err)
-				return
+				t.Fatalf("URI does not parse: %v", err)
+			}
+			query := parsed.Query()
+			if vault := query.Get("vault"); vault != tt.vaultName {
+				t.Errorf("vault: expected %q, got %q (uri %s)", tt.vaultName, vault, uri)
+			}
+			if file := query.Get("file"); file != tt.expected {
+				t.Errorf("file: expected %q, got %q (uri %s)", tt.expected, file, uri)
 			}
+		})
+	}
+}
 
-			if result.RRule != tt.expected.RRule {
-				t.Errorf("RRule: expected %q, got %q", tt.expected.RRule, result.RRule)
+func TestCreateObsidianURI_SpaceEncoding(t *testing.T) {
+	uri := createObsidianURI("My Vault", "/v/Weekly review.md", "/v")
+	expected := "obsidian://open?vault=My%20Vault&file=Weekly%20review"
+	if uri != expected {
+		t.Errorf("Expected %s, got %s", expected, uri)
+	}
+}
+
+func TestFormatStart(t *testing.T) {
+	if got := formatStart(time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC)); got != "2025-03-10" {
+		t.Errorf("Expected a bare date, got %q", got)
+	}
+	if got := formatStart(time.Date(2025, 3, 10, 9, 30, 0, 0, time.UTC)); got != "2025-03-10 09:30" {
+		t.Errorf("Expected the time of day, got %q", got)
+	}
+}
+
+func TestTruncateSnippet(t *testing.T) {
+	tests := []struct {
+		input    string
+		width    int
+		expected string
+	}{
+		{"short", 10, "short"},
+		{"exactly ten", 11, "exactly ten"},
+		{"a longer line of text", 10, "a longer…"},
+		{"日本語のメモです", 7, "日本語…"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got := truncateSnippet(tt.input, tt.width)
+			if got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+			if displayWidth(got) > tt.width {
+				t.Errorf("%q is wider than %d", got, tt.width)
 			}
 		})
 	}
 }
 
-func TestPipeline_Integration(t *testing.T) {
-	// Test the full pipeline: ParseFrontMatter -> ApplyDefaults -> IsTaskActive
-	currentTime := time.Date(2025, 9, 26, 12, 0, 0, 0, time.UTC) // Friday, Sep 26, 2025
+func TestNextStartColor(t *testing.T) {
+	today := time.Date(2025, 9, 26, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		days     int
+		leadDays int
+		expected color.Attribute
+	}{
+		{"tomorrow_within_lead", 1, 3, color.FgYellow},
+		{"last_lead_day", 3, 3, color.FgYellow},
+		{"beyond_lead", 4, 3, color.FgCyan},
+		{"lead_disabled", 1, 0, color.FgCyan},
+	}
 
-	content := `---
-rrule: FREQ=WEEKLY;BYDAY=FR
-duration: P1D
-dtstart: 2024-01-05
----
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := nextStartColor(today.AddDate(0, 0, tt.days), today, tt.leadDays)
+			if got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
 
-# Weekly Friday Task`
+func TestLoadConfigFiles_Merge(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	base := write("base.yaml", "notes_dir: /vault\nweek_start: MO\nread_retries: 5\nascii: true\n")
+	machine := write("machine.yaml", "notes_dir: /mnt/vault\nweek_start: SU\nascii: false\n")
 
-	// Step 1: Parse
-	fm, err := ParseFrontMatter(content)
+	config, err := loadConfigFiles([]string{base, machine})
 	if err != nil {
-		t.Fatalf("ParseFrontMatter failed: %v", err)
+		t.Fatalf("loadConfigFiles failed: %v", err)
+	}
+	if config.NotesDir != "/mnt/vault" || config.WeekStart != "SU" {
+		t.Errorf("Expected later file to win, got %+v", config)
 	}
+	if config.ReadRetries != 5 {
+		t.Errorf("Expected read_retries inherited from the base file, got %d", config.ReadRetries)
+	}
+	if config.ASCII {
+		t.Errorf("Expected an explicit false in the later file to override true")
+	}
+
+	if _, err := loadConfigFiles([]string{base, filepath.Join(dir, "missing.yaml")}); err == nil {
+		t.Errorf("Expected error for a missing config file")
+	}
+}
 
-	// Step 2: Apply defaults
-	fmWithDefaults, err := ApplyDefaults(fm, currentTime)
+func TestParseFlagsRepeatedConfig(t *testing.T) {
+	opts, err := parseFlags([]string{"--config", "base.yaml", "--config=local.yaml"})
 	if err != nil {
-		t.Fatalf("ApplyDefaults failed: %v", err)
+		t.Fatalf("parseFlags failed: %v", err)
+	}
+	if len(opts.Configs) != 2 || opts.Configs[0] != "base.yaml" || opts.Configs[1] != "local.yaml" {
+		t.Errorf("Expected both config files in order, got %v", opts.Configs)
 	}
+}
 
-	// Step 3: Check if active
-	isActive, err := IsTaskActive(fmWithDefaults, currentTime)
+func TestCompactLine(t *testing.T) {
+	today := time.Date(2025, 9, 26, 0, 0, 0, 0, time.UTC)
+	tomorrow := today.AddDate(0, 0, 1)
+	active := []agenda.Task{
+		{Name: "A", FilePath: "/vault/A.md", DueDate: &today},
+		{Name: "B", FilePath: "/vault/B.md", DueDate: &tomorrow},
+		{Name: "C", FilePath: "/vault/C.md"},
+	}
+
+	if got := compactLine("Active", active); got != "Active (3): A, B, C" {
+		t.Errorf("Unexpected active line %q", got)
+	}
+	if got := compactLine("Due today", dueOn(active, today)); got != "Due today (1): A" {
+		t.Errorf("Unexpected due line %q", got)
+	}
+	if got := compactLine("Inactive", nil); got != "" {
+		t.Errorf("Expected empty section to be omitted, got %q", got)
+	}
+
+	active[0].Vault = &agenda.VaultInfo{Name: "vault", Path: "/vault"}
+	if got := compactLine("Active", active[:1]); !strings.Contains(got, "\x1b]8;;obsidian://") {
+		t.Errorf("Expected names to be hyperlinked inside a vault, got %q", got)
+	}
+}
+
+func TestDueDateColor(t *testing.T) {
+	tiers := []int{0, 2, 7}
+	tests := []struct {
+		days     int
+		expected color.Attribute
+	}{
+		{-3, color.FgRed}, // overdue
+		{0, color.FgRed},  // today
+		{1, color.FgHiRed},
+		{2, color.FgHiRed},
+		{3, color.FgYellow},
+		{7, color.FgYellow},
+		{8, color.FgGreen},
+	}
+
+	for _, tt := range tests {
+		if got := dueDateColor(tt.days, tiers); got != tt.expected {
+			t.Errorf("%d days: expected %v, got %v", tt.days, tt.expected, got)
+		}
+	}
+
+	if got := dueDateColor(5, []int{1, 5, 10}); got != color.FgHiRed {
+		t.Errorf("Custom tiers: expected orange at 5 days, got %v", got)
+	}
+}
+
+func TestValidateDueTiers(t *testing.T) {
+	if err := validateDueTiers([]int{0, 2, 7}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := validateDueTiers([]int{1, 1, 1}); err != nil {
+		t.Errorf("Equal limits should be allowed: %v", err)
+	}
+	for _, tiers := range [][]int{{0, 2}, {0, 2, 7, 9}, {3, 2, 7}} {
+		if err := validateDueTiers(tiers); err == nil {
+			t.Errorf("Expected error for %v", tiers)
+		}
+	}
+}
+
+func TestPrintTaskLines_HideDates(t *testing.T) {
+	originalNoColor := color.NoColor
+	color.NoColor = true
+	t.Cleanup(func() { color.NoColor = originalNoColor })
+
+	due := time.Date(2999, 1, 3, 0, 0, 0, 0, time.UTC)
+	next := time.Date(2999, 2, 1, 0, 0, 0, 0, time.UTC)
+	active := []agenda.Task{{Name: "Invoice", RRule: "FREQ=MONTHLY", Duration: "P3D", DueDate: &due}}
+	inactive := []agenda.Task{{Name: "Taxes", RRule: "FREQ=YEARLY", NextStart: &next}}
+
+	var out strings.Builder
+	printTaskLines(&out, active, "  - ", 0, color.FgGreen, Options{})
+	printTaskLines(&out, inactive, "  - ", 0, color.FgHiBlack, Options{})
+	if !strings.Contains(out.String(), "2999-01-03") || !strings.Contains(out.String(), "2999-02-01") {
+		t.Fatalf("Expected dates by default, got:\n%s", out.String())
+	}
+
+	out.Reset()
+	printTaskLines(&out, active, "  - ", 0, color.FgGreen, Options{HideDates: true})
+	printTaskLines(&out, inactive, "  - ", 0, color.FgHiBlack, Options{HideDates: true})
+	expected := "  - Invoice (FREQ=MONTHLY, P3D)\n  - Taxes (FREQ=YEARLY)\n"
+	if out.String() != expected {
+		t.Errorf("Expected:\n%q\ngot:\n%q", expected, out.String())
+	}
+}
+
+func TestFormatStage(t *testing.T) {
+	tests := []struct {
+		stage    agenda.Stage
+		expected string
+	}{
+		{agenda.Stage{Current: 7, Total: 10}, "[7/10 days]"},
+		{agenda.Stage{Current: 1, Total: 1}, "[1/1 day]"},
+		{agenda.Stage{Current: 2, Total: 4, Hours: true}, "[2/4 hours]"},
+	}
+	for _, tt := range tests {
+		if got := formatStage(tt.stage); got != tt.expected {
+			t.Errorf("%+v: expected %q, got %q", tt.stage, tt.expected, got)
+		}
+	}
+
+	originalNoColor := color.NoColor
+	color.NoColor = true
+	t.Cleanup(func() { color.NoColor = originalNoColor })
+
+	percent := 60
+	tasks := []agenda.Task{{Name: "Sprint", RRule: "FREQ=WEEKLY", Duration: "P10D", Progress: &percent, Stage: &agenda.Stage{Current: 7, Total: 10}}}
+	var out strings.Builder
+	printTaskLines(&out, tasks, "  - ", 0, color.FgGreen, Options{Progress: true})
+	if expected := "  - Sprint (FREQ=WEEKLY, P10D, 60% elapsed [7/10 days])\n"; out.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, out.String())
+	}
+}
+
+func TestPrintTaskLinesVerbose(t *testing.T) {
+	originalNoColor := color.NoColor
+	color.NoColor = true
+	t.Cleanup(func() { color.NoColor = originalNoColor })
+
+	start := time.Date(2025, 1, 6, 0, 0, 0, 0, time.UTC)
+	due := time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC)
+	next := time.Date(2025, 12, 8, 0, 0, 0, 0, time.UTC)
+	window := &agenda.Occurrence{Start: due, End: due.AddDate(0, 0, 1), Active: true}
+	length := agenda.CalendarDuration{Duration: 24 * time.Hour}
+	active := []agenda.Task{{Name: "Monday", RRule: "FREQ=WEEKLY;BYDAY=MO", DueDate: &due, Start: start, Length: length, Window: window}}
+	inactive := []agenda.Task{{Name: "Monday", RRule: "FREQ=WEEKLY;BYDAY=MO", NextStart: &next, Start: start, Length: length}}
+
+	var out strings.Builder
+	printTaskLines(&out, active, "  - ", 0, color.FgGreen, Options{Verbose: true, HideDates: true})
+	printTaskLines(&out, inactive, "  - ", 0, color.FgHiBlack, Options{Verbose: true, HideDates: true})
+	expected := "  - Monday (FREQ=WEEKLY;BYDAY=MO)\n" +
+		"      dtstart 2025-01-06, duration P1D, window [2025-12-01, 2025-12-02)\n" +
+		"  - Monday (FREQ=WEEKLY;BYDAY=MO)\n" +
+		"      dtstart 2025-01-06, duration P1D, next 2025-12-08\n"
+	if out.String() != expected {
+		t.Errorf("Expected:\n%q\ngot:\n%q", expected, out.String())
+	}
+
+	out.Reset()
+	printTaskLines(&out, inactive, "  - ", 0, color.FgHiBlack, Options{HideDates: true})
+	if strings.Contains(out.String(), "dtstart") {
+		t.Errorf("Expected no schedule details without --verbose, got %q", out.String())
+	}
+}
+
+func TestGetNotesDirFlagWins(t *testing.T) {
+	t.Setenv("OBSIDIAN_NOTES_DIR", "/from/env")
+	config := Config{NotesDir: "/from/config"}
+
+	if got := getNotesDirs(config, "/from/flag", false); !slices.Equal(got, []string{"/from/flag"}) {
+		t.Errorf("Expected the flag to win, got %q", got)
+	}
+	if got := getNotesDirs(config, "", false); !slices.Equal(got, []string{"/from/env"}) {
+		t.Errorf("Expected the env var without the flag, got %q", got)
+	}
+}
+
+func TestGetNotesDirsExplicitConfigWinsOverEnv(t *testing.T) {
+	t.Setenv("OBSIDIAN_NOTES_DIR", "/from/env")
+	config := Config{NotesDir: "/from/config"}
+
+	if got := getNotesDirs(config, "", true); !slices.Equal(got, []string{"/from/config"}) {
+		t.Errorf("Expected the --config file to win over the env var, got %q", got)
+	}
+	if got := getNotesDirs(config, "/from/flag", true); !slices.Equal(got, []string{"/from/flag"}) {
+		t.Errorf("Expected --notes-dir to win over the --config file, got %q", got)
+	}
+}
+
+func TestLoadExplicitConfig(t *testing.T) {
+	dir := t.TempDir()
+	withDir := writeConfig(t, dir, "vault.yaml", "notes_dir: /vault\n")
+	withoutDir := writeConfig(t, dir, "local.yaml", "week_start: SU\n")
+
+	missing := filepath.Join(dir, "missing.yaml")
+	if _, err := loadExplicitConfig([]string{missing}, true); err == nil || err.Error() != "config file "+missing+" not found" {
+		t.Errorf("Expected a not found error, got %v", err)
+	}
+
+	if _, err := loadExplicitConfig([]string{withoutDir}, true); err == nil || !strings.Contains(err.Error(), "does not set notes_dir") {
+		t.Errorf("Expected an error for a config without notes_dir, got %v", err)
+	}
+	if _, err := loadExplicitConfig([]string{withoutDir}, false); err != nil {
+		t.Errorf("Expected notes_dir to be optional alongside --notes-dir, got %v", err)
+	}
+
+	config, err := loadExplicitConfig([]string{withDir, withoutDir}, true)
+	if err != nil {
+		t.Fatalf("loadExplicitConfig failed: %v", err)
+	}
+	if config.NotesDir != "/vault" || config.WeekStart != "SU" {
+		t.Errorf("Expected notes_dir inherited from the first file, got %+v", config)
+	}
+}
+
+func TestGetNotesDirsList(t *testing.T) {
+	list := strings.Join([]string{"/vaults/personal", "", "/vaults/work"}, string(filepath.ListSeparator))
+	t.Setenv("OBSIDIAN_NOTES_DIR", list)
+	if got, want := getNotesDirs(Config{}, "", false), []string{"/vaults/personal", "/vaults/work"}; !slices.Equal(got, want) {
+		t.Errorf("Expected %q from the path list, got %q", want, got)
+	}
+
+	t.Setenv("OBSIDIAN_NOTES_DIR", "")
+	config := Config{NotesDir: "/vaults/personal", NotesDirs: []string{"/vaults/work", "/vaults/personal"}}
+	if got, want := getNotesDirs(config, "", false), []string{"/vaults/personal", "/vaults/work"}; !slices.Equal(got, want) {
+		t.Errorf("Expected notes_dir then notes_dirs, got %q", got)
+	}
+}
+
+func TestExpandPath(t *testing.T) {
+	t.Setenv("HOME", "/home/me")
+	t.Setenv("VAULTS", "/srv/vaults")
+
+	tests := map[string]string{
+		"~":               "/home/me",
+		"~/notes":         "/home/me/notes",
+		"$VAULTS/work":    "/srv/vaults/work",
+		"/plain/path":     "/plain/path",
+		"relative/~notes": "relative/~notes",
+	}
+	for path, expected := range tests {
+		if got := expandPath(path); got != expected {
+			t.Errorf("%q: expected %q, got %q", path, expected, got)
+		}
+	}
+}
+
+func TestParseFlagsNotesDirAndVault(t *testing.T) {
+	if _, err := parseFlags([]string{"--notes-dir", "/tmp/notes", "--vault", "Personal"}); err == nil {
+		t.Error("Expected --notes-dir and --vault to be mutually exclusive")
+	}
+}
+
+func TestPrintWithoutColor(t *testing.T) {
+	originalNoColor := color.NoColor
+	color.NoColor = true
+	t.Cleanup(func() { color.NoColor = originalNoColor })
+	originalClock := agenda.Clock
+	agenda.Clock = func() time.Time { return time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC) }
+	t.Cleanup(func() { agenda.Clock = originalClock })
+
+	today := time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC)
+	later := today.AddDate(0, 0, 5)
+	var out strings.Builder
+	printTaskLines(&out, []agenda.Task{
+		{Name: "Pay rent", RRule: "FREQ=MONTHLY", Duration: "P3D", DueDate: &today},
+		{Name: "Review", RRule: "FREQ=WEEKLY", DueDate: &later},
+	}, "  - ", 0, color.FgGreen, Options{})
+	printTasksWithErrors(&out, "Tasks with syntax errors", []agenda.Task{
+		{Name: "Broken", Error: agenda.Categorize(agenda.ErrYAML, errors.New("YAML error: bad"))},
+	}, color.FgRed, Options{})
+
+	if strings.Contains(out.String(), "\x1b") {
+		t.Errorf("Expected no escape sequences, got %q", out.String())
+	}
+	for _, symbol := range []string{"⚠️ 2025-03-10", "→ 2025-03-15", "❌"} {
+		if !strings.Contains(out.String(), symbol) {
+			t.Errorf("Expected %q to be kept, got %q", symbol, out.String())
+		}
+	}
+	if opts, err := parseFlags([]string{"--no-color"}); err != nil || !opts.NoColor {
+		t.Errorf("Expected --no-color to be set, got %+v (err %v)", opts, err)
+	}
+}
+
+func TestHyperlinksEnabled(t *testing.T) {
+	on, off := true, false
+	tests := []struct {
+		name       string
+		noLinks    bool
+		configured *bool
+		terminal   bool
+		expected   bool
+	}{
+		{"terminal", false, nil, true, true},
+		{"piped", false, nil, false, false},
+		{"flag", true, nil, true, false},
+		{"flag_beats_config", true, &on, true, false},
+		{"config_off", false, &off, true, false},
+		{"config_on_when_piped", false, &on, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hyperlinksEnabled(tt.noLinks, tt.configured, tt.terminal); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestTaskLabelWithoutHyperlinks(t *testing.T) {
+	original := hyperlinks
+	hyperlinks = false
+	t.Cleanup(func() { hyperlinks = original })
+
+	task := agenda.Task{Name: "Pay rent", FilePath: "/vault/rent.md", Vault: &agenda.VaultInfo{Name: "vault", Path: "/vault"}}
+	if got := taskLabel(task); got != "Pay rent" {
+		t.Errorf("Expected the plain name, got %q", got)
+	}
+	if opts, err := parseFlags([]string{"--no-links"}); err != nil || !opts.NoLinks {
+		t.Errorf("Expected --no-links to be set, got %+v (err %v)", opts, err)
+	}
+}
+
+func TestTaskLabelTitledNoteLinksToFile(t *testing.T) {
+	original := hyperlinks
+	hyperlinks = true
+	t.Cleanup(func() { hyperlinks = original })
+
+	task := agenda.Task{Name: "Pay the rent", FilePath: "/vault/Tasks/2025-01-01 rent.md", Vault: &agenda.VaultInfo{Name: "vault", Path: "/vault"}}
+	label := taskLabel(task)
+	if !strings.Contains(label, "file=Tasks%2F2025-01-01%20rent") || !strings.Contains(label, "Pay the rent") {
+		t.Errorf("Expected a link to the file labeled with the title, got %q", label)
+	}
+}
+
+func TestCreateTerminalHyperlinkStripsControlChars(t *testing.T) {
+	link := createTerminalHyperlink("obsidian://open?file=a\x07b", "Evil\x1b]8;;http://x\x1b\\ name\u009c\n")
+
+	expected := "\x1b]8;;obsidian://open?file=ab\x1b\\Evil]8;;http://x\\ name\x1b]8;;\x1b\\"
+	if link != expected {
+		t.Errorf("Expected %q, got %q", expected, link)
+	}
+	// Only the link's own opening and closing sequences may remain
+	if matches := escapeSequencePattern.FindAllString(link, -1); len(matches) != 2 {
+		t.Errorf("Expected exactly 2 escape sequences, got %q", matches)
+	}
+	if got := displayWidth(link); got != displayWidth("Evil]8;;http://x\\ name") {
+		t.Errorf("Unexpected display width %d", got)
+	}
+}
+
+func TestParseFlagsDate(t *testing.T) {
+	opts, err := parseFlags([]string{"--date", "2025-12-01"})
+	if err != nil || !opts.AsOf.Equal(time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected --date to parse as 2025-12-01, got %v (err %v)", opts.AsOf, err)
+	}
+	if opts, err := parseFlags(nil); err != nil || !opts.AsOf.IsZero() {
+		t.Errorf("Expected no --date to leave AsOf zero, got %v (err %v)", opts.AsOf, err)
+	}
+	if _, err := parseFlags([]string{"--date", "next monday"}); err == nil {
+		t.Error("Expected an error for an unparseable --date")
+	}
+	if _, err := parseFlags([]string{"--date", "2025-12-01", "--since-last-run"}); err == nil {
+		t.Error("Expected --date and --since-last-run to be mutually exclusive")
+	}
+}
+
+func TestDateFlagEvaluatesTasks(t *testing.T) {
+	opts, err := parseFlags([]string{"--date", "2025-12-01"})
 	if err != nil {
-		t.Fatalf("IsTaskActive failed: %v", err)
+		t.Fatal(err)
+	}
+	saved := agenda.Clock
+	agenda.Clock = func() time.Time { return opts.AsOf }
+	t.Cleanup(func() { agenda.Clock = saved })
+
+	dir := t.TempDir()
+	path := writeNote(t, dir, "monday.md", "---\nrrule: FREQ=WEEKLY;BYDAY=MO\ndtstart: 2025-01-06\n---\n")
+
+	task, status := agenda.ClassifyFile(path)
+	if status != agenda.StatusActive || task.DueDate == nil || !task.DueDate.Equal(opts.AsOf) {
+		t.Errorf("Expected the task to be due on Monday 2025-12-01, got %s %+v", status, task)
+	}
+	if task.NextStart == nil || !task.NextStart.Equal(time.Date(2025, 12, 8, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the next start a week later, got %v", task.NextStart)
+	}
+}
+
+func TestRefreshOnTicks(t *testing.T) {
+	dir := t.TempDir()
+	writeNote(t, dir, "a.md", "---\nrrule: FREQ=DAILY\n---\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ticks := make(chan time.Time)
+	scanned := make(chan int)
+	done := make(chan struct{})
+	go func() {
+		refreshOnTicks(ctx, ticks, func() {
+			result, err := scanRoots(context.Background(), []string{dir}, Options{})
+			if err != nil {
+				t.Errorf("scanRoots failed: %v", err)
+			}
+			scanned <- len(result.Active)
+		})
+		close(done)
+	}()
+
+	if got := <-scanned; got != 1 {
+		t.Errorf("Expected the first scan right away with 1 task, got %d", got)
+	}
+	writeNote(t, dir, "b.md", "---\nrrule: FREQ=DAILY\n---\n")
+	ticks <- time.Now()
+	if got := <-scanned; got != 2 {
+		t.Errorf("Expected a rescan on the tick to find 2 tasks, got %d", got)
+	}
+	ticks <- time.Now()
+	if got := <-scanned; got != 2 {
+		t.Errorf("Expected another rescan on the next tick, got %d", got)
 	}
 
-	// Should be active on Friday
-	if !isActive {
-		t.Errorf("Expected Friday task to be active on Friday, but got false")
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the loop to exit when the context is canceled")
+	}
+	select {
+	case <-scanned:
+		t.Error("Expected no rescan after cancel")
+	default:
 	}
 }
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/harnyk/obsidian-tasks/agenda"
+	"gopkg.in/yaml.v3"
+)
+
+// noteNormalization is one note whose front matter changes when rewritten
+// in the canonical form
+type noteNormalization struct {
+	Path        string
+	FrontMatter string // the canonical front matter, without the --- lines
+	Normalized  string // full note content with the canonical front matter
+}
+
+// looseDatePattern matches dates written as 2025/3/4, 2025.3.4 or 2025-3-4
+var looseDatePattern = regexp.MustCompile(`^(\d{4})[-/.](\d{1,2})[-/.](\d{1,2})$`)
+
+// normalizers rewrite scalar front matter values into their canonical form,
+// keyed by field. Each returns the value unchanged when it can't be
+// normalized safely.
+var normalizers = map[string]func(value string) string{
+	"rrule":    normalizeRule,
+	"exrule":   normalizeRule,
+	"dtstart":  normalizeDate,
+	"duration": normalizeDuration,
+}
+
+// normalizeRule uppercases a rule and drops the spaces around its parts.
+// Rules with a pasted DTSTART are left alone, since their TZID is case
+// sensitive.
+func normalizeRule(value string) string {
+	if _, _, _, ok := agenda.SplitEmbeddedDTStart(value); ok {
+		return value
+	}
+	parts := strings.Split(value, ";")
+	for i, part := range parts {
+		name, val, found := strings.Cut(part, "=")
+		if !found {
+			parts[i] = strings.ToUpper(strings.TrimSpace(part))
+			continue
+		}
+		parts[i] = strings.ToUpper(strings.TrimSpace(name)) + "=" + strings.ToUpper(strings.TrimSpace(val))
+	}
+	return strings.Join(parts, ";")
+}
+
+// normalizeDate rewrites date-only values as zero-padded 2025-03-04
+func normalizeDate(value string) string {
+	match := looseDatePattern.FindStringSubmatch(value)
+	if match == nil {
+		return value
+	}
+	date, err := time.Parse("2006-1-2", match[1]+"-"+match[2]+"-"+match[3])
+	if err != nil {
+		return value
+	}
+	return date.Format("2006-01-02")
+}
+
+// normalizeDuration uppercases a duration and adds a missing P
+func normalizeDuration(value string) string {
+	upper := strings.ToUpper(value)
+	if fixed, changed := fixDurationPrefix(upper); changed {
+		upper = fixed
+	}
+	if _, err := agenda.ParseDuration(upper); err != nil {
+		return value
+	}
+	return upper
+}
+
+// normalizeFrontMatter rewrites the front matter of a task note in the
+// canonical form, keeping the body byte for byte. ok is false for notes
+// without front matter or without a schedule.
+func normalizeFrontMatter(content string) (normalized, frontMatter string, ok bool, err error) {
+	if !agenda.HasFrontMatter(content) {
+		return content, "", false, nil
+	}
+	end := agenda.FrontMatterEnd(content)
+	if end < 0 {
+		return content, "", false, nil
+	}
+	header, rest := content[len("---"):end], content[end:]
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(header), &doc); err != nil {
+		return content, "", false, agenda.Categorize(agenda.ErrYAML, agenda.YAMLError(err))
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return content, "", false, nil
+	}
+	mapping := doc.Content[0]
+
+	scheduled := false
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		key, value := mapping.Content[i].Value, mapping.Content[i+1]
+		if key == "rrule" || key == "dtstart" {
+			scheduled = true
+		}
+		if key == "tags" && value.Kind == yaml.SequenceNode {
+			slices.SortStableFunc(value.Content, func(a, b *yaml.Node) int {
+				return strings.Compare(a.Value, b.Value)
+			})
+			continue
+		}
+		normalize := normalizers[key]
+		if normalize == nil || value.Kind != yaml.ScalarNode {
+			continue
+		}
+		if canonical := normalize(strings.TrimSpace(value.Value)); canonical != value.Value {
+			// Let the encoder pick the tag, so a rewritten date isn't quoted
+			value.Value, value.Tag, value.Style = canonical, "", 0
+		}
+	}
+	if !scheduled {
+		return content, "", false, nil
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(mapping); err != nil {
+		return content, "", false, err
+	}
+	if err := encoder.Close(); err != nil {
+		return content, "", false, err
+	}
+	frontMatter = buf.String()
+	opening := "---\n"
+	if strings.HasPrefix(content, "---\r\n") {
+		// Keep the line endings of notes written on Windows
+		opening = "---\r\n"
+		frontMatter = strings.ReplaceAll(frontMatter, "\n", "\r\n")
+	}
+	return opening + frontMatter + rest, frontMatter, true, nil
+}
+
+// findNormalizations rewrites every task note under root in memory and
+// returns the ones whose content would change, without writing anything.
+// Notes whose front matter doesn't parse are returned in skipped, naming
+// the note, and the walk goes on.
+func findNormalizations(root string) (notes []noteNormalization, skipped []error, err error) {
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && path != root && agenda.SkipDir(d.Name()) {
+			return fs.SkipDir
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), ".md") {
+			return nil
+		}
+		data, err := agenda.ReadFileWithRetry(path)
+		if err != nil {
+			return err
+		}
+		normalized, frontMatter, ok, err := normalizeFrontMatter(string(data))
+		if err != nil {
+			skipped = append(skipped, fmt.Errorf("%s: %w", path, err))
+			return nil
+		}
+		if ok && normalized != string(data) {
+			notes = append(notes, noteNormalization{Path: path, FrontMatter: frontMatter, Normalized: normalized})
+		}
+		return nil
+	})
+	return notes, skipped, err
+}
+
+// printNormalizations shows each note's canonical front matter
+func printNormalizations(w io.Writer, notes []noteNormalization) {
+	for _, note := range notes {
+		fmt.Fprintln(w, note.Path)
+		fmt.Fprintln(w, "---")
+		fmt.Fprint(w, note.FrontMatter)
+		fmt.Fprintln(w, "---")
+	}
+}
+
+// applyNormalizations writes the normalized notes back, keeping each file's
+// permissions
+func applyNormalizations(notes []noteNormalization) error {
+	for _, note := range notes {
+		if err := rewriteNote(note.Path, note.Normalized); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runNormalize prints the canonical front matter of every task note that
+// would change under roots and, unless dryRun is set, rewrites the notes
+// after confirmation. Notes that can't be parsed are reported and skipped.
+func runNormalize(roots []string, dryRun bool) int {
+	var notes []noteNormalization
+	for _, root := range roots {
+		found, skipped, err := findNormalizations(root)
+		if err != nil {
+			fmt.Println("Walk error:", err)
+			return 1
+		}
+		for _, err := range skipped {
+			fmt.Println("Skipped", err)
+		}
+		notes = append(notes, found...)
+	}
+	if len(notes) == 0 {
+		fmt.Println("Nothing to normalize")
+		return 0
+	}
+	printNormalizations(os.Stdout, notes)
+	return confirmRewrite(os.Stdin, os.Stdout, len(notes), dryRun, "Normalized", func() error {
+		return applyNormalizations(notes)
+	})
+}
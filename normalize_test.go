@@ -0,0 +1,150 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/harnyk/obsidian-tasks/agenda"
+)
+
+func TestNormalizeFrontMatter(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+		ok       bool
+	}{
+		{
+			"messy",
+			"---\nrrule: freq=weekly; byday=mo,we\ndtstart: 2025/3/4\nduration: 2d\ntags: [rrule, chores, home]\n---\n# Body\nduration: 1d stays\n",
+			"---\nrrule: FREQ=WEEKLY;BYDAY=MO,WE\ndtstart: 2025-03-04\nduration: P2D\ntags: [chores, home, rrule]\n---\n# Body\nduration: 1d stays\n",
+			true,
+		},
+		{
+			"block_tags_and_comment",
+			"---\ndtstart: 2025.1.2 # moved\nduration: t2h\ntags:\n    - work\n    - rrule\n---\n",
+			"---\ndtstart: 2025-01-02 # moved\nduration: PT2H\ntags:\n  - rrule\n  - work\n---\n",
+			true,
+		},
+		{
+			"already_canonical",
+			"---\nrrule: FREQ=DAILY\ndtstart: 2025-01-02\nduration: P1D\n---\nbody\n",
+			"---\nrrule: FREQ=DAILY\ndtstart: 2025-01-02\nduration: P1D\n---\nbody\n",
+			true,
+		},
+		{
+			"invalid_values_left_alone",
+			"---\nrrule: FREQ=DAILY\ndtstart: 2025/13/45\nduration: soon\n---\n",
+			"---\nrrule: FREQ=DAILY\ndtstart: 2025/13/45\nduration: soon\n---\n",
+			true,
+		},
+		{
+			"embedded_dtstart_keeps_tzid_case",
+			"---\nrrule: \"DTSTART;TZID=Europe/Kyiv:20250101T090000 RRULE:FREQ=DAILY\"\n---\n",
+			"---\nrrule: \"DTSTART;TZID=Europe/Kyiv:20250101T090000 RRULE:FREQ=DAILY\"\n---\n",
+			true,
+		},
+		{
+			"crlf",
+			"---\r\nrrule: freq=daily\r\nduration: 2d\r\n---\r\nbody\r\n",
+			"---\r\nrrule: FREQ=DAILY\r\nduration: P2D\r\n---\r\nbody\r\n",
+			true,
+		},
+		{
+			"not_a_task",
+			"---\ntags: [b, a]\n---\n",
+			"---\ntags: [b, a]\n---\n",
+			false,
+		},
+		{
+			"no_front_matter",
+			"rrule: freq=daily\n",
+			"rrule: freq=daily\n",
+			false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			normalized, _, ok, err := normalizeFrontMatter(tt.content)
+			if err != nil {
+				t.Fatalf("normalizeFrontMatter failed: %v", err)
+			}
+			if ok != tt.ok {
+				t.Errorf("Expected ok %v, got %v", tt.ok, ok)
+			}
+			if normalized != tt.expected {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tt.expected, normalized)
+			}
+		})
+	}
+}
+
+func TestNormalizeFrontMatterInvalidYAML(t *testing.T) {
+	if _, _, _, err := normalizeFrontMatter("---\nrrule: [unclosed\n---\n"); err == nil {
+		t.Errorf("Expected an error for invalid YAML")
+	}
+}
+
+func TestFindAndApplyNormalizations(t *testing.T) {
+	dir := t.TempDir()
+	messy := writeNote(t, dir, "sub/messy.md", "---\nduration: 3d\nrrule: freq=daily\ntags: [rrule, b]\n---\n# Notes\nkeep me\n")
+	writeNote(t, dir, "tidy.md", "---\nrrule: FREQ=DAILY\n---\n")
+	writeNote(t, dir, "plain.md", "---\ntitle: Not a task\n---\n")
+
+	broken := writeNote(t, dir, "broken.md", "---\nrrule: [unclosed\n---\n")
+
+	notes, skipped, err := findNormalizations(dir)
+	if err != nil {
+		t.Fatalf("findNormalizations failed: %v", err)
+	}
+	// A note that doesn't parse is reported without blocking the others
+	if len(skipped) != 1 || !strings.Contains(skipped[0].Error(), broken) {
+		t.Errorf("Expected %s to be reported as skipped, got %v", broken, skipped)
+	}
+	if len(notes) != 1 || notes[0].Path != messy {
+		t.Fatalf("Expected only %s to need normalizing, got %+v", messy, notes)
+	}
+	if want := "duration: P3D\nrrule: FREQ=DAILY\ntags: [b, rrule]\n"; notes[0].FrontMatter != want {
+		t.Errorf("Expected front matter %q, got %q", want, notes[0].FrontMatter)
+	}
+
+	// A dry run only reports: nothing is written until applyNormalizations
+	if data, _ := os.ReadFile(messy); string(data) != "---\nduration: 3d\nrrule: freq=daily\ntags: [rrule, b]\n---\n# Notes\nkeep me\n" {
+		t.Errorf("findNormalizations modified the note: %q", data)
+	}
+
+	if err := applyNormalizations(notes); err != nil {
+		t.Fatalf("applyNormalizations failed: %v", err)
+	}
+	data, err := os.ReadFile(messy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "---\nduration: P3D\nrrule: FREQ=DAILY\ntags: [b, rrule]\n---\n# Notes\nkeep me\n" {
+		t.Errorf("Unexpected normalized note: %q", data)
+	}
+	if _, err := agenda.ParseFrontMatter(string(data)); err != nil {
+		t.Errorf("Normalized note doesn't parse: %v", err)
+	}
+
+	// Normalizing is idempotent
+	if notes, _, err := findNormalizations(dir); err != nil || len(notes) != 0 {
+		t.Errorf("Expected nothing left to normalize, got %+v (err %v)", notes, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "plain.md")); string(data) != "---\ntitle: Not a task\n---\n" {
+		t.Errorf("Non-task note was modified: %q", data)
+	}
+}
+
+func TestParseFlagsNormalize(t *testing.T) {
+	opts, err := parseFlags([]string{"--normalize", "--dry-run"})
+	if err != nil || !opts.Normalize || !opts.DryRun {
+		t.Errorf("Expected --normalize --dry-run to parse, got %+v (err %v)", opts, err)
+	}
+	if _, err := parseFlags([]string{"--fix", "--normalize"}); err == nil {
+		t.Errorf("Expected error for --fix with --normalize")
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+	"text/template"
+
+	"github.com/harnyk/obsidian-tasks/agenda"
+)
+
+// openCommand is a text/template for the command that opens a task's note,
+// e.g. "code {{.FilePath}}". Empty opens the note in Obsidian. It is set
+// from open_command in the config file.
+var openCommand = ""
+
+// startCommand launches an opener without waiting for it, replaceable in tests.
+var startCommand = func(args []string) error {
+	return exec.Command(args[0], args[1:]...).Start()
+}
+
+// findTask returns the task whose name matches name case-insensitively
+func findTask(result agenda.ScanResult, name string) (agenda.Task, bool) {
+	for _, tasks := range [][]agenda.Task{result.Active, result.Inactive, result.Errored, result.Completed} {
+		for _, task := range tasks {
+			if strings.EqualFold(task.Name, name) {
+				return task, true
+			}
+		}
+	}
+	return agenda.Task{}, false
+}
+
+// renderOpenCommand splits tmpl into words and renders each one with the
+// task's fields, so a file path containing spaces stays a single argument.
+// Words split like a shell's: quotes group words with spaces, and template
+// actions such as {{ .FilePath }} are never split.
+func renderOpenCommand(tmpl string, task agenda.Task) ([]string, error) {
+	words, err := splitCommandWords(tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid open_command: %w", err)
+	}
+	var args []string
+	for _, word := range words {
+		t, err := template.New("open_command").Option("missingkey=error").Parse(word)
+		if err != nil {
+			return nil, fmt.Errorf("invalid open_command: %w", err)
+		}
+		var b strings.Builder
+		if err := t.Execute(&b, task); err != nil {
+			return nil, fmt.Errorf("invalid open_command: %w", err)
+		}
+		args = append(args, b.String())
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("invalid open_command: empty command")
+	}
+	return args, nil
+}
+
+// splitCommandWords splits a command line at unquoted whitespace outside
+// template actions. Single or double quotes group a word and are dropped;
+// text inside {{ }} is kept as written, quotes included.
+func splitCommandWords(command string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	for i := 0; i < len(command); {
+		if strings.HasPrefix(command[i:], "{{") {
+			end := strings.Index(command[i:], "}}")
+			if end < 0 {
+				// Left for the template parser to report
+				end = len(command[i:]) - len("}}")
+			}
+			word.WriteString(command[i : i+end+len("}}")])
+			inWord = true
+			i += end + len("}}")
+			continue
+		}
+		r := rune(command[i])
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			word.WriteByte(command[i])
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteByte(command[i])
+			inWord = true
+		}
+		i++
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// systemOpener returns the command that opens a URI or file with its default
+// application on the goos platform. Windows goes through rundll32 rather
+// than cmd's start, which would split an obsidian:// URI at its &.
+func systemOpener(goos, target string) []string {
+	switch goos {
+	case "darwin":
+		return []string{"open", target}
+	case "windows":
+		return []string{"rundll32", "url.dll,FileProtocolHandler", target}
+	default:
+		return []string{"xdg-open", target}
+	}
+}
+
+// openTask opens a task's note with open_command when configured, otherwise
+// with its obsidian:// URI (or the file itself outside a vault)
+func openTask(task agenda.Task) error {
+	if openCommand != "" {
+		args, err := renderOpenCommand(openCommand, task)
+		if err != nil {
+			return err
+		}
+		return startCommand(args)
+	}
+
+	target := task.FilePath
+	if task.Vault != nil {
+		target = createObsidianURI(task.Vault.Name, task.FilePath, task.Vault.Path)
+	}
+	return startCommand(systemOpener(runtime.GOOS, target))
+}
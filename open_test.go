@@ -0,0 +1,95 @@
+package main
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/harnyk/obsidian-tasks/agenda"
+)
+
+func TestRenderOpenCommand(t *testing.T) {
+	task := agenda.Task{Name: "Pay Rent", FilePath: "/notes/My Notes/Pay Rent.md"}
+
+	tests := []struct {
+		tmpl     string
+		expected []string
+		hasError bool
+	}{
+		{"code {{.FilePath}}", []string{"code", "/notes/My Notes/Pay Rent.md"}, false},
+		{"vim +1 {{.FilePath}}", []string{"vim", "+1", "/notes/My Notes/Pay Rent.md"}, false},
+		{"notify-send {{.Name}}", []string{"notify-send", "Pay Rent"}, false},
+		{"code {{ .FilePath }}", []string{"code", "/notes/My Notes/Pay Rent.md"}, false},
+		{`code {{printf "%s:1" .FilePath}}`, []string{"code", "/notes/My Notes/Pay Rent.md:1"}, false},
+		{`"/Applications/My Editor" --goto '{{.FilePath}}'`, []string{"/Applications/My Editor", "--goto", "/notes/My Notes/Pay Rent.md"}, false},
+		{`open -a "Sublime Text" {{.FilePath}}`, []string{"open", "-a", "Sublime Text", "/notes/My Notes/Pay Rent.md"}, false},
+		{`code ""`, []string{"code", ""}, false},
+		{`code "{{.FilePath}}`, nil, true},
+		{"code {{.Missing}}", nil, true},
+		{"code {{.FilePath", nil, true},
+		{"   ", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tmpl, func(t *testing.T) {
+			args, err := renderOpenCommand(tt.tmpl, task)
+			if tt.hasError {
+				if err == nil {
+					t.Errorf("Expected error, got %q", args)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(args, tt.expected) {
+				t.Errorf("Expected %q, got %q", tt.expected, args)
+			}
+		})
+	}
+}
+
+func TestOpenTask(t *testing.T) {
+	var started []string
+	originalStart, originalCommand := startCommand, openCommand
+	t.Cleanup(func() { startCommand, openCommand = originalStart, originalCommand })
+	startCommand = func(args []string) error {
+		started = args
+		return nil
+	}
+
+	task := agenda.Task{Name: "Pay Rent", FilePath: "/vault/Pay Rent.md", Vault: &agenda.VaultInfo{Name: "vault", Path: "/vault"}}
+
+	openCommand = "code {{.FilePath}}"
+	if err := openTask(task); err != nil {
+		t.Fatalf("openTask failed: %v", err)
+	}
+	if !reflect.DeepEqual(started, []string{"code", "/vault/Pay Rent.md"}) {
+		t.Errorf("Expected open_command to be used, got %q", started)
+	}
+
+	openCommand = ""
+	if err := openTask(task); err != nil {
+		t.Fatalf("openTask failed: %v", err)
+	}
+	uri := createObsidianURI("vault", task.FilePath, "/vault")
+	if len(started) == 0 || started[len(started)-1] != uri {
+		t.Errorf("Expected fallback to the Obsidian URI %q, got %q", uri, started)
+	}
+}
+
+func TestSystemOpener(t *testing.T) {
+	target := "obsidian://open?vault=My%20Vault&file=Pay%20Rent"
+	for _, goos := range []string{"darwin", "windows", "linux"} {
+		args := systemOpener(goos, target)
+		if args[len(args)-1] != target {
+			t.Errorf("%s: expected the target as one last argument, got %q", goos, args)
+		}
+		if slices.Contains(args, "cmd") {
+			t.Errorf("%s: expected no shell, which would split the target at &, got %q", goos, args)
+		}
+	}
+	if args := systemOpener("windows", target); !reflect.DeepEqual(args, []string{"rundll32", "url.dll,FileProtocolHandler", target}) {
+		t.Errorf("windows: unexpected command %q", args)
+	}
+}
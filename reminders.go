@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/harnyk/obsidian-tasks/agenda"
+)
+
+// upcomingReminders returns the tasks whose reminder period includes now's
+// day and that are not active yet. Active tasks are already listed above
+// the Reminders section.
+func upcomingReminders(result agenda.ScanResult, now time.Time) []agenda.Task {
+	return agenda.DueReminders(result.Inactive, now)
+}
+
+// printReminders writes the Reminders section: each task with the date it is due
+func printReminders(w io.Writer, title string, tasks []agenda.Task, opts Options) {
+	if len(tasks) == 0 {
+		return
+	}
+	width := 0
+	if opts.Align {
+		width = labelWidth(tasks)
+	}
+	color.New(color.FgYellow, color.Bold).Fprintln(w, sectionHeader(title, len(tasks)))
+
+	bell := "🔔"
+	if opts.ASCII {
+		bell = "!"
+	}
+	for _, task := range tasks {
+		fmt.Fprint(w, "  - ")
+		label := taskLabel(task)
+		color.New(color.FgMagenta, color.Bold).Fprint(w, label)
+		if width > 0 {
+			fmt.Fprint(w, strings.Repeat(" ", width-displayWidth(label)))
+		}
+		color.New(color.Reset).Fprint(w, " ("+task.RRule)
+		if task.Duration != "" {
+			color.New(color.Reset).Fprint(w, ", "+task.Duration)
+		}
+		color.New(color.Reset).Fprint(w, ")")
+		color.New(color.FgMagenta).Fprintf(w, " %s due %s\n", bell, task.Reminder.Due.Format("2006-01-02"))
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/harnyk/obsidian-tasks/agenda"
+)
+
+func TestPrintReminders(t *testing.T) {
+	originalNoColor := color.NoColor
+	color.NoColor = true
+	t.Cleanup(func() { color.NoColor = originalNoColor })
+
+	due := time.Date(2025, 10, 3, 0, 0, 0, 0, time.UTC)
+	tasks := []agenda.Task{{Name: "rent", RRule: "FREQ=MONTHLY", Duration: "P3D", Reminder: &agenda.Reminder{On: due.AddDate(0, 0, -2), Due: due}}}
+
+	var out strings.Builder
+	printReminders(&out, "Reminders", tasks, Options{ASCII: true})
+	expected := "\nReminders (1):\n  - rent (FREQ=MONTHLY, P3D) ! due 2025-10-03\n"
+	if out.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, out.String())
+	}
+
+	out.Reset()
+	printReminders(&out, "Reminders", nil, Options{})
+	if out.String() != "" {
+		t.Errorf("Expected no section without reminders, got %q", out.String())
+	}
+}
+
+func TestUpcomingRemindersSample(t *testing.T) {
+	// Two days before Pay rent starts on the 1st
+	now := time.Date(2025, 10, 30, 12, 0, 0, 0, time.UTC)
+	original := agenda.Clock
+	agenda.Clock = func() time.Time { return now }
+	t.Cleanup(func() { agenda.Clock = original })
+
+	dir := t.TempDir()
+	if err := writeSamples(io.Discard, dir, false, now); err != nil {
+		t.Fatalf("writeSamples failed: %v", err)
+	}
+	result, err := scanRoots(context.Background(), []string{dir}, Options{})
+	if err != nil {
+		t.Fatalf("scanRoots failed: %v", err)
+	}
+	var rent *agenda.Task
+	for _, task := range upcomingReminders(result, now) {
+		if task.Name == "Pay rent" {
+			rent = &task
+		}
+	}
+	if rent == nil {
+		t.Fatalf("Expected a Pay rent reminder on %s", now.Format("2006-01-02"))
+	}
+	if got := rent.Reminder.Due.Format("2006-01-02"); got != "2025-11-03" {
+		t.Errorf("Expected Pay rent due 2025-11-03, got %s", got)
+	}
+}
+
+func TestUpcomingRemindersSkipActiveTasks(t *testing.T) {
+	now := time.Date(2025, 10, 1, 12, 0, 0, 0, time.UTC)
+	original := agenda.Clock
+	agenda.Clock = func() time.Time { return now }
+	t.Cleanup(func() { agenda.Clock = original })
+
+	dir := t.TempDir()
+	writeNote(t, dir, "Standup.md", "---\nrrule: FREQ=DAILY\ndtstart: 2025-09-01\nduration: P1D\nremind_before: P2D\n---\n")
+	writeNote(t, dir, "Rent.md", "---\ndtstart: 2025-10-02\nduration: P1D\nremind_before: P3D\n---\n")
+
+	result, err := scanRoots(context.Background(), []string{dir}, Options{})
+	if err != nil {
+		t.Fatalf("scanRoots failed: %v", err)
+	}
+	if len(result.Active) != 1 || result.Active[0].Reminder == nil {
+		t.Fatalf("Expected the active task to carry a reminder, got %+v", result.Active)
+	}
+	reminders := upcomingReminders(result, now)
+	if len(reminders) != 1 || reminders[0].Name != "Rent" {
+		t.Errorf("Expected only the upcoming Rent reminder, got %+v", reminders)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// sampleNote is one example note written by --init-sample
+type sampleNote struct {
+	Name    string
+	Content string
+}
+
+// sampleNotes returns the example notes: two recurring tasks, a one-time
+// event two weeks after now whose reminder is already showing, and a note
+// with a deliberately invalid rule
+func sampleNotes(now time.Time) []sampleNote {
+	return []sampleNote{
+		{"Weekly review.md", `---
+tags: [rrule]
+rrule: FREQ=WEEKLY;BYDAY=FR
+duration: P2D
+---
+
+# Weekly review
+
+Active every Friday for two days: due on Saturday.
+`},
+		{"Pay rent.md", `---
+tags: [rrule]
+rrule: FREQ=MONTHLY;BYMONTHDAY=1
+duration: P3D
+remind_before: P2D
+---
+
+# Pay rent
+
+Active on the 1st of each month for three days, listed under Reminders for the two days before it starts.
+`},
+		{"Dentist appointment.md", fmt.Sprintf(`---
+dtstart: %s
+duration: P1D
+remind_before: P3W
+---
+
+# Dentist appointment
+
+A one-time event: no rrule, just a dtstart. It is listed under Reminders
+from three weeks before, so right away.
+`, now.AddDate(0, 0, 14).Format("2006-01-02"))},
+		{"Broken example.md", `---
+rrule: FREQ=FORTNIGHTLY
+duration: P1D
+---
+
+# Broken example
+
+FORTNIGHTLY is not a valid FREQ, so this note is listed under errors.
+Use FREQ=WEEKLY;INTERVAL=2 instead.
+`},
+	}
+}
+
+// writeSamples writes the example notes into dir, creating it if needed.
+// Unless force is set nothing is written when any of the notes exists.
+func writeSamples(w io.Writer, dir string, force bool, now time.Time) error {
+	notes := sampleNotes(now)
+	if !force {
+		for _, note := range notes {
+			path := filepath.Join(dir, note.Name)
+			if _, err := os.Stat(path); err == nil {
+				return fmt.Errorf("%s already exists (use --force to overwrite)", path)
+			} else if !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, note := range notes {
+		path := filepath.Join(dir, note.Name)
+		if err := os.WriteFile(path, []byte(note.Content), 0644); err != nil {
+			return err
+		}
+		fmt.Fprintln(w, "Wrote", path)
+	}
+	fmt.Fprintf(w, "Try it: obsidian-tasks --notes-dir %q\n", dir)
+	return nil
+}
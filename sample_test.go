@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/harnyk/obsidian-tasks/agenda"
+)
+
+func TestWriteSamples(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "playground")
+	now := time.Now()
+	if err := writeSamples(io.Discard, dir, false, now); err != nil {
+		t.Fatalf("writeSamples failed: %v", err)
+	}
+
+	result, err := agenda.ScanNotes(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("scanNotes failed: %v", err)
+	}
+	if result.FilesScanned != 4 || result.TasksFound != 4 {
+		t.Fatalf("Expected 4 sample tasks, got %d files and %d tasks", result.FilesScanned, result.TasksFound)
+	}
+	if len(result.Errored) != 1 || result.Errored[0].Name != "Broken example" {
+		t.Errorf("Expected only the broken example to error, got %v", result.Errored)
+	}
+
+	event := filepath.Join(dir, "Dentist appointment.md")
+	fm, err := agenda.ReadFrontMatter(event)
+	if err != nil || fm.RRule != "" || fm.DTStart != now.AddDate(0, 0, 14).Format("2006-01-02") {
+		t.Errorf("Expected a one-time event in two weeks, got %+v (err %v)", fm, err)
+	}
+}
+
+func TestWriteSamplesShowReminder(t *testing.T) {
+	now := time.Date(2025, 10, 15, 12, 0, 0, 0, time.UTC)
+	original := agenda.Clock
+	agenda.Clock = func() time.Time { return now }
+	t.Cleanup(func() { agenda.Clock = original })
+
+	dir := t.TempDir()
+	if err := writeSamples(io.Discard, dir, false, now); err != nil {
+		t.Fatalf("writeSamples failed: %v", err)
+	}
+	result, err := scanRoots(context.Background(), []string{dir}, Options{})
+	if err != nil {
+		t.Fatalf("scanRoots failed: %v", err)
+	}
+	reminders := upcomingReminders(result, now)
+	if len(reminders) != 1 || reminders[0].Name != "Dentist appointment" {
+		t.Errorf("Expected the fresh sample to show the dentist reminder, got %+v", reminders)
+	}
+}
+
+func TestWriteSamplesRefusesOverwrite(t *testing.T) {
+	dir := t.TempDir()
+	existing := writeNote(t, dir, "Pay rent.md", "my own note\n")
+
+	err := writeSamples(io.Discard, dir, false, time.Now())
+	if err == nil || !strings.Contains(err.Error(), "--force") {
+		t.Fatalf("Expected a refusal mentioning --force, got %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("Expected nothing to be written, found %d files", len(entries))
+	}
+
+	if err := writeSamples(io.Discard, dir, true, time.Now()); err != nil {
+		t.Fatalf("writeSamples with force failed: %v", err)
+	}
+	if data, _ := os.ReadFile(existing); string(data) == "my own note\n" {
+		t.Error("Expected --force to overwrite the note")
+	}
+}
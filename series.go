@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/harnyk/obsidian-tasks/agenda"
+)
+
+// formatOccurrence renders an occurrence as a date, with the time of day for
+// sub-day durations, or "none" when the series is empty
+func formatOccurrence(t time.Time, duration agenda.CalendarDuration) string {
+	switch {
+	case t.IsZero():
+		return "none"
+	case duration.Intraday():
+		return t.Format("2006-01-02 15:04")
+	default:
+		return t.Format("2006-01-02")
+	}
+}
+
+// printOccurrenceQuery answers --first/--last for one note, returning the
+// exit code
+func printOccurrenceQuery(w io.Writer, path string, last bool, now time.Time) int {
+	fm, err := agenda.ReadFrontMatter(path)
+	if err != nil {
+		fmt.Fprintf(w, "Error: %s: %v\n", path, err)
+		return 1
+	}
+	fmWithDefaults, err := agenda.ApplyDefaults(fm, now)
+	if err != nil {
+		fmt.Fprintf(w, "Error: %s: %v\n", path, err)
+		return 1
+	}
+	if fm.RRule == "" && fm.DTStart == "" {
+		fmt.Fprintf(w, "Error: %s: not a task (no rrule or dtstart)\n", path)
+		return 1
+	}
+
+	if !last {
+		first, err := agenda.FirstOccurrence(fmWithDefaults)
+		if err != nil {
+			fmt.Fprintf(w, "Error: %s: %v\n", path, err)
+			return 1
+		}
+		fmt.Fprintln(w, formatOccurrence(first, fmWithDefaults.Duration))
+		return 0
+	}
+
+	occurrence, bounded, err := agenda.LastOccurrence(fmWithDefaults)
+	if err != nil {
+		fmt.Fprintf(w, "Error: %s: %v\n", path, err)
+		return 1
+	}
+	if !bounded {
+		fmt.Fprintln(w, "unbounded")
+		return 0
+	}
+	fmt.Fprintln(w, formatOccurrence(occurrence, fmWithDefaults.Duration))
+	return 0
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPrintOccurrenceQuery(t *testing.T) {
+	dir := t.TempDir()
+	bounded := writeNote(t, dir, "bounded.md", "---\nrrule: FREQ=DAILY;COUNT=3\ndtstart: 2025-01-01\n---\n")
+	unbounded := writeNote(t, dir, "unbounded.md", "---\nrrule: FREQ=DAILY\ndtstart: 2025-01-01\n---\n")
+	now := time.Date(2025, 9, 26, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		path     string
+		last     bool
+		expected string
+	}{
+		{bounded, false, "2025-01-01\n"},
+		{bounded, true, "2025-01-03\n"},
+		{unbounded, true, "unbounded\n"},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if code := printOccurrenceQuery(&out, tt.path, tt.last, now); code != 0 {
+			t.Errorf("%s: expected exit code 0, got %d (%s)", tt.path, code, out.String())
+		}
+		if out.String() != tt.expected {
+			t.Errorf("%s last=%v: expected %q, got %q", filepath.Base(tt.path), tt.last, tt.expected, out.String())
+		}
+	}
+
+	var out bytes.Buffer
+	if code := printOccurrenceQuery(&out, filepath.Join(dir, "missing.md"), false, now); code != 1 {
+		t.Errorf("Expected exit code 1 for a missing note, got %d", code)
+	}
+}
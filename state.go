@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/harnyk/obsidian-tasks/agenda"
+)
+
+// runState is what --since-last-run remembers between runs
+type runState struct {
+	LastRun time.Time `json:"last_run"`
+	Active  []string  `json:"active"`
+	Due     []string  `json:"due"`
+}
+
+// stateFilePath returns the state file location under $XDG_STATE_HOME,
+// defaulting to ~/.local/state/obsidian-tasks/
+func stateFilePath() string {
+	stateDir := os.Getenv("XDG_STATE_HOME")
+	if stateDir == "" {
+		homeDir, _ := os.UserHomeDir()
+		stateDir = filepath.Join(homeDir, ".local", "state")
+	}
+	return filepath.Join(stateDir, "obsidian-tasks", "state.json")
+}
+
+// loadRunState reads the previous run's state; a missing file is an empty state
+func loadRunState(path string) (runState, error) {
+	var state runState
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	err = json.Unmarshal(data, &state)
+	return state, err
+}
+
+func saveRunState(path string, state runState) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// taskStateID identifies a task's current occurrence, so the same note
+// becoming active again for a later occurrence counts as new
+func taskStateID(task agenda.Task) string {
+	if task.DueDate == nil {
+		return task.FilePath
+	}
+	return task.FilePath + "@" + task.DueDate.Format("2006-01-02")
+}
+
+// markNewTasks flags active tasks that weren't active, or weren't due today,
+// in the previous state and returns the state to persist for the next run.
+// Nothing is flagged on the first run.
+func markNewTasks(active []agenda.Task, prev runState, now time.Time) runState {
+	today := now.Truncate(24 * time.Hour)
+	wasActive := make(map[string]bool)
+	for _, id := range prev.Active {
+		wasActive[id] = true
+	}
+	wasDue := make(map[string]bool)
+	for _, id := range prev.Due {
+		wasDue[id] = true
+	}
+
+	next := runState{LastRun: now}
+	for i := range active {
+		id := taskStateID(active[i])
+		next.Active = append(next.Active, id)
+
+		dueToday := active[i].DueDate != nil && active[i].DueDate.Equal(today)
+		if dueToday {
+			next.Due = append(next.Due, id)
+		}
+
+		if !prev.LastRun.IsZero() && (!wasActive[id] || (dueToday && !wasDue[id])) {
+			active[i].New = true
+		}
+	}
+	return next
+}
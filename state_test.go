@@ -0,0 +1,73 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/harnyk/obsidian-tasks/agenda"
+)
+
+func TestMarkNewTasks(t *testing.T) {
+	now := time.Date(2025, 9, 26, 12, 0, 0, 0, time.UTC)
+	today := now.Truncate(24 * time.Hour)
+	tomorrow := today.AddDate(0, 0, 1)
+
+	active := func() []agenda.Task {
+		return []agenda.Task{
+			{Name: "still active", FilePath: "/v/a.md", DueDate: &tomorrow},
+			{Name: "newly active", FilePath: "/v/b.md", DueDate: &tomorrow},
+			{Name: "newly due", FilePath: "/v/c.md", DueDate: &today},
+		}
+	}
+
+	t.Run("first_run_marks_nothing", func(t *testing.T) {
+		tasks := active()
+		state := markNewTasks(tasks, runState{}, now)
+		for _, task := range tasks {
+			if task.New {
+				t.Errorf("%s: expected not new on first run", task.Name)
+			}
+		}
+		if len(state.Active) != 3 || len(state.Due) != 1 {
+			t.Errorf("Unexpected state: %+v", state)
+		}
+	})
+
+	t.Run("diff_against_previous_run", func(t *testing.T) {
+		prev := runState{
+			LastRun: now.Add(-24 * time.Hour),
+			Active:  []string{"/v/a.md@2025-09-27", "/v/c.md@2025-09-26"},
+		}
+		tasks := active()
+		markNewTasks(tasks, prev, now)
+
+		expected := map[string]bool{"still active": false, "newly active": true, "newly due": true}
+		for _, task := range tasks {
+			if task.New != expected[task.Name] {
+				t.Errorf("%s: expected New=%v, got %v", task.Name, expected[task.Name], task.New)
+			}
+		}
+	})
+}
+
+func TestRunStateRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "state.json")
+
+	state, err := loadRunState(path)
+	if err != nil || !state.LastRun.IsZero() {
+		t.Fatalf("Expected empty state for missing file, got %+v (err %v)", state, err)
+	}
+
+	saved := runState{LastRun: time.Date(2025, 9, 26, 8, 0, 0, 0, time.UTC), Active: []string{"/v/a.md"}}
+	if err := saveRunState(path, saved); err != nil {
+		t.Fatalf("saveRunState failed: %v", err)
+	}
+	loaded, err := loadRunState(path)
+	if err != nil {
+		t.Fatalf("loadRunState failed: %v", err)
+	}
+	if !loaded.LastRun.Equal(saved.LastRun) || len(loaded.Active) != 1 || loaded.Active[0] != "/v/a.md" {
+		t.Errorf("Round trip mismatch: %+v", loaded)
+	}
+}
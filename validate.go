@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/harnyk/obsidian-tasks/agenda"
+	"gopkg.in/yaml.v3"
+)
+
+// validateConfig checks the first usable config file in paths, or with merge
+// all of them layered in order (--config), and the notes directory it
+// resolves to, printing the resolved settings to w. A merged config must set
+// notes_dir itself, which then wins over OBSIDIAN_NOTES_DIR. It returns the
+// exit code: 0 when everything is usable, 1 otherwise.
+func validateConfig(w io.Writer, paths []string, merge bool) int {
+	problems := 0
+	report := func(format string, args ...any) {
+		problems++
+		fmt.Fprintf(w, "Error: "+format+"\n", args...)
+	}
+
+	var config Config
+	source := ""
+	if merge {
+		merged, err := loadConfigFiles(paths)
+		if err != nil {
+			report("%v", err)
+		} else {
+			config, source = merged, strings.Join(paths, " + ")
+		}
+		paths = nil
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			report("%s: %v", path, err)
+			continue
+		}
+		var candidate Config
+		if err := yaml.Unmarshal(data, &candidate); err != nil {
+			report("%s: %v", path, err)
+			continue
+		}
+		if len(candidate.notesDirs()) > 0 {
+			config, source = candidate, path
+			break
+		}
+	}
+
+	notesDirs := config.notesDirs()
+	notesDirSource := source
+	if env := splitNotesDirs(os.Getenv("OBSIDIAN_NOTES_DIR")); len(env) > 0 && !merge {
+		notesDirs, notesDirSource = env, "OBSIDIAN_NOTES_DIR"
+	}
+
+	if source == "" {
+		source = "(none)"
+	}
+	fmt.Fprintf(w, "Config file:      %s\n", source)
+
+	switch {
+	case len(notesDirs) > 0:
+	case merge && source != "(none)":
+		report("config file %s does not set notes_dir", source)
+	default:
+		report("notes directory not configured")
+	}
+	for _, notesDir := range notesDirs {
+		switch info, err := os.Stat(notesDir); {
+		case err != nil:
+			report("notes_dir %s: %v", notesDir, err)
+		case !info.IsDir():
+			report("notes_dir %s is not a directory", notesDir)
+		default:
+			fmt.Fprintf(w, "Notes directory:  %s (from %s)\n", notesDir, notesDirSource)
+		}
+	}
+
+	resolvedWeekStart := "MO (default)"
+	if config.WeekStart != "" {
+		if ws, err := agenda.ParseWeekStart(config.WeekStart); err != nil {
+			report("%v", err)
+		} else {
+			resolvedWeekStart = ws
+		}
+	}
+	fmt.Fprintf(w, "Week start:       %s\n", resolvedWeekStart)
+
+	resolvedTimezone := time.Local.String() + " (default)"
+	if config.Timezone != "" {
+		if _, err := time.LoadLocation(config.Timezone); err != nil {
+			report("invalid timezone %q", config.Timezone)
+		} else {
+			resolvedTimezone = config.Timezone
+		}
+	}
+	fmt.Fprintf(w, "Timezone:         %s\n", resolvedTimezone)
+
+	resolvedDuration := "P1D (default)"
+	if config.DefaultDuration != "" {
+		if duration, err := agenda.ParseDuration(config.DefaultDuration); err != nil || duration <= 0 {
+			report("invalid default_duration %q", config.DefaultDuration)
+		} else {
+			resolvedDuration = config.DefaultDuration
+		}
+	}
+	fmt.Fprintf(w, "Default duration: %s\n", resolvedDuration)
+
+	if config.FilenamePrefixRegex != "" {
+		if _, err := compileFilenamePrefix(config.FilenamePrefixRegex); err != nil {
+			report("%v", err)
+		} else {
+			fmt.Fprintf(w, "Filename prefix:  %s\n", config.FilenamePrefixRegex)
+		}
+	}
+
+	retries := agenda.ReadAttempts
+	if config.ReadRetries > 0 {
+		retries = config.ReadRetries
+	}
+	fmt.Fprintf(w, "Read attempts:    %d\n", retries)
+	fmt.Fprintf(w, "ASCII output:     %v\n", config.ASCII)
+
+	if config.DueTiers != nil {
+		if err := validateDueTiers(config.DueTiers); err != nil {
+			report("%v", err)
+		}
+	}
+
+	if config.OpenCommand == "" {
+		fmt.Fprintln(w, "Open command:     Obsidian (default)")
+	} else if _, err := renderOpenCommand(config.OpenCommand, agenda.Task{}); err != nil {
+		report("%v", err)
+	} else {
+		fmt.Fprintf(w, "Open command:     %s\n", config.OpenCommand)
+	}
+
+	if problems > 0 {
+		return 1
+	}
+	fmt.Fprintln(w, "Config OK")
+	return 0
+}
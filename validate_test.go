@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestValidateConfig(t *testing.T) {
+	t.Setenv("OBSIDIAN_NOTES_DIR", "")
+	dir := t.TempDir()
+	notesDir := t.TempDir()
+	notePath := filepath.Join(notesDir, "note.md")
+	if err := os.WriteFile(notePath, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		content  string
+		wantCode int
+		wantOut  string
+	}{
+		{"valid", "notes_dir: " + notesDir + "\nweek_start: su\n", 0, "Week start:       SU"},
+		{"missing_dir", "notes_dir: " + filepath.Join(notesDir, "missing") + "\n", 1, "no such file"},
+		{"not_a_dir", "notes_dir: " + notePath + "\n", 1, "is not a directory"},
+		{"timezone", "notes_dir: " + notesDir + "\ntimezone: Europe/Kyiv\n", 0, "Timezone:         Europe/Kyiv"},
+		{"bad_timezone", "notes_dir: " + notesDir + "\ntimezone: Mars/Olympus\n", 1, "invalid timezone"},
+		{"bad_week_start", "notes_dir: " + notesDir + "\nweek_start: XX\n", 1, "invalid week_start"},
+		{"bad_default_duration", "notes_dir: " + notesDir + "\ndefault_duration: P1\n", 1, "invalid default_duration"},
+		{"bad_open_command", "notes_dir: " + notesDir + "\nopen_command: \"code {{.Nope}}\"\n", 1, "invalid open_command"},
+		{"bad_due_tiers", "notes_dir: " + notesDir + "\ndue_tiers: [7, 2]\n", 1, "invalid due_tiers"},
+		{"filename_prefix", "notes_dir: " + notesDir + "\nfilename_prefix_regex: '^\\d{8} - '\n", 0, "Filename prefix:  ^\\d{8} - "},
+		{"bad_filename_prefix", "notes_dir: " + notesDir + "\nfilename_prefix_regex: '^(\\d{8}'\n", 1, "invalid filename_prefix_regex"},
+		{"no_notes_dir", "ascii: true\n", 1, "not configured"},
+		{"invalid_yaml", "notes_dir: [\n", 1, "Error: "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfig(t, dir, tt.name+".yaml", tt.content)
+			var out bytes.Buffer
+			code := validateConfig(&out, []string{filepath.Join(dir, "absent.yaml"), path}, false)
+			if code != tt.wantCode {
+				t.Errorf("Expected exit code %d, got %d\n%s", tt.wantCode, code, out.String())
+			}
+			if !strings.Contains(out.String(), tt.wantOut) {
+				t.Errorf("Expected output to contain %q, got:\n%s", tt.wantOut, out.String())
+			}
+		})
+	}
+}
+
+func TestValidateConfig_EnvOverridesNotesDir(t *testing.T) {
+	notesDir := t.TempDir()
+	t.Setenv("OBSIDIAN_NOTES_DIR", notesDir)
+
+	var out bytes.Buffer
+	if code := validateConfig(&out, nil, false); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d\n%s", code, out.String())
+	}
+	if !strings.Contains(out.String(), "from OBSIDIAN_NOTES_DIR") {
+		t.Errorf("Expected notes dir to come from the environment, got:\n%s", out.String())
+	}
+}
+
+func TestValidateConfig_Merged(t *testing.T) {
+	t.Setenv("OBSIDIAN_NOTES_DIR", "")
+	dir := t.TempDir()
+	notesDir := t.TempDir()
+	base := writeConfig(t, dir, "base.yaml", "notes_dir: "+notesDir+"\nweek_start: MO\n")
+	local := writeConfig(t, dir, "local.yaml", "week_start: SU\n")
+
+	var out bytes.Buffer
+	if code := validateConfig(&out, []string{base, local}, true); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d\n%s", code, out.String())
+	}
+	if !strings.Contains(out.String(), "Week start:       SU") {
+		t.Errorf("Expected the later file to win, got:\n%s", out.String())
+	}
+
+	out.Reset()
+	if code := validateConfig(&out, []string{base, filepath.Join(dir, "absent.yaml")}, true); code != 1 {
+		t.Errorf("Expected a missing explicit config to fail, got %d\n%s", code, out.String())
+	}
+}
+
+func TestValidateConfig_ExplicitConfigNotesDir(t *testing.T) {
+	dir := t.TempDir()
+	notesDir := t.TempDir()
+	t.Setenv("OBSIDIAN_NOTES_DIR", t.TempDir())
+	path := writeConfig(t, dir, "config.yaml", "notes_dir: "+notesDir+"\n")
+
+	var out bytes.Buffer
+	if code := validateConfig(&out, []string{path}, true); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d\n%s", code, out.String())
+	}
+	if !strings.Contains(out.String(), notesDir+" (from "+path+")") {
+		t.Errorf("Expected the --config notes dir to win over the environment, got:\n%s", out.String())
+	}
+
+	out.Reset()
+	bare := writeConfig(t, dir, "bare.yaml", "week_start: SU\n")
+	if code := validateConfig(&out, []string{bare}, true); code != 1 || !strings.Contains(out.String(), "does not set notes_dir") {
+		t.Errorf("Expected a config without notes_dir to fail, got %d\n%s", code, out.String())
+	}
+}
+
+func TestLoadConfigEmptyArchiveDirs(t *testing.T) {
+	path := writeConfig(t, t.TempDir(), "config.yaml", "archive_dirs: []\n")
+	config, err := loadConfigFiles([]string{path})
+	if err != nil {
+		t.Fatalf("loadConfigFiles failed: %v", err)
+	}
+	if config.ArchiveDirs == nil || len(config.ArchiveDirs) != 0 {
+		t.Errorf("Expected an empty, non-nil list to disable archive skipping, got %#v", config.ArchiveDirs)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/harnyk/obsidian-tasks/agenda"
+)
+
+// watchDebounce is how long notes must stay unchanged before --watch
+// redraws, so one save that touches a file several times redraws once
+var watchDebounce = 300 * time.Millisecond
+
+// watchPollInterval is how often --watch rescans the notes directory when
+// file system events aren't available
+var watchPollInterval = 2 * time.Second
+
+// watchLoop clears the screen and runs fn, then again whenever notes under
+// roots change, until interrupted
+func watchLoop(roots []string, fn func()) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	redraw := func() {
+		// Move cursor home and clear the screen
+		fmt.Print("\x1b[H\x1b[2J")
+		fn()
+	}
+	redraw()
+	err := watchNotes(ctx, roots, redraw)
+	fmt.Println()
+	return err
+}
+
+// watchNotes calls changed whenever markdown notes under roots are
+// created, written, removed or renamed, until ctx is done. Bursts of changes
+// call it once. It polls when the file system watcher can't be set up.
+func watchNotes(ctx context.Context, roots []string, changed func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		verbosef("watch: %v, polling every %v instead", err, watchPollInterval)
+		return pollNotes(ctx, roots, changed)
+	}
+	defer watcher.Close()
+	for _, root := range roots {
+		if err := watchTree(watcher, root); err != nil {
+			return err
+		}
+	}
+
+	debounce := time.NewTimer(watchDebounce)
+	debounce.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Has(fsnotify.Create) {
+				// New folders aren't watched until added
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if err := watchTree(watcher, event.Name); err != nil {
+						verbosef("watch: %v", err)
+					}
+					debounce.Reset(watchDebounce)
+					continue
+				}
+			}
+			if strings.HasSuffix(event.Name, ".md") || event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+				debounce.Reset(watchDebounce)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			verbosef("watch: %v", err)
+		case <-debounce.C:
+			changed()
+		}
+	}
+}
+
+// watchTree adds dir and every folder below it to watcher, skipping hidden
+// and archive folders like scans do
+func watchTree(watcher *fsnotify.Watcher, dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != dir && agenda.SkipDir(d.Name()) {
+			return fs.SkipDir
+		}
+		return watcher.Add(path)
+	})
+}
+
+// pollNotes is watchNotes by comparing notesFingerprint every
+// watchPollInterval
+func pollNotes(ctx context.Context, roots []string, changed func()) error {
+	last, err := notesFingerprint(roots...)
+	if err != nil {
+		return err
+	}
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		current, err := notesFingerprint(roots...)
+		if err != nil {
+			verbosef("watch: %v", err)
+			continue
+		}
+		if current != last {
+			last = current
+			changed()
+		}
+	}
+}
+
+// notesFingerprint summarizes the path, size and modification time of every
+// markdown note under roots, changing whenever a note does
+func notesFingerprint(roots ...string) (string, error) {
+	hash := sha1.New()
+	for _, root := range roots {
+		if err := fingerprintTree(hash, root); err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// fingerprintTree writes the path, size and modification time of every
+// markdown note under root to w
+func fingerprintTree(w io.Writer, root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != root && agenda.SkipDir(d.Name()) {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(d.Name(), ".md") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s\x00%d\x00%d\n", path, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWatchNotesDebounces(t *testing.T) {
+	original := watchDebounce
+	watchDebounce = 100 * time.Millisecond
+	t.Cleanup(func() { watchDebounce = original })
+
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	var calls atomic.Int32
+	done := make(chan error, 1)
+	go func() { done <- watchNotes(ctx, []string{dir}, func() { calls.Add(1) }) }()
+	time.Sleep(100 * time.Millisecond) // let the watcher start
+
+	for i := range 5 {
+		writeNote(t, dir, "note.md", "---\nrrule: FREQ=DAILY\n---\n"+string(rune('a'+i)))
+	}
+	writeNote(t, dir, "ignored.txt", "not a note")
+	time.Sleep(500 * time.Millisecond)
+	if got := calls.Load(); got != 1 {
+		t.Errorf("Expected one redraw for a burst of writes, got %d", got)
+	}
+
+	// Folders created later are watched too
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(300 * time.Millisecond)
+	before := calls.Load()
+	writeNote(t, dir, "sub/new.md", "---\nrrule: FREQ=DAILY\n---\n")
+	time.Sleep(500 * time.Millisecond)
+	if calls.Load() == before {
+		t.Errorf("Expected a redraw for a note in a new folder")
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("watchNotes failed: %v", err)
+	}
+}
+
+func TestNotesFingerprint(t *testing.T) {
+	dir := t.TempDir()
+	writeNote(t, dir, "a.md", "one")
+	first, err := notesFingerprint(dir)
+	if err != nil {
+		t.Fatalf("notesFingerprint failed: %v", err)
+	}
+
+	writeNote(t, dir, "b.txt", "not a note")
+	writeNote(t, dir, ".obsidian/workspace.md", "hidden")
+	if again, _ := notesFingerprint(dir); again != first {
+		t.Errorf("Expected non-notes and hidden folders to be ignored")
+	}
+
+	writeNote(t, dir, "a.md", "one, edited")
+	if changed, _ := notesFingerprint(dir); changed == first {
+		t.Errorf("Expected an edited note to change the fingerprint")
+	}
+}
+
+func TestParseFlagsWatch(t *testing.T) {
+	if opts, err := parseFlags([]string{"--watch"}); err != nil || !opts.Watch {
+		t.Errorf("Expected --watch to parse, got %+v (err %v)", opts, err)
+	}
+	if _, err := parseFlags([]string{"--watch", "--refresh", "1m"}); err == nil {
+		t.Errorf("Expected error for --watch with --refresh")
+	}
+}
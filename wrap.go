@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// wrapWidth is the number of columns --wrap fits task lines into; 0 leaves
+// lines as they are
+var wrapWidth = 0
+
+// minWrappedLabel is the fewest columns a task name is shortened to, however
+// long the rest of its line is
+const minWrappedLabel = 8
+
+// terminalWidth returns the width of the terminal on stdout, or 0 when
+// stdout isn't a terminal or its size is unknown
+func terminalWidth() int {
+	if !stdoutIsTerminal() {
+		return 0
+	}
+	columns, _, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		return 0
+	}
+	return columns
+}
+
+// stdoutIsTerminal reports whether stdout is a terminal rather than a pipe
+// or file
+func stdoutIsTerminal() bool {
+	return term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// leadingEscapePattern matches an escape sequence at the start of a string
+var leadingEscapePattern = regexp.MustCompile(`^(?:` + escapeSequencePattern.String() + `)`)
+
+// truncateDisplay shortens s to at most width display columns, marking the
+// cut with an ellipsis. Escape sequences are copied whole, including those
+// after the cut, so colors are reset and hyperlinks closed as before.
+func truncateDisplay(s string, width int) string {
+	if displayWidth(s) <= width {
+		return s
+	}
+
+	var b strings.Builder
+	columns := 0
+	cut := false
+	spaces := "" // held back so none are left dangling before the ellipsis
+	for s != "" {
+		if escape := leadingEscapePattern.FindString(s); escape != "" {
+			b.WriteString(escape)
+			s = s[len(escape):]
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s)
+		s = s[size:]
+		if cut {
+			continue
+		}
+		runeColumns := displayWidth(string(r))
+		switch {
+		case columns+runeColumns > width-1:
+			cut = true
+			if width > 0 {
+				b.WriteString("…")
+			}
+		case r == ' ':
+			spaces += " "
+		default:
+			b.WriteString(spaces)
+			spaces = ""
+			b.WriteRune(r)
+		}
+		columns += runeColumns
+	}
+	return b.String()
+}
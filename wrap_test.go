@@ -0,0 +1,66 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/harnyk/obsidian-tasks/agenda"
+)
+
+func TestTruncateDisplay(t *testing.T) {
+	link := createTerminalHyperlink("obsidian://open?file=Pay%20rent", "Pay the rent")
+	tests := []struct {
+		name     string
+		s        string
+		width    int
+		expected string
+	}{
+		{"fits", "Pay rent", 8, "Pay rent"},
+		{"plain", "Pay the rent", 6, "Pay t…"},
+		{"wide characters", "会議の準備", 6, "会議…"},
+		{"hyperlink kept whole", link, 6, createTerminalHyperlink("obsidian://open?file=Pay%20rent", "Pay t…")},
+		{"color reset kept", "\x1b[1mBold name\x1b[0m", 5, "\x1b[1mBold…\x1b[0m"},
+		{"no room", "Pay rent", 0, ""},
+	}
+
+	for _, tt := range tests {
+		got := truncateDisplay(tt.s, tt.width)
+		if got != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.expected, got)
+		}
+		if displayWidth(got) > tt.width {
+			t.Errorf("%s: %q is %d columns wide, over %d", tt.name, got, displayWidth(got), tt.width)
+		}
+	}
+}
+
+func TestPrintTaskLinesWrap(t *testing.T) {
+	originalNoColor, originalWidth := color.NoColor, wrapWidth
+	color.NoColor = true
+	t.Cleanup(func() { color.NoColor, wrapWidth = originalNoColor, originalWidth })
+
+	due := time.Date(2999, 1, 3, 0, 0, 0, 0, time.UTC)
+	tasks := []agenda.Task{
+		{Name: "A rather long task name that will not fit", RRule: "FREQ=DAILY", Duration: "P1D", DueDate: &due},
+		{Name: "Short", RRule: "FREQ=DAILY", Duration: "P1D", DueDate: &due},
+	}
+
+	wrapWidth = 50
+	var out strings.Builder
+	printTaskLines(&out, tasks, "  - ", 0, color.FgGreen, Options{})
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if lines[0] != "  - A rather long… (FREQ=DAILY, P1D → 2999-01-03)" {
+		t.Errorf("Unexpected wrapped line %q", lines[0])
+	}
+	if lines[1] != "  - Short (FREQ=DAILY, P1D → 2999-01-03)" {
+		t.Errorf("Expected short names untouched, got %q", lines[1])
+	}
+	for _, line := range lines {
+		if displayWidth(line) > wrapWidth {
+			t.Errorf("%q is wider than %d columns", line, wrapWidth)
+		}
+	}
+}